@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"api-pay/auth"
+	"api-pay/db"
+	initialization "api-pay/init"
+)
+
+// runAdmin 创建或重置管理员：api-pay admin -username <name> -password <password> [-role admin]
+// 用于初始化第一个管理员，已存在时重置密码和角色并启用
+func runAdmin(args []string) int {
+	fs := flag.NewFlagSet("admin", flag.ContinueOnError)
+	username := fs.String("username", "", "用户名")
+	password := fs.String("password", "", "密码，至少 8 位")
+	role := fs.String("role", auth.RoleAdmin, "角色 viewer、operator、admin")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *username == "" || *password == "" || !auth.ValidRole(*role) {
+		fs.Usage()
+		return 2
+	}
+
+	hash, err := auth.HashPassword(*password)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid password: %v\n", err)
+		return 2
+	}
+
+	initialization.Initialization()
+
+	user, err := db.GetAdminUserByUsername(*username)
+	switch {
+	case errors.Is(err, db.ErrAdminNotFound):
+		err = db.CreateAdminUser(&db.AdminUser{Username: *username, PasswordHash: hash, Role: *role})
+	case err == nil:
+		_, err = db.UpdateAdminUser(user.ID, map[string]interface{}{
+			"password_hash": hash,
+			"role":          *role,
+			"disabled":      false,
+		})
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "save admin failed: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("admin %s saved with role %s\n", *username, *role)
+	return 0
+}
@@ -0,0 +1,297 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	conf "api-pay/config"
+	"api-pay/db"
+	"api-pay/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 管理后台角色，权限依次递增
+const (
+	RoleViewer   = "viewer"   // 只读
+	RoleOperator = "operator" // 日常运营操作
+	RoleAdmin    = "admin"    // 全部权限，包括账号和客户端管理
+)
+
+// 令牌类型
+const (
+	TokenAccess  = "access"
+	TokenRefresh = "refresh"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrInvalidToken       = errors.New("invalid or expired token")
+	ErrInvalidRole        = errors.New("invalid role")
+	ErrWeakPassword       = errors.New("password must be at least 8 characters")
+)
+
+// minPasswordLength 密码最小长度
+const minPasswordLength = 8
+
+// versionCacheTTL 管理员令牌版本的缓存时长，修改密码、角色或停用后最迟在该时长后访问令牌失效
+const versionCacheTTL = 5 * time.Second
+
+var roleRank = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// Claims 令牌内容，Version 与管理员当前的令牌版本一致时令牌才有效
+type Claims struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	Type     string `json:"type"`
+	Version  int    `json:"ver"`
+	jwt.RegisteredClaims
+}
+
+// UserID 令牌所属管理员ID
+func (c *Claims) UserID() uint {
+	id, _ := strconv.ParseUint(c.Subject, 10, 64)
+	return uint(id)
+}
+
+// TokenPair 登录或刷新后返回的令牌
+type TokenPair struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int64  `json:"expires_in"`         // 访问令牌有效期，单位秒
+	RefreshExpiresIn int64  `json:"refresh_expires_in"` // 刷新令牌有效期，单位秒
+}
+
+var (
+	secretOnce sync.Once
+	secret     []byte
+)
+
+// tokenVersion 缓存的管理员令牌版本，停用的管理员版本为 -1
+type tokenVersion struct {
+	version int
+	expires time.Time
+}
+
+var (
+	versionMu    sync.Mutex
+	versionCache = map[uint]tokenVersion{}
+)
+
+// dummyHash 用户不存在时参与比较的哈希
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("api-pay"), bcrypt.DefaultCost)
+
+// signingKey 令牌签名密钥，未配置时使用 GenerateJWTSecret 随机生成
+func signingKey() []byte {
+	secretOnce.Do(func() {
+		if conf.AppConfig.Admin.JWTSecret != "" {
+			secret = []byte(conf.AppConfig.Admin.JWTSecret)
+			return
+		}
+		secret = utils.GenerateJWTSecret()
+	})
+	return secret
+}
+
+// ValidRole 判断角色是否有效
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// HasRole 判断角色是否具备 required 的权限
+func HasRole(role, required string) bool {
+	return roleRank[role] >= roleRank[required] && roleRank[role] > 0
+}
+
+// HashPassword 使用 bcrypt 生成密码哈希
+func HashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", ErrWeakPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// Login 校验用户名密码并签发令牌
+func Login(username, password string) (*db.AdminUser, *TokenPair, error) {
+	user, err := db.GetAdminUserByUsername(username)
+	if err != nil {
+		if errors.Is(err, db.ErrAdminNotFound) {
+			// 用户不存在时同样计算一次哈希，避免通过响应时间探测用户名
+			_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+			return nil, nil, ErrInvalidCredentials
+		}
+		return nil, nil, err
+	}
+	if user.Disabled || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, nil, ErrInvalidCredentials
+	}
+
+	tokens, err := IssueTokens(user)
+	if err != nil {
+		return nil, nil, err
+	}
+	_ = db.RecordAdminLogin(user.ID)
+	return user, tokens, nil
+}
+
+// ChangePassword 校验原密码后修改密码，已签发的刷新令牌随之失效
+func ChangePassword(id uint, oldPassword, newPassword string) error {
+	user, err := db.GetAdminUser(id)
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(oldPassword)) != nil {
+		return ErrInvalidCredentials
+	}
+
+	hash, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	_, err = UpdateAdmin(id, map[string]interface{}{"password_hash": hash})
+	return err
+}
+
+// UpdateAdmin 更新管理员，修改密码、角色或停用后已签发的令牌全部失效
+func UpdateAdmin(id uint, changes map[string]interface{}) (*db.AdminUser, error) {
+	defer forgetTokenVersion(id)
+	return db.UpdateAdminUser(id, changes)
+}
+
+// Refresh 使用刷新令牌换取新的令牌，管理员停用或令牌版本变化后失效
+func Refresh(refreshToken string) (*TokenPair, error) {
+	claims, err := ParseToken(refreshToken, TokenRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := db.GetAdminUser(claims.UserID())
+	if err != nil {
+		if errors.Is(err, db.ErrAdminNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	if user.Disabled || user.TokenVersion != claims.Version {
+		return nil, ErrInvalidToken
+	}
+	return IssueTokens(user)
+}
+
+// Logout 使管理员已签发的令牌全部失效
+func Logout(id uint) error {
+	defer forgetTokenVersion(id)
+	return db.RevokeAdminTokens(id)
+}
+
+// IssueTokens 签发访问令牌和刷新令牌
+func IssueTokens(user *db.AdminUser) (*TokenPair, error) {
+	accessTTL := time.Duration(conf.AppConfig.Admin.AccessTTL) * time.Minute
+	if accessTTL <= 0 {
+		accessTTL = 30 * time.Minute
+	}
+	refreshTTL := time.Duration(conf.AppConfig.Admin.RefreshTTL) * time.Hour
+	if refreshTTL <= 0 {
+		refreshTTL = 7 * 24 * time.Hour
+	}
+
+	access, err := signToken(user, TokenAccess, accessTTL)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := signToken(user, TokenRefresh, refreshTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:      access,
+		RefreshToken:     refresh,
+		ExpiresIn:        int64(accessTTL.Seconds()),
+		RefreshExpiresIn: int64(refreshTTL.Seconds()),
+	}, nil
+}
+
+// ParseToken 校验令牌签名、有效期、类型和令牌版本，管理员停用或令牌版本变化后失效
+func ParseToken(token, tokenType string) (*Claims, error) {
+	claims := &Claims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return signingKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !parsed.Valid || claims.Type != tokenType {
+		return nil, ErrInvalidToken
+	}
+
+	version, err := currentTokenVersion(claims.UserID())
+	if err != nil {
+		return nil, err
+	}
+	if version != claims.Version {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// currentTokenVersion 查询管理员当前的令牌版本，结果缓存 versionCacheTTL，管理员不存在时返回 ErrInvalidToken
+func currentTokenVersion(id uint) (int, error) {
+	now := time.Now()
+	versionMu.Lock()
+	cached, ok := versionCache[id]
+	versionMu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.version, nil
+	}
+
+	user, err := db.GetAdminUser(id)
+	if err != nil {
+		if errors.Is(err, db.ErrAdminNotFound) {
+			return 0, ErrInvalidToken
+		}
+		return 0, err
+	}
+	version := user.TokenVersion
+	if user.Disabled {
+		version = -1
+	}
+
+	versionMu.Lock()
+	versionCache[id] = tokenVersion{version: version, expires: now.Add(versionCacheTTL)}
+	versionMu.Unlock()
+	return version, nil
+}
+
+// forgetTokenVersion 令牌版本变化后清除本实例的缓存，其他实例在缓存过期后生效
+func forgetTokenVersion(id uint) {
+	versionMu.Lock()
+	delete(versionCache, id)
+	versionMu.Unlock()
+}
+
+func signToken(user *db.AdminUser, tokenType string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		Username: user.Username,
+		Role:     user.Role,
+		Type:     tokenType,
+		Version:  user.TokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(signingKey())
+	if err != nil {
+		return "", fmt.Errorf("sign token: %w", err)
+	}
+	return token, nil
+}
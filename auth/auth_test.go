@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"api-pay/db"
+	"api-pay/db/dbtest"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// createAdmin 创建管理员，密码为 password
+func createAdmin(t *testing.T, username, role string) *db.AdminUser {
+	t.Helper()
+	hash, err := HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &db.AdminUser{Username: username, PasswordHash: hash, Role: role}
+	if err := db.CreateAdminUser(user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// setup 打开测试数据库并清空令牌版本缓存
+func setup(t *testing.T) {
+	dbtest.Open(t)
+	versionMu.Lock()
+	clear(versionCache)
+	versionMu.Unlock()
+}
+
+func TestHasRole(t *testing.T) {
+	tests := []struct {
+		role, required string
+		want           bool
+	}{
+		{RoleViewer, RoleViewer, true},
+		{RoleViewer, RoleOperator, false},
+		{RoleOperator, RoleViewer, true},
+		{RoleOperator, RoleAdmin, false},
+		{RoleAdmin, RoleOperator, true},
+		{RoleAdmin, RoleAdmin, true},
+		{"", RoleViewer, false},
+		{"root", RoleViewer, false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got := HasRole(tt.role, tt.required); got != tt.want {
+			t.Errorf("HasRole(%q, %q) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestLogin(t *testing.T) {
+	setup(t)
+	createAdmin(t, "alice", RoleOperator)
+	disabled := createAdmin(t, "bob", RoleViewer)
+	if _, err := db.UpdateAdminUser(disabled.ID, map[string]interface{}{"disabled": true}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		username, password string
+		wantErr            error
+	}{
+		{"alice", "password", nil},
+		{"alice", "wrong", ErrInvalidCredentials},
+		{"nobody", "password", ErrInvalidCredentials},
+		{"bob", "password", ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		user, tokens, err := Login(tt.username, tt.password)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Login(%q, %q) = %v, want %v", tt.username, tt.password, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		claims, err := ParseToken(tokens.AccessToken, TokenAccess)
+		if err != nil {
+			t.Fatalf("ParseToken = %v", err)
+		}
+		if claims.UserID() != user.ID || claims.Role != RoleOperator || claims.Username != "alice" {
+			t.Errorf("claims = %+v", claims)
+		}
+	}
+}
+
+func TestParseToken(t *testing.T) {
+	setup(t)
+	user := createAdmin(t, "alice", RoleAdmin)
+	tokens, err := IssueTokens(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired := Claims{
+		Type:    TokenAccess,
+		Version: user.TokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+		},
+	}
+	expiredToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, expired).SignedString(signingKey())
+	otherKey, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{Type: TokenAccess}).SignedString([]byte("other"))
+	noneAlg, _ := jwt.NewWithClaims(jwt.SigningMethodNone, Claims{Type: TokenAccess}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	tests := []struct {
+		name, token, tokenType string
+		wantErr                bool
+	}{
+		{"access", tokens.AccessToken, TokenAccess, false},
+		{"refresh", tokens.RefreshToken, TokenRefresh, false},
+		{"refresh as access", tokens.RefreshToken, TokenAccess, true},
+		{"access as refresh", tokens.AccessToken, TokenRefresh, true},
+		{"expired", expiredToken, TokenAccess, true},
+		{"other key", otherKey, TokenAccess, true},
+		{"none alg", noneAlg, TokenAccess, true},
+		{"garbage", "not-a-token", TokenAccess, true},
+	}
+	for _, tt := range tests {
+		_, err := ParseToken(tt.token, tt.tokenType)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: ParseToken = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestTokenRevoked(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke func(t *testing.T, user *db.AdminUser)
+	}{
+		{"logout", func(t *testing.T, user *db.AdminUser) {
+			if err := Logout(user.ID); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"role changed", func(t *testing.T, user *db.AdminUser) {
+			if _, err := UpdateAdmin(user.ID, map[string]interface{}{"role": RoleViewer}); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"disabled", func(t *testing.T, user *db.AdminUser) {
+			if _, err := UpdateAdmin(user.ID, map[string]interface{}{"disabled": true}); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"password changed", func(t *testing.T, user *db.AdminUser) {
+			if err := ChangePassword(user.ID, "password", "new-password"); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t)
+			user := createAdmin(t, "alice", RoleAdmin)
+			tokens, err := IssueTokens(user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ParseToken(tokens.AccessToken, TokenAccess); err != nil {
+				t.Fatalf("ParseToken before revoke = %v", err)
+			}
+
+			tt.revoke(t, user)
+			if _, err := ParseToken(tokens.AccessToken, TokenAccess); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("access token after revoke = %v, want ErrInvalidToken", err)
+			}
+			if _, err := Refresh(tokens.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("refresh after revoke = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestTokenVersionCached(t *testing.T) {
+	setup(t)
+	user := createAdmin(t, "alice", RoleAdmin)
+	tokens, err := IssueTokens(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseToken(tokens.AccessToken, TokenAccess); err != nil {
+		t.Fatal(err)
+	}
+
+	// 其他实例修改的令牌版本在缓存过期后生效
+	if err := db.RevokeAdminTokens(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseToken(tokens.AccessToken, TokenAccess); err != nil {
+		t.Fatalf("ParseToken within cache ttl = %v", err)
+	}
+
+	versionMu.Lock()
+	cached := versionCache[user.ID]
+	cached.expires = time.Now()
+	versionCache[user.ID] = cached
+	versionMu.Unlock()
+	if _, err := ParseToken(tokens.AccessToken, TokenAccess); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("ParseToken after cache ttl = %v, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,114 @@
+package channel
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"api-pay/db"
+	"api-pay/money"
+	"api-pay/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// 支付渠道名称，与回调路由 /api/:channel/callback、/api/:channel/refund-notify 一致
+const (
+	Feizhu = "feizhu"
+	Tiktok = "tiktok"
+)
+
+var (
+	ErrNotSupported = errors.New("channel: operation not supported or api_base not configured")
+	ErrRemote       = errors.New("channel: platform returned failure")
+)
+
+// requestTimeout 调用平台接口的超时时间
+const requestTimeout = 10 * time.Second
+
+// PaymentChannel 支付渠道，封装各平台的下单、回调、应答、查单和退款差异
+type PaymentChannel interface {
+	// Name 渠道名称
+	Name() string
+	// CreatePayment 为订单生成客户端拉起支付所需的参数
+	CreatePayment(order *db.GameOrder) (PaymentParams, error)
+	// ParseCallback 解析支付回调并校验签名，失败时返回 *Error
+	ParseCallback(c *fiber.Ctx) (*Notification, error)
+	// Ack 按平台要求的格式应答回调
+	Ack(c *fiber.Ctx, ack Ack) error
+	// Query 向平台查询订单支付结果
+	Query(ctx context.Context, order *db.GameOrder) (*Notification, error)
+	// Refund 向平台提交退款申请，结果通过退款通知返回
+	Refund(ctx context.Context, pay *db.GameOrderPay, refund *db.GameOrderRefund) (*RefundReceipt, error)
+	// ParseRefundNotify 解析退款结果通知并校验签名，失败时返回 *Error，应答同样使用 Ack
+	ParseRefundNotify(c *fiber.Ctx) (*db.RefundResult, error)
+}
+
+// PaymentParams 客户端拉起支付的参数
+type PaymentParams map[string]interface{}
+
+// Notification 平台确认的支付信息，回调与主动查单统一为该结构
+type Notification struct {
+	Channel         string
+	GameOrderNo     string
+	PlatformOrderNo string
+	Paid            bool // 平台确认已支付
+	Result          string
+	ResultMessage   string
+	Amount          money.Money
+	ServerFlag      string
+	CommonParam     string
+	Timestamp       string
+}
+
+// RefundReceipt 平台受理退款后的回执
+type RefundReceipt struct {
+	PlatformRefundNo string
+}
+
+// Error 回调处理失败时返回给平台的错误信息
+type Error struct {
+	Status int
+	State  string
+	Code   string
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.State
+}
+
+// Ack 回调应答内容，由渠道转换为平台要求的格式
+type Ack struct {
+	Success bool
+	Status  int
+	State   string
+	Code    string
+	Data    interface{}
+}
+
+// AckOK 成功应答
+func AckOK() Ack {
+	return Ack{Success: true, Status: fiber.StatusOK}
+}
+
+// AckError 失败应答
+func AckError(e *Error) Ack {
+	return Ack{Status: e.Status, State: e.State, Code: e.Code}
+}
+
+var channels = map[string]PaymentChannel{
+	Feizhu: feizhu{},
+	Tiktok: tiktok{},
+}
+
+// Get 按名称获取支付渠道
+func Get(name string) (PaymentChannel, bool) {
+	ch, ok := channels[name]
+	return ch, ok
+}
+
+// newClient 创建调用平台接口的客户端，ctx 用于传递链路追踪信息
+func newClient(ctx context.Context, baseURL string) *utils.HTTPClient {
+	client := utils.NewHTTPClient(baseURL).WithContext(ctx)
+	client.HTTPClient.Timeout = requestTimeout
+	return client
+}
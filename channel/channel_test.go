@@ -0,0 +1,206 @@
+package channel
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	conf "api-pay/config"
+	"api-pay/sign"
+	"github.com/gofiber/fiber/v2"
+)
+
+const testSecret = "secret"
+
+func setupMerchants(t *testing.T) {
+	t.Helper()
+	saved := conf.AppConfig
+	t.Cleanup(func() { conf.AppConfig = saved })
+
+	conf.AppConfig.Pay.TimestampWindow = 300
+	conf.AppConfig.Pay.Merchants = []conf.Merchant{
+		{Secret: testSecret},
+		{Channel: Tiktok, AppID: "tt1", Secret: testSecret},
+	}
+}
+
+// call 以 POST 请求调用 parse，返回解析结果
+func call[T any](t *testing.T, parse func(c *fiber.Ctx) (T, error), target, body string) (T, error) {
+	t.Helper()
+	var (
+		result T
+		err    error
+	)
+	app := fiber.New()
+	app.Post("/", func(c *fiber.Ctx) error {
+		result, err = parse(c)
+		return nil
+	})
+	req := httptest.NewRequest(fiber.MethodPost, target, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if _, testErr := app.Test(req); testErr != nil {
+		t.Fatal(testErr)
+	}
+	return result, err
+}
+
+// signedQuery 补充时间戳并按飞猪规则签名
+func signedQuery(t *testing.T, params map[string]string) string {
+	t.Helper()
+	params["timestamp"] = strconv.FormatInt(time.Now().Unix(), 10)
+	signature, err := sign.Sign(params, sign.TypeHMACSHA256, testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := url.Values{}
+	for k, v := range params {
+		values.Set(k, v)
+	}
+	values.Set("sign", signature)
+	values.Set("signType", sign.TypeHMACSHA256)
+	return "/?" + values.Encode()
+}
+
+func errorCode(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func TestFeizhuParseCallback(t *testing.T) {
+	setupMerchants(t)
+
+	tests := []struct {
+		name     string
+		result   string
+		tamper   bool
+		wantPaid bool
+		wantCode string
+	}{
+		{"success", "success", false, true, ""},
+		{"success upper case", "SUCCESS", false, true, ""},
+		{"fail", "fail", false, false, ""},
+		{"empty result", "", false, false, ""},
+		{"pending", "pending", false, false, ""},
+		{"closed", "closed", false, false, ""},
+		{"bad signature", "success", true, false, "SIGN_INVALID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := signedQuery(t, map[string]string{
+				"game_order_no": "811-1",
+				"gyyx_order_no": "P1",
+				"rmb_yuan":      "6.00",
+				"result":        tt.result,
+				"server_flag":   "s1",
+			})
+			if tt.tamper {
+				target = strings.Replace(target, "rmb_yuan=6.00", "rmb_yuan=0.01", 1)
+			}
+
+			n, err := call(t, feizhu{}.ParseCallback, target, "")
+			if code := errorCode(err); code != tt.wantCode {
+				t.Fatalf("error code = %q, want %q", code, tt.wantCode)
+			}
+			if err == nil && (n.Paid != tt.wantPaid || n.Amount.Minor() != 600) {
+				t.Errorf("Paid = %v, Amount = %s; want %v, 6.00", n.Paid, n.Amount, tt.wantPaid)
+			}
+		})
+	}
+}
+
+func TestFeizhuParseRefundNotify(t *testing.T) {
+	setupMerchants(t)
+
+	tests := []struct {
+		name        string
+		result      string
+		wantSuccess bool
+	}{
+		{"success", "success", true},
+		{"fail", "fail", false},
+		{"processing", "processing", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := signedQuery(t, map[string]string{
+				"refund_no":     "812-1",
+				"game_order_no": "811-1",
+				"refund_amount": "2.50",
+				"result":        tt.result,
+			})
+			r, err := call(t, feizhu{}.ParseRefundNotify, target, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Success != tt.wantSuccess || r.Channel != Feizhu || r.Amount.Minor() != 250 {
+				t.Errorf("result = %+v", r)
+			}
+		})
+	}
+}
+
+// tiktokBody 按抖音规则签名的回调请求体
+func tiktokBody(msg string, timestamp int64) string {
+	ts := strconv.FormatInt(timestamp, 10)
+	signature := tiktokSignature(testSecret, ts, "n1", msg)
+	return `{"timestamp":` + ts + `,"nonce":"n1","msg":` + strconv.Quote(msg) + `,"msg_signature":"` + signature + `"}`
+}
+
+func TestTiktokParseCallback(t *testing.T) {
+	setupMerchants(t)
+	now := time.Now().Unix()
+
+	tests := []struct {
+		name     string
+		msg      string
+		body     func(msg string) string
+		wantPaid bool
+		wantCode string
+	}{
+		{"paid", `{"appid":"tt1","cp_orderno":"811-1","order_id":"T1","total_amount":600,"status":"SUCCESS"}`, nil, true, ""},
+		{"not paid", `{"appid":"tt1","cp_orderno":"811-1","order_id":"T1","total_amount":600,"status":"FAIL"}`, nil, false, ""},
+		{"wrong appid", `{"appid":"tt2","cp_orderno":"811-1","order_id":"T1","total_amount":600,"status":"SUCCESS"}`, nil, false, "SIGN_INVALID"},
+		{"tampered", `{"appid":"tt1","cp_orderno":"811-1","order_id":"T1","total_amount":600,"status":"SUCCESS"}`,
+			func(msg string) string { return strings.Replace(tiktokBody(msg, now), "600", "1", 1) }, false, "SIGN_INVALID"},
+		{"expired", `{"appid":"tt1","cp_orderno":"811-1","order_id":"T1","total_amount":600,"status":"SUCCESS"}`,
+			func(msg string) string { return tiktokBody(msg, now-3600) }, false, "SIGN_EXPIRED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := tiktokBody(tt.msg, now)
+			if tt.body != nil {
+				body = tt.body(tt.msg)
+			}
+			n, err := call(t, tiktok{}.ParseCallback, "/", body)
+			if code := errorCode(err); code != tt.wantCode {
+				t.Fatalf("error code = %q, want %q", code, tt.wantCode)
+			}
+			if err == nil && (n.Paid != tt.wantPaid || n.Amount.Minor() != 600) {
+				t.Errorf("Paid = %v, Amount = %s; want %v, 6.00", n.Paid, n.Amount, tt.wantPaid)
+			}
+		})
+	}
+}
+
+func TestTiktokParseRefundNotify(t *testing.T) {
+	setupMerchants(t)
+
+	msg := `{"appid":"tt1","cp_orderno":"811-1","cp_refundno":"812-1","cp_extra":"s1","refund_id":"R1","refund_amount":250,"status":"SUCCESS"}`
+	r, err := call(t, tiktok{}.ParseRefundNotify, "/", tiktokBody(msg, time.Now().Unix()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Success || r.Channel != Tiktok || r.RefundNo != "812-1" || r.PlatformRefundNo != "R1" || r.Amount.Minor() != 250 {
+		t.Errorf("result = %+v", r)
+	}
+}
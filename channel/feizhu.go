@@ -0,0 +1,217 @@
+package channel
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	conf "api-pay/config"
+	"api-pay/db"
+	"api-pay/money"
+	"api-pay/sign"
+	"api-pay/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// feizhu 飞猪渠道：回调参数通过 URL 查询参数传递，应答使用标准响应结构
+type feizhu struct{}
+
+func (feizhu) Name() string {
+	return Feizhu
+}
+
+// CreatePayment 生成签名后的收银台参数，客户端携带参数拉起飞猪支付
+func (feizhu) CreatePayment(order *db.GameOrder) (PaymentParams, error) {
+	merchant, ok := conf.FindMerchant(Feizhu, order.ServerFlag)
+	if !ok || merchant.Secret == "" {
+		return nil, ErrNotSupported
+	}
+
+	params := map[string]string{
+		"game_order_no": order.Order,
+		"item":          order.Item,
+		"amount_num":    strconv.FormatInt(order.AmountNum, 10),
+		"rmb_yuan":      order.TotalPrice.String(),
+		"server_flag":   order.ServerFlag,
+		"timestamp":     strconv.FormatInt(time.Now().Unix(), 10),
+	}
+	signature, err := sign.Sign(params, sign.TypeHMACSHA256, merchant.Secret)
+	if err != nil {
+		return nil, err
+	}
+	params["sign"] = signature
+	params["sign_type"] = sign.TypeHMACSHA256
+
+	result := make(PaymentParams, len(params))
+	for k, v := range params {
+		result[k] = v
+	}
+	return result, nil
+}
+
+// ParseCallback 解析飞猪支付回调，所有查询参数都参与签名
+func (feizhu) ParseCallback(c *fiber.Ctx) (*Notification, error) {
+	// 金额按元严格解析，避免浮点误差
+	amount, err := money.ParseYuan(c.Query("rmb_yuan"))
+	if err != nil {
+		return nil, &Error{fiber.StatusBadRequest, "金额格式错误", "INVALID_PARAMS"}
+	}
+
+	n := &Notification{
+		Channel:         Feizhu,
+		GameOrderNo:     c.Query("game_order_no"),
+		PlatformOrderNo: c.Query("gyyx_order_no"),
+		Result:          c.Query("result"),
+		ResultMessage:   c.Query("result_message"),
+		Amount:          amount,
+		ServerFlag:      c.Query("server_flag"),
+		CommonParam:     c.Query("common_param"),
+		Timestamp:       c.Query("timestamp"),
+	}
+	// 仅 result 明确为 success 时视为已支付，空值、pending 等均按未支付处理
+	n.Paid = strings.EqualFold(n.Result, string(utils.ResultSuccess))
+
+	if n.GameOrderNo == "" || n.PlatformOrderNo == "" {
+		return nil, &Error{fiber.StatusBadRequest, "Missing required fields", "INVALID_PARAMS"}
+	}
+
+	if e := VerifyParams(Feizhu, QueryParams(c), n.ServerFlag, c.Query("sign"), c.Query("signType"), n.Timestamp); e != nil {
+		return nil, e
+	}
+	return n, nil
+}
+
+// ParseRefundNotify 解析飞猪退款结果通知，参数在 URL 查询串中，签名规则与支付回调相同
+func (feizhu) ParseRefundNotify(c *fiber.Ctx) (*db.RefundResult, error) {
+	// 退款金额可选，传入时按元严格解析
+	var amount money.Money
+	if raw := c.Query("refund_amount"); raw != "" {
+		parsed, err := money.ParseYuan(raw)
+		if err != nil {
+			return nil, &Error{fiber.StatusBadRequest, "金额格式错误", "INVALID_PARAMS"}
+		}
+		amount = parsed
+	}
+
+	result := c.Query("result")
+	if c.Query("refund_no") == "" || result == "" {
+		return nil, &Error{fiber.StatusBadRequest, "Missing required fields", "INVALID_PARAMS"}
+	}
+
+	if e := VerifyParams(Feizhu, QueryParams(c), c.Query("server_flag"), c.Query("sign"), c.Query("signType"), c.Query("timestamp")); e != nil {
+		return nil, e
+	}
+
+	return &db.RefundResult{
+		RefundNo:         c.Query("refund_no"),
+		Channel:          Feizhu,
+		GameOrderNo:      c.Query("game_order_no"),
+		Amount:           amount,
+		Success:          strings.EqualFold(result, string(utils.ResultSuccess)),
+		PlatformRefundNo: c.Query("gyyx_refund_no"),
+		Message:          c.Query("result_message"),
+	}, nil
+}
+
+// Ack 飞猪按标准响应结构应答
+func (feizhu) Ack(c *fiber.Ctx, ack Ack) error {
+	resp := utils.NewResponse(c)
+	if !ack.Success {
+		return resp.FailWithCode(ack.Status, ack.State, ack.Code)
+	}
+	if ack.State == "" && ack.Data == nil {
+		return resp.Success()
+	}
+	return resp.CustomWithData(fiber.StatusOK, string(utils.ResultSuccess), ack.State, ack.Data)
+}
+
+// Query 调用飞猪查单接口
+func (feizhu) Query(ctx context.Context, order *db.GameOrder) (*Notification, error) {
+	merchant, params, err := feizhuRequest(order.ServerFlag, map[string]string{
+		"game_order_no": order.Order,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		utils.Response
+		Data struct {
+			GyyxOrderNo   string `json:"gyyx_order_no"`
+			Result        string `json:"result"`
+			ResultMessage string `json:"result_message"`
+			RmbYuan       string `json:"rmb_yuan"`
+		} `json:"data"`
+	}
+	if err := newClient(ctx, merchant.APIBase).Post("/order/query", params, &response); err != nil {
+		return nil, err
+	}
+	if response.Result != string(utils.ResultSuccess) {
+		return nil, fmt.Errorf("%w: %s %s", ErrRemote, response.ErrorCode, response.State)
+	}
+
+	n := &Notification{
+		Channel:         Feizhu,
+		GameOrderNo:     order.Order,
+		PlatformOrderNo: response.Data.GyyxOrderNo,
+		Result:          response.Data.Result,
+		ResultMessage:   response.Data.ResultMessage,
+		ServerFlag:      order.ServerFlag,
+		Timestamp:       params["timestamp"],
+	}
+	// 未支付的订单平台不返回平台单号
+	n.Paid = n.PlatformOrderNo != "" && response.Data.Result == string(utils.ResultSuccess)
+	if n.Paid {
+		if n.Amount, err = money.ParseYuan(response.Data.RmbYuan); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// Refund 调用飞猪退款接口
+func (feizhu) Refund(ctx context.Context, pay *db.GameOrderPay, refund *db.GameOrderRefund) (*RefundReceipt, error) {
+	merchant, params, err := feizhuRequest(pay.ServerFlag, map[string]string{
+		"refund_no":     refund.RefundNo,
+		"game_order_no": pay.GameOrderNo,
+		"gyyx_order_no": pay.GyyxOrderNo,
+		"refund_amount": refund.Amount.String(),
+		"reason":        refund.Reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		utils.Response
+		Data struct {
+			GyyxRefundNo string `json:"gyyx_refund_no"`
+		} `json:"data"`
+	}
+	if err := newClient(ctx, merchant.APIBase).Post("/refund", params, &response); err != nil {
+		return nil, err
+	}
+	if response.Result != string(utils.ResultSuccess) {
+		return nil, fmt.Errorf("%w: %s %s", ErrRemote, response.ErrorCode, response.State)
+	}
+	return &RefundReceipt{PlatformRefundNo: response.Data.GyyxRefundNo}, nil
+}
+
+// feizhuRequest 为调用飞猪接口的参数补充时间戳并签名
+func feizhuRequest(serverFlag string, params map[string]string) (*conf.Merchant, map[string]string, error) {
+	merchant, ok := conf.FindMerchant(Feizhu, serverFlag)
+	if !ok || merchant.APIBase == "" || merchant.Secret == "" {
+		return nil, nil, ErrNotSupported
+	}
+
+	params["timestamp"] = strconv.FormatInt(time.Now().Unix(), 10)
+	signature, err := sign.Sign(params, sign.TypeHMACSHA256, merchant.Secret)
+	if err != nil {
+		return nil, nil, err
+	}
+	params["sign"] = signature
+	params["sign_type"] = sign.TypeHMACSHA256
+	return merchant, params, nil
+}
@@ -0,0 +1,87 @@
+package channel
+
+import (
+	"errors"
+	"fmt"
+
+	"api-pay/db"
+	"api-pay/metrics"
+	"api-pay/orderstate"
+	"api-pay/wxbot"
+)
+
+// ErrPaymentReview 订单过期后才确认的支付，已转人工审核
+var ErrPaymentReview = errors.New("channel: payment arrived after order expired, sent to review")
+
+// ApplyPayment 将平台确认的支付写入订单，支付回调与主动查单共用。
+// 重复确认返回 duplicate=true；订单已过期时记录人工审核并返回 ErrPaymentReview。
+func ApplyPayment(n *Notification, meta orderstate.Meta) (duplicate bool, err error) {
+	// 构建支付记录，订单信息在事务中补全
+	pay := db.GameOrderPay{
+		GameOrderNo:   n.GameOrderNo,
+		GyyxOrderNo:   n.PlatformOrderNo,
+		Channel:       n.Channel,
+		Result:        n.Result,
+		ResultMessage: n.ResultMessage,
+		RmbYuan:       n.Amount,
+		ServerFlag:    n.ServerFlag,
+		CommonParam:   n.CommonParam,
+		Timestamp:     n.Timestamp,
+	}
+
+	// 锁单、写支付记录、改订单状态在同一事务中完成
+	duplicate, err = db.PayOrder(&pay, meta)
+	if errors.Is(err, db.ErrOrderExpired) {
+		if err := reviewLatePayment(n, meta); err != nil {
+			return false, err
+		}
+		return false, ErrPaymentReview
+	}
+	if err == nil && !duplicate {
+		metrics.OrderPaid(pay.Item, pay.ServerFlag, pay.Channel, pay.RmbYuan)
+	}
+	return duplicate, err
+}
+
+// reviewLatePayment 订单过期后才到达的支付转人工审核
+func reviewLatePayment(n *Notification, meta orderstate.Meta) error {
+	review := db.GameOrderReview{
+		GameOrderNo: n.GameOrderNo,
+		GyyxOrderNo: n.PlatformOrderNo,
+		RmbYuan:     n.Amount,
+		ServerFlag:  n.ServerFlag,
+		Reason:      "订单过期后收到支付",
+		TraceID:     meta.TraceID,
+	}
+	if err := db.CreateOrderReview(&review); err != nil {
+		return err
+	}
+
+	if wxbot.WxBot != nil {
+		go wxbot.WxBot.SendMarkdown(fmt.Sprintf("**过期订单收到支付，请人工审核**\n> 渠道：%s\n> 订单号：%s\n> 平台单号：%s\n> 金额：%s",
+			n.Channel, n.GameOrderNo, n.PlatformOrderNo, n.Amount))
+	}
+	return nil
+}
+
+// QueryAndApply 向订单所属渠道查单，平台确认已支付时按回调相同的路径入账
+func QueryAndApply(order *db.GameOrder, meta orderstate.Meta) (*Notification, error) {
+	ch, ok := Get(order.Channel)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+
+	n, err := ch.Query(meta.Context(), order)
+	if err != nil {
+		return nil, err
+	}
+	if !n.Paid {
+		return n, nil
+	}
+	if n.GameOrderNo != order.Order {
+		return nil, fmt.Errorf("%w: query returned order %s", ErrRemote, n.GameOrderNo)
+	}
+
+	_, err = ApplyPayment(n, meta)
+	return n, err
+}
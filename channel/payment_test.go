@@ -0,0 +1,101 @@
+package channel
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"api-pay/db"
+	"api-pay/db/dbtest"
+	"api-pay/money"
+	"api-pay/orderstate"
+)
+
+var testMeta = orderstate.Meta{Actor: orderstate.ActorSystem, Reason: "test"}
+
+// createStaleOrder 创建 created 前、扣减了 reserved 件库存的未支付订单
+func createStaleOrder(t *testing.T, orderNo string, goods *db.GameGoods, reserved int64, created time.Duration) {
+	t.Helper()
+	order := db.GameOrder{
+		UserId:        "u-" + orderNo,
+		Item:          goods.Item,
+		ItemId:        goods.ID,
+		Order:         orderNo,
+		SinglePrice:   money.FromMinor(1000),
+		TotalPrice:    money.FromMinor(1000 * reserved),
+		AmountNum:     reserved,
+		StockReserved: reserved,
+		Channel:       Feizhu,
+	}
+	if err := db.DB.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DB.Model(&order).Update("created_at", time.Now().Add(-created)).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExpireThenLatePayment(t *testing.T) {
+	dbtest.Open(t)
+	stock := int64(8)
+	goods := db.GameGoods{Item: "gem", Stock: &stock}
+	if err := db.DB.Create(&goods).Error; err != nil {
+		t.Fatal(err)
+	}
+	createStaleOrder(t, "813-1", &goods, 2, 2*time.Hour)
+	createStaleOrder(t, "813-2", &goods, 1, time.Minute)
+
+	cutoff := time.Now().Add(-time.Hour)
+	n, err := db.ExpireOrders(cutoff, 100, testMeta)
+	if err != nil || n != 1 {
+		t.Fatalf("ExpireOrders = %d, %v, want 1", n, err)
+	}
+	// 再次执行不会重复迁移或重复归还库存
+	if n, err := db.ExpireOrders(cutoff, 100, testMeta); err != nil || n != 0 {
+		t.Fatalf("second ExpireOrders = %d, %v, want 0", n, err)
+	}
+
+	expired, err := db.GetOrderByNo("813-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired.OrderStatus != orderstate.Expired || expired.ActiveKey != nil || expired.StockReserved != 0 {
+		t.Errorf("expired order = status %s, active key %v, reserved %d", expired.OrderStatus, expired.ActiveKey, expired.StockReserved)
+	}
+	if fresh, _ := db.GetOrderByNo("813-2"); fresh.OrderStatus != orderstate.Created {
+		t.Errorf("fresh order status = %s, want created", fresh.OrderStatus)
+	}
+	var reloaded db.GameGoods
+	db.DB.First(&reloaded, goods.ID)
+	if *reloaded.Stock != 10 {
+		t.Errorf("stock = %d, want 10", *reloaded.Stock)
+	}
+
+	// 过期后到达的支付转人工审核，不入账；平台重复通知只记录一次
+	n2 := &Notification{Channel: Feizhu, GameOrderNo: "813-1", PlatformOrderNo: "P1", Amount: money.FromMinor(2000), ServerFlag: "s1"}
+	for i := 0; i < 2; i++ {
+		duplicate, err := ApplyPayment(n2, testMeta)
+		if !errors.Is(err, ErrPaymentReview) || duplicate {
+			t.Fatalf("ApplyPayment = %v, %v, want ErrPaymentReview", duplicate, err)
+		}
+	}
+	var reviews []db.GameOrderReview
+	db.DB.Find(&reviews)
+	if len(reviews) != 1 || reviews[0].GameOrderNo != "813-1" || reviews[0].GyyxOrderNo != "P1" || !reviews[0].RmbYuan.Equal(money.FromMinor(2000)) {
+		t.Errorf("reviews = %+v", reviews)
+	}
+	var pays int64
+	db.DB.Model(&db.GameOrderPay{}).Count(&pays)
+	if pays != 0 {
+		t.Errorf("late payment recorded %d pay records", pays)
+	}
+	if order, _ := db.GetOrderByNo("813-1"); order.OrderStatus != orderstate.Expired {
+		t.Errorf("status after late payment = %s, want expired", order.OrderStatus)
+	}
+
+	// 未过期的订单正常入账
+	duplicate, err := ApplyPayment(&Notification{Channel: Feizhu, GameOrderNo: "813-2", PlatformOrderNo: "P2", Amount: money.FromMinor(1000)}, testMeta)
+	if err != nil || duplicate {
+		t.Fatalf("ApplyPayment = %v, %v", duplicate, err)
+	}
+}
@@ -0,0 +1,49 @@
+package channel
+
+import (
+	"time"
+
+	conf "api-pay/config"
+	"api-pay/sign"
+	"github.com/gofiber/fiber/v2"
+)
+
+// VerifyParams 校验平台通知的签名和时间戳，params 为参与签名的全部参数
+func VerifyParams(channel string, params map[string]string, serverFlag, signature, signType, timestamp string) *Error {
+	merchant, ok := conf.FindMerchant(channel, serverFlag)
+	if !ok || merchant.Secret == "" {
+		return &Error{fiber.StatusInternalServerError, "未配置商户签名密钥", "CONFIG_ERROR"}
+	}
+
+	signType, err := sign.NormalizeType(signType)
+	if err != nil || !merchant.AllowsSignType(signType) {
+		return &Error{fiber.StatusUnauthorized, "不支持的签名类型", "SIGN_TYPE_INVALID"}
+	}
+
+	if err := sign.Verify(params, signType, signature, merchant.Secret); err != nil {
+		return &Error{fiber.StatusUnauthorized, "签名校验失败", "SIGN_INVALID"}
+	}
+
+	if e := checkTimestamp(timestamp); e != nil {
+		return e
+	}
+	return nil
+}
+
+// QueryParams 收集请求的全部查询参数
+func QueryParams(c *fiber.Ctx) map[string]string {
+	params := make(map[string]string)
+	c.Request().URI().QueryArgs().VisitAll(func(key, value []byte) {
+		params[string(key)] = string(value)
+	})
+	return params
+}
+
+// checkTimestamp 校验通知时间戳是否在允许范围内，防止重放
+func checkTimestamp(timestamp string) *Error {
+	window := time.Duration(conf.AppConfig.Pay.TimestampWindow) * time.Second
+	if err := sign.CheckTimestamp(timestamp, window, time.Now()); err != nil {
+		return &Error{fiber.StatusUnauthorized, "回调已过期或时间戳无效", "SIGN_EXPIRED"}
+	}
+	return nil
+}
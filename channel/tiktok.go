@@ -0,0 +1,280 @@
+package channel
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	conf "api-pay/config"
+	"api-pay/db"
+	"api-pay/money"
+	"api-pay/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// tiktok 抖音渠道：回调为 JSON 请求体，支付信息在 msg 字段中，
+// 签名为 token、timestamp、nonce、msg 字典序拼接后的 SHA1，应答使用 ResponseTiktok
+type tiktok struct{}
+
+// tiktokCallback 抖音回调请求体
+type tiktokCallback struct {
+	Timestamp    json.Number `json:"timestamp"`
+	Nonce        string      `json:"nonce"`
+	Msg          string      `json:"msg"`
+	Type         string      `json:"type"`
+	MsgSignature string      `json:"msg_signature"`
+}
+
+// tiktokPayment 抖音支付信息，金额单位为分
+type tiktokPayment struct {
+	AppID       string `json:"appid"`
+	CpOrderNo   string `json:"cp_orderno"`
+	CpExtra     string `json:"cp_extra"`
+	OrderID     string `json:"order_id"`
+	TotalAmount int64  `json:"total_amount"`
+	Status      string `json:"status"`
+	Message     string `json:"message"`
+}
+
+// tiktokRefund 抖音退款结果，金额单位为分
+type tiktokRefund struct {
+	AppID        string `json:"appid"`
+	CpOrderNo    string `json:"cp_orderno"`
+	CpRefundNo   string `json:"cp_refundno"`
+	CpExtra      string `json:"cp_extra"`
+	RefundID     string `json:"refund_id"`
+	RefundAmount int64  `json:"refund_amount"`
+	Status       string `json:"status"`
+	Message      string `json:"message"`
+}
+
+// tiktokPaid 支付成功状态，退款成功同样为 SUCCESS
+const tiktokPaid = "SUCCESS"
+
+func (tiktok) Name() string {
+	return Tiktok
+}
+
+// CreatePayment 生成小游戏 tt.requestGamePayment 所需参数，
+// cp_extra 携带服务器标识，回调时用于查找商户
+func (tiktok) CreatePayment(order *db.GameOrder) (PaymentParams, error) {
+	merchant, ok := conf.FindMerchant(Tiktok, order.ServerFlag)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+
+	return PaymentParams{
+		"appId":        merchant.AppID,
+		"mode":         "game",
+		"currencyType": "CNY",
+		"buyQuantity":  order.TotalPrice.Minor(),
+		"customId":     order.Order,
+		"extraInfo":    order.ServerFlag,
+	}, nil
+}
+
+// ParseCallback 解析抖音支付回调
+func (tiktok) ParseCallback(c *fiber.Ctx) (*Notification, error) {
+	var req tiktokCallback
+	if err := c.BodyParser(&req); err != nil || req.Msg == "" {
+		return nil, &Error{fiber.StatusBadRequest, "Invalid request format", "INVALID_PARAMS"}
+	}
+
+	var payment tiktokPayment
+	if err := json.Unmarshal([]byte(req.Msg), &payment); err != nil {
+		return nil, &Error{fiber.StatusBadRequest, "Invalid request format", "INVALID_PARAMS"}
+	}
+	if payment.CpOrderNo == "" || payment.OrderID == "" {
+		return nil, &Error{fiber.StatusBadRequest, "Missing required fields", "INVALID_PARAMS"}
+	}
+
+	if e := verifyTiktok(&req, payment.CpExtra, payment.AppID); e != nil {
+		return nil, e
+	}
+
+	timestamp := req.Timestamp.String()
+	return &Notification{
+		Channel:         Tiktok,
+		GameOrderNo:     payment.CpOrderNo,
+		PlatformOrderNo: payment.OrderID,
+		Paid:            payment.Status == tiktokPaid,
+		Result:          payment.Status,
+		ResultMessage:   payment.Message,
+		Amount:          money.FromMinor(payment.TotalAmount),
+		ServerFlag:      payment.CpExtra,
+		Timestamp:       timestamp,
+	}, nil
+}
+
+// ParseRefundNotify 解析抖音退款结果通知，请求体结构及签名规则与支付回调相同，退款信息在 msg 字段中
+func (tiktok) ParseRefundNotify(c *fiber.Ctx) (*db.RefundResult, error) {
+	var req tiktokCallback
+	if err := c.BodyParser(&req); err != nil || req.Msg == "" {
+		return nil, &Error{fiber.StatusBadRequest, "Invalid request format", "INVALID_PARAMS"}
+	}
+
+	var refund tiktokRefund
+	if err := json.Unmarshal([]byte(req.Msg), &refund); err != nil {
+		return nil, &Error{fiber.StatusBadRequest, "Invalid request format", "INVALID_PARAMS"}
+	}
+	if refund.CpRefundNo == "" || refund.Status == "" {
+		return nil, &Error{fiber.StatusBadRequest, "Missing required fields", "INVALID_PARAMS"}
+	}
+
+	// 退款申请时通过 cp_extra 传递服务器标识，未回传时按支付记录查找商户
+	serverFlag := refund.CpExtra
+	if serverFlag == "" && refund.CpOrderNo != "" {
+		pay, err := db.GetOrderPayByOrderNo(refund.CpOrderNo)
+		if err != nil {
+			return nil, &Error{fiber.StatusInternalServerError, "Database error", "DB_ERROR"}
+		}
+		if pay != nil {
+			serverFlag = pay.ServerFlag
+		}
+	}
+	if e := verifyTiktok(&req, serverFlag, refund.AppID); e != nil {
+		return nil, e
+	}
+
+	return &db.RefundResult{
+		RefundNo:         refund.CpRefundNo,
+		Channel:          Tiktok,
+		GameOrderNo:      refund.CpOrderNo,
+		Amount:           money.FromMinor(refund.RefundAmount),
+		Success:          refund.Status == tiktokPaid,
+		PlatformRefundNo: refund.RefundID,
+		Message:          refund.Message,
+	}, nil
+}
+
+// verifyTiktok 按服务器标识查找商户，校验 appid、消息签名和时间戳
+func verifyTiktok(req *tiktokCallback, serverFlag, appID string) *Error {
+	merchant, ok := conf.FindMerchant(Tiktok, serverFlag)
+	if !ok || merchant.Secret == "" {
+		return &Error{fiber.StatusInternalServerError, "未配置商户签名密钥", "CONFIG_ERROR"}
+	}
+	if merchant.AppID != "" && appID != merchant.AppID {
+		return &Error{fiber.StatusUnauthorized, "签名校验失败", "SIGN_INVALID"}
+	}
+
+	timestamp := req.Timestamp.String()
+	expected := tiktokSignature(merchant.Secret, timestamp, req.Nonce, req.Msg)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(req.MsgSignature))) != 1 {
+		return &Error{fiber.StatusUnauthorized, "签名校验失败", "SIGN_INVALID"}
+	}
+	return checkTimestamp(timestamp)
+}
+
+// Ack 抖音要求 err_no 为 0 表示接收成功，非 0 时平台会重试
+func (tiktok) Ack(c *fiber.Ctx, ack Ack) error {
+	resp := utils.NewResponse(c)
+	if ack.Success {
+		return resp.SuccessTiktok()
+	}
+
+	traceID, _ := c.Locals("trace_id").(string)
+	return c.Status(ack.Status).JSON(utils.ResponseTiktok{
+		ErrNo:   ack.Status,
+		ErrTips: ack.Code,
+		Message: ack.State,
+		TraceID: traceID,
+	})
+}
+
+// Query 调用抖音查单接口
+func (tiktok) Query(ctx context.Context, order *db.GameOrder) (*Notification, error) {
+	merchant, params, err := tiktokRequest(order.ServerFlag, map[string]string{
+		"cp_orderno": order.Order,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		utils.ResponseTiktok
+		Data tiktokPayment `json:"data"`
+	}
+	if err := newClient(ctx, merchant.APIBase).Post("/order/query", params, &response); err != nil {
+		return nil, err
+	}
+	if response.ErrNo != 0 {
+		return nil, fmt.Errorf("%w: %d %s", ErrRemote, response.ErrNo, response.ErrTips)
+	}
+
+	return &Notification{
+		Channel:         Tiktok,
+		GameOrderNo:     order.Order,
+		PlatformOrderNo: response.Data.OrderID,
+		Paid:            response.Data.Status == tiktokPaid && response.Data.OrderID != "",
+		Result:          response.Data.Status,
+		ResultMessage:   response.Data.Message,
+		Amount:          money.FromMinor(response.Data.TotalAmount),
+		ServerFlag:      order.ServerFlag,
+		Timestamp:       params["timestamp"],
+	}, nil
+}
+
+// Refund 调用抖音退款接口，金额单位为分
+func (tiktok) Refund(ctx context.Context, pay *db.GameOrderPay, refund *db.GameOrderRefund) (*RefundReceipt, error) {
+	merchant, params, err := tiktokRequest(pay.ServerFlag, map[string]string{
+		"cp_orderno":    pay.GameOrderNo,
+		"order_id":      pay.GyyxOrderNo,
+		"cp_refundno":   refund.RefundNo,
+		"refund_amount": strconv.FormatInt(refund.Amount.Minor(), 10),
+		"reason":        refund.Reason,
+		"cp_extra":      pay.ServerFlag, // 退款通知中回传，用于查找商户
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		utils.ResponseTiktok
+		Data struct {
+			RefundID string `json:"refund_id"`
+		} `json:"data"`
+	}
+	if err := newClient(ctx, merchant.APIBase).Post("/refund", params, &response); err != nil {
+		return nil, err
+	}
+	if response.ErrNo != 0 {
+		return nil, fmt.Errorf("%w: %d %s", ErrRemote, response.ErrNo, response.ErrTips)
+	}
+	return &RefundReceipt{PlatformRefundNo: response.Data.RefundID}, nil
+}
+
+// tiktokRequest 为调用抖音接口的参数补充 appid、时间戳和签名
+func tiktokRequest(serverFlag string, params map[string]string) (*conf.Merchant, map[string]string, error) {
+	merchant, ok := conf.FindMerchant(Tiktok, serverFlag)
+	if !ok || merchant.APIBase == "" || merchant.Secret == "" {
+		return nil, nil, ErrNotSupported
+	}
+
+	params["appid"] = merchant.AppID
+	params["timestamp"] = strconv.FormatInt(time.Now().Unix(), 10)
+	params["nonce"] = uuid.New().String()
+
+	values := make([]string, 0, len(params))
+	for _, v := range params {
+		values = append(values, v)
+	}
+	params["sign"] = tiktokSignature(merchant.Secret, values...)
+	return merchant, params, nil
+}
+
+// tiktokSignature 所有参与签名的值按字典序排序后拼接，再计算 SHA1
+func tiktokSignature(token string, values ...string) string {
+	parts := append([]string{token}, values...)
+	sort.Strings(parts)
+
+	sum := sha1.Sum([]byte(strings.Join(parts, "")))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,222 @@
+// mockpay 本地模拟支付平台（飞猪渠道），用于端到端验证查单和退款：
+//
+//	go run ./cmd/mockpay -addr :9090 -secret <商户密钥> -callback http://localhost:3000/api/feizhu/callback
+//
+// 将商户的 api_base 配置为 http://localhost:9090 后：
+//
+//	POST /mock/pay?game_order_no=xxx&rmb_yuan=1.00          标记订单已支付，不发送回调（模拟回调丢失）
+//	POST /mock/pay?game_order_no=xxx&rmb_yuan=1.00&notify=1 标记已支付并发送支付回调
+//	GET  /mock/orders                                       查看已支付订单
+//
+// 平台接口 /order/query、/refund 与 channel 包中的飞猪实现对应。
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"api-pay/money"
+	"api-pay/sign"
+	"api-pay/utils"
+)
+
+// payment 模拟平台上的一笔支付
+type payment struct {
+	GameOrderNo string `json:"game_order_no"`
+	GyyxOrderNo string `json:"gyyx_order_no"`
+	RmbYuan     string `json:"rmb_yuan"`
+	ServerFlag  string `json:"server_flag"`
+	PaidAt      string `json:"paid_at"`
+}
+
+type platform struct {
+	secret   string
+	callback string
+
+	mu       sync.Mutex
+	payments map[string]*payment
+	seq      int64
+}
+
+func main() {
+	addr := flag.String("addr", ":9090", "监听地址")
+	secret := flag.String("secret", "", "商户签名密钥，与 pay.merchants 中的 secret 一致")
+	callback := flag.String("callback", "", "支付回调地址，notify=1 时使用")
+	flag.Parse()
+
+	if *secret == "" {
+		log.Fatal("mockpay: -secret is required")
+	}
+
+	p := &platform{secret: *secret, callback: *callback, payments: make(map[string]*payment)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/order/query", p.handleQuery)
+	mux.HandleFunc("/refund", p.handleRefund)
+	mux.HandleFunc("/mock/pay", p.handlePay)
+	mux.HandleFunc("/mock/orders", p.handleOrders)
+
+	log.Printf("mockpay listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+// handleQuery 平台查单接口
+func (p *platform) handleQuery(w http.ResponseWriter, r *http.Request) {
+	params, ok := p.verify(w, r)
+	if !ok {
+		return
+	}
+
+	p.mu.Lock()
+	pay := p.payments[params["game_order_no"]]
+	p.mu.Unlock()
+
+	data := map[string]string{"result": "", "result_message": "未支付"}
+	if pay != nil {
+		data = map[string]string{
+			"gyyx_order_no":  pay.GyyxOrderNo,
+			"result":         string(utils.ResultSuccess),
+			"result_message": "支付成功",
+			"rmb_yuan":       pay.RmbYuan,
+		}
+	}
+	writeJSON(w, http.StatusOK, utils.Response{Result: string(utils.ResultSuccess), Data: data})
+}
+
+// handleRefund 平台退款接口，直接受理
+func (p *platform) handleRefund(w http.ResponseWriter, r *http.Request) {
+	params, ok := p.verify(w, r)
+	if !ok {
+		return
+	}
+
+	p.mu.Lock()
+	pay := p.payments[params["game_order_no"]]
+	p.mu.Unlock()
+	if pay == nil {
+		writeJSON(w, http.StatusOK, utils.Response{Result: string(utils.ResultFail), State: "订单未支付", ErrorCode: "ORDER_NOT_PAID"})
+		return
+	}
+
+	log.Printf("refund accepted: refund_no=%s order=%s amount=%s", params["refund_no"], pay.GameOrderNo, params["refund_amount"])
+	writeJSON(w, http.StatusOK, utils.Response{
+		Result: string(utils.ResultSuccess),
+		Data:   map[string]string{"gyyx_refund_no": "R" + params["refund_no"]},
+	})
+}
+
+// handlePay 标记订单已支付，notify=1 时按飞猪格式发送签名回调
+func (p *platform) handlePay(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	amount, err := money.ParseYuan(q.Get("rmb_yuan"))
+	if q.Get("game_order_no") == "" || err != nil {
+		writeJSON(w, http.StatusBadRequest, utils.Response{Result: string(utils.ResultFail), State: "game_order_no 和 rmb_yuan 必填"})
+		return
+	}
+
+	p.mu.Lock()
+	pay, ok := p.payments[q.Get("game_order_no")]
+	if !ok {
+		p.seq++
+		pay = &payment{
+			GameOrderNo: q.Get("game_order_no"),
+			GyyxOrderNo: fmt.Sprintf("MOCK%d%04d", time.Now().Unix(), p.seq),
+			RmbYuan:     amount.String(),
+			ServerFlag:  q.Get("server_flag"),
+			PaidAt:      time.Now().Format("2006-01-02 15:04:05"),
+		}
+		p.payments[pay.GameOrderNo] = pay
+	}
+	p.mu.Unlock()
+
+	if q.Get("notify") == "1" {
+		if err := p.notify(pay); err != nil {
+			writeJSON(w, http.StatusBadGateway, utils.Response{Result: string(utils.ResultFail), State: err.Error(), Data: pay})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, utils.Response{Result: string(utils.ResultSuccess), Data: pay})
+}
+
+// handleOrders 列出已支付订单
+func (p *platform) handleOrders(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	list := make([]*payment, 0, len(p.payments))
+	for _, pay := range p.payments {
+		list = append(list, pay)
+	}
+	p.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, utils.Response{Result: string(utils.ResultSuccess), Data: list})
+}
+
+// notify 发送支付回调，参数通过查询字符串传递
+func (p *platform) notify(pay *payment) error {
+	if p.callback == "" {
+		return fmt.Errorf("callback url not configured")
+	}
+
+	params := map[string]string{
+		"game_order_no":  pay.GameOrderNo,
+		"gyyx_order_no":  pay.GyyxOrderNo,
+		"result":         string(utils.ResultSuccess),
+		"result_message": "支付成功",
+		"rmb_yuan":       pay.RmbYuan,
+		"server_flag":    pay.ServerFlag,
+		"timestamp":      strconv.FormatInt(time.Now().Unix(), 10),
+	}
+	signature, err := sign.Sign(params, sign.TypeHMACSHA256, p.secret)
+	if err != nil {
+		return err
+	}
+
+	values := url.Values{}
+	for k, v := range params {
+		values.Set(k, v)
+	}
+	values.Set("sign", signature)
+	values.Set("signType", sign.TypeHMACSHA256)
+
+	resp, err := http.Post(p.callback+"?"+values.Encode(), "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result utils.Response
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if result.Result != string(utils.ResultSuccess) {
+		return fmt.Errorf("callback rejected: %s %s", result.ErrorCode, result.State)
+	}
+	return nil
+}
+
+// verify 解析请求参数并校验签名
+func (p *platform) verify(w http.ResponseWriter, r *http.Request) (map[string]string, bool) {
+	var params map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		writeJSON(w, http.StatusBadRequest, utils.Response{Result: string(utils.ResultFail), State: "Invalid request format"})
+		return nil, false
+	}
+
+	if err := sign.Verify(params, params["sign_type"], params["sign"], p.secret); err != nil {
+		writeJSON(w, http.StatusUnauthorized, utils.Response{Result: string(utils.ResultFail), State: "签名校验失败", ErrorCode: "SIGN_INVALID"})
+		return nil, false
+	}
+	return params, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
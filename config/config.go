@@ -2,10 +2,10 @@ package conf
 
 import (
 	"fmt"
-	"io/ioutil"
 	"log"
-
-	"gopkg.in/yaml.v2"
+	"slices"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -28,16 +28,32 @@ type Config struct {
 	} `yaml:"database"`
 
 	App struct {
-		Name      string `yaml:"name"`
-		Prefork   bool   `yaml:"prefork"`
-		BodyLimit int    `yaml:"body_limit"`
+		Name         string `yaml:"name"`
+		Env          string `yaml:"env"` // 运行环境 dev、prod，默认 prod；非 dev 环境必须配置 admin.jwt_secret
+		Prefork      bool   `yaml:"prefork"`
+		BodyLimit    int    `yaml:"body_limit"`
+		ConfigReload int    `yaml:"config_reload"` // 配置文件检查间隔，单位秒，0 表示不自动热加载（仍可通过 SIGHUP 触发）
 	} `yaml:"app"`
 
 	Logging struct {
-		SkipPaths    []string `yaml:"skip_paths"`
-		ExcludePaths []string `yaml:"exclude_paths"`
+		SkipPaths     []string      `yaml:"skip_paths"`
+		ExcludePaths  []string      `yaml:"exclude_paths"`
+		RedactHeaders []string      `yaml:"redact_headers"` // 日志中隐藏值的请求头，不区分大小写，追加在默认列表之后
+		MaskFields    []string      `yaml:"mask_fields"`    // 替换为 *** 的字段，追加在默认列表之后；不含 . 时匹配任意层级的同名字段，含 . 时从根开始匹配
+		HashFields    []string      `yaml:"hash_fields"`    // 替换为 SHA-256 摘要前缀的字段，便于关联同一用户的日志，匹配规则同 mask_fields
+		MaxBodySize   int           `yaml:"max_body_size"`  // 请求体、响应体记录的最大字节数，默认 4096，-1 表示不截断
+		BodyRules     []LogBodyRule `yaml:"body_rules"`     // 按路径配置请求体、响应体的记录方式，按顺序匹配第一条
 	} `yaml:"logging"`
 
+	Tracing struct {
+		Exporter    string  `yaml:"exporter"`     // span 导出方式 none、otlp、file，默认 none（仍生成 trace_id）
+		Endpoint    string  `yaml:"endpoint"`     // OTLP/HTTP 接收地址，如 localhost:4318，为空时使用 OTEL_EXPORTER_OTLP_ENDPOINT
+		Insecure    bool    `yaml:"insecure"`     // OTLP 是否使用 HTTP 明文
+		File        string  `yaml:"file"`         // file 导出的文件路径，默认 logs/traces.json
+		ServiceName string  `yaml:"service_name"` // 服务名，默认 app.name
+		SampleRatio float64 `yaml:"sample_ratio"` // 采样比例 0~1，默认 1；上游已采样的请求始终采样
+	} `yaml:"tracing"`
+
 	Cors struct {
 		AllowHeaders string `yaml:"allowed_headers"`
 		AllowMethods string `yaml:"allowed_methods"`
@@ -45,10 +61,114 @@ type Config struct {
 	} `yaml:"cors"`
 
 	IPWhitelist struct {
-		AllowedIPs   []string `yaml:"allowed_ips"`
-		IncludePaths []string `yaml:"include_paths"`
-		ExcludePaths []string `yaml:"exclude_paths"`
+		AllowedIPs     []string `yaml:"allowed_ips"`     // 默认允许列表，IP 或 CIDR，规则未配置 allow 时使用
+		TrustedProxies []string `yaml:"trusted_proxies"` // 受信任的代理，仅来自这些地址的请求才读取 X-Forwarded-For、X-Real-IP
+		DenyIPs        []string `yaml:"deny_ips"`        // 禁止访问所有接口的 IP 或 CIDR，优先于允许列表
+		Rules          []IPRule `yaml:"rules"`           // 按路径限制访问来源，按顺序匹配第一条，未匹配的路径不限制
+		IncludePaths   []string `yaml:"include_paths"`   // 已废弃，未配置 rules 时兼容：不限制来源的路径
+		ExcludePaths   []string `yaml:"exclude_paths"`   // 已废弃，未配置 rules 时兼容：仅 allowed_ips 可访问的路径
 	} `yaml:"ip_whitelist"`
+
+	Auth struct {
+		Enabled         bool         `yaml:"enabled"`          // 是否启用客户端签名认证
+		TimestampWindow int          `yaml:"timestamp_window"` // 请求时间戳允许的偏差，单位秒，默认 300
+		IncludePaths    []string     `yaml:"include_paths"`    // 需要签名认证的路径，/* 结尾表示前缀匹配
+		Clients         []AuthClient `yaml:"clients"`          // 配置文件中的客户端，数据库中的客户端通过管理接口签发
+	} `yaml:"auth"`
+
+	RateLimit struct {
+		Enabled bool            `yaml:"enabled"` // 是否启用限流，计数存放在 Redis 中，多个实例共享；Redis 不可用时退化为单实例限流
+		Rules   []RateLimitRule `yaml:"rules"`   // 限流规则，同一维度命中多条规则时只取最具体的一条，不同维度的规则需全部满足
+	} `yaml:"rate_limit"`
+
+	Idempotency struct {
+		Enabled      bool     `yaml:"enabled"`       // 是否启用 Idempotency-Key 幂等请求
+		TTL          int      `yaml:"ttl"`           // 幂等键保留时长，单位小时，默认 24
+		IncludePaths []string `yaml:"include_paths"` // 支持幂等键的 POST 接口，/* 结尾表示前缀匹配
+	} `yaml:"idempotency"`
+
+	Admin struct {
+		JWTSecret  string `yaml:"jwt_secret"`  // 令牌签名密钥，非 dev 环境必填；dev 环境为空时启动时随机生成，重启后令牌失效
+		AccessTTL  int    `yaml:"access_ttl"`  // 访问令牌有效期，单位分钟，默认 30
+		RefreshTTL int    `yaml:"refresh_ttl"` // 刷新令牌有效期，单位小时，默认 168
+	} `yaml:"admin"`
+
+	Order struct {
+		TTL           int `yaml:"ttl"`            // 未支付订单有效期，单位分钟，0 表示永不过期
+		SweepInterval int `yaml:"sweep_interval"` // 过期订单扫描间隔，单位秒
+		QueryDelay    int `yaml:"query_delay"`    // 未支付超过该时长后主动向平台查单，单位分钟，0 表示不查单
+		QueryInterval int `yaml:"query_interval"` // 查单扫描间隔，单位秒
+	} `yaml:"order"`
+
+	Delivery struct {
+		Servers      map[string]DeliveryServer `yaml:"servers"`       // 按服务器标识配置发货地址
+		MaxAttempts  int                       `yaml:"max_attempts"`  // 最大投递次数
+		BaseDelay    int                       `yaml:"base_delay"`    // 首次重试间隔，单位秒，之后指数递增
+		MaxDelay     int                       `yaml:"max_delay"`     // 最大重试间隔，单位秒
+		PollInterval int                       `yaml:"poll_interval"` // 扫描待投递记录的间隔，单位秒
+		Timeout      int                       `yaml:"timeout"`       // 单次投递超时，单位秒
+	} `yaml:"delivery"`
+
+	Pay struct {
+		TimestampWindow int        `yaml:"timestamp_window"` // 回调时间戳允许的偏差，单位秒，0 表示不校验
+		Merchants       []Merchant `yaml:"merchants"`
+	} `yaml:"pay"`
+
+	Verification struct {
+		DefaultLimit int            `yaml:"default_limit"` // 每个用户每个商品允许验证的次数，0 表示不限
+		ItemLimits   map[string]int `yaml:"item_limits"`   // 按商品项单独配置的验证次数
+	} `yaml:"verification"`
+
+	Reconcile struct {
+		Dir         string `yaml:"dir"`          // 平台结算文件目录
+		FilePattern string `yaml:"file_pattern"` // 结算文件名，{date} 替换为对账日期（20060102），不含扩展名
+	} `yaml:"reconcile"`
+}
+
+// DeliveryServer 游戏服务器发货通知配置
+type DeliveryServer struct {
+	URL    string `yaml:"url"`
+	Secret string `yaml:"secret"` // 通知签名密钥，HMAC-SHA256
+}
+
+// AuthClient 调用客户端接口的应用
+type AuthClient struct {
+	AppKey string `yaml:"app_key"`
+	Secret string `yaml:"secret"`
+	Name   string `yaml:"name"`
+}
+
+// IPRule 按路径配置的来源限制
+type IPRule struct {
+	Path  string   `yaml:"path"`  // 请求路径，/* 结尾表示前缀匹配
+	Allow []string `yaml:"allow"` // 允许访问的 IP 或 CIDR，为空时使用 allowed_ips
+}
+
+// RateLimitRule 按路径配置的滑动窗口限流规则
+type RateLimitRule struct {
+	Path   string `yaml:"path"`   // 请求路径，/* 结尾表示前缀匹配，中间的 * 匹配一段路径
+	Method string `yaml:"method"` // 请求方法，为空表示全部
+	Key    string `yaml:"key"`    // 限流维度 ip、user_id、app_key，取不到 user_id 或 app_key 时按 ip
+	Limit  int    `yaml:"limit"`  // 窗口内允许的请求数
+	Window int    `yaml:"window"` // 窗口长度，单位秒，默认 60
+}
+
+// LogBodyRule 按路径配置的请求体、响应体记录方式
+type LogBodyRule struct {
+	Path        string `yaml:"path"`          // 请求路径，/* 结尾表示前缀匹配，中间的 * 匹配一段路径
+	Body        string `yaml:"body"`          // 记录方式 all、request、response、none，默认 all
+	MaxBodySize int    `yaml:"max_body_size"` // 覆盖 logging.max_body_size，0 表示沿用
+}
+
+// Merchant 支付平台商户配置
+type Merchant struct {
+	ID          string   `yaml:"id"`
+	Channel     string   `yaml:"channel"`      // 支付渠道 feizhu、tiktok，为空表示 feizhu
+	AppID       string   `yaml:"app_id"`       // 平台分配的应用ID
+	APIBase     string   `yaml:"api_base"`     // 平台接口地址，用于查单和退款
+	Secret      string   `yaml:"secret"`       // 签名密钥
+	SignTypes   []string `yaml:"sign_types"`   // 允许的签名类型，为空表示 MD5、HMAC-SHA256 都接受
+	ServerFlags []string `yaml:"server_flags"` // 该商户负责的服务器标识，为空表示默认商户
 }
 
 type Schema struct {
@@ -67,17 +187,105 @@ type SkuList struct {
 
 var AppConfig Config
 
-// LoadConfig 从 config.yaml 文件加载配置
+// LoadConfig 从 config.yaml 文件加载配置，配置无效时退出
 func LoadConfig() {
-	data, err := ioutil.ReadFile("config.yaml")
+	cfg, err := Load(ConfigFile)
 	if err != nil {
-		log.Fatalf("Failed to read config file: %v", err)
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	AppConfig = *cfg
+	SetCurrent(cfg)
+}
+
+// SetCurrent 替换当前配置快照，启动时及测试中使用
+func SetCurrent(cfg *Config) {
+	current.Store(cfg)
+}
+
+// FindMerchant 根据支付渠道和服务器标识查找商户，未匹配时返回该渠道的默认商户
+func FindMerchant(channel, serverFlag string) (*Merchant, bool) {
+	var fallback *Merchant
+	for i := range AppConfig.Pay.Merchants {
+		m := &AppConfig.Pay.Merchants[i]
+		if m.ChannelName() != channel {
+			continue
+		}
+		if len(m.ServerFlags) == 0 {
+			if fallback == nil {
+				fallback = m
+			}
+			continue
+		}
+		for _, flag := range m.ServerFlags {
+			if flag == serverFlag {
+				return m, true
+			}
+		}
 	}
+	return fallback, fallback != nil
+}
 
-	err = yaml.Unmarshal(data, &AppConfig)
-	if err != nil {
-		log.Fatalf("Failed to parse config file: %v", err)
+// KnownServerFlag 服务器标识是否出现在发货地址或商户配置中
+func KnownServerFlag(serverFlag string) bool {
+	if _, ok := AppConfig.Delivery.Servers[serverFlag]; ok {
+		return true
+	}
+	for _, m := range AppConfig.Pay.Merchants {
+		if slices.Contains(m.ServerFlags, serverFlag) {
+			return true
+		}
+	}
+	return false
+}
+
+// ChannelName 商户所属支付渠道，未配置时为 feizhu
+func (m *Merchant) ChannelName() string {
+	if m.Channel == "" {
+		return "feizhu"
+	}
+	return m.Channel
+}
+
+// AllowsSignType 判断商户是否接受该签名类型
+func (m *Merchant) AllowsSignType(signType string) bool {
+	if len(m.SignTypes) == 0 {
+		return true
+	}
+	for _, t := range m.SignTypes {
+		if strings.EqualFold(t, signType) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDev 是否为开发环境
+func (c *Config) IsDev() bool {
+	return c.App.Env == "dev"
+}
+
+// OrderTTL 未支付订单有效期，0 表示永不过期
+func OrderTTL() time.Duration {
+	return time.Duration(AppConfig.Order.TTL) * time.Minute
+}
+
+// FindAuthClient 按 app key 查找配置文件中的客户端，支持热加载
+func FindAuthClient(appKey string) (*AuthClient, bool) {
+	clients := Current().Auth.Clients
+	for i := range clients {
+		if clients[i].AppKey == appKey {
+			return &clients[i], true
+		}
+	}
+	return nil, false
+}
+
+// VerificationLimit 商品项的验证次数上限，0 表示不限
+func VerificationLimit(item string) int {
+	if limit, ok := AppConfig.Verification.ItemLimits[item]; ok {
+		return limit
 	}
+	return AppConfig.Verification.DefaultLimit
 }
 
 // GetDBConnectionString 获取数据库连接字符串
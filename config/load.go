@@ -0,0 +1,295 @@
+package conf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigFile 配置文件路径
+const ConfigFile = "config.yaml"
+
+// envPrefix 环境变量覆盖前缀，按 yaml 字段逐级拼接，如 APIPAY_DATABASE_PASSWORD
+const envPrefix = "APIPAY"
+
+// current 当前生效的配置快照，热加载时整体替换
+var current atomic.Pointer[Config]
+
+func init() {
+	current.Store(&Config{})
+}
+
+// Current 返回当前配置快照，按请求读取的中间件应使用它而不是 AppConfig。
+// 快照只读，不能修改。
+func Current() *Config {
+	return current.Load()
+}
+
+// Load 读取配置文件，应用环境变量覆盖并校验
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse config file: %w", err)
+	}
+	if err := applyEnv(reflect.ValueOf(&cfg).Elem(), envPrefix); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// applyEnv 用环境变量覆盖字符串、数字、布尔和字符串列表（逗号分隔）字段
+func applyEnv(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + "_" + strings.ToUpper(name)
+		field := v.Field(i)
+
+		if field.Kind() == reflect.Struct {
+			if err := applyEnv(field, key); err != nil {
+				return err
+			}
+			continue
+		}
+		value, ok := os.LookupEnv(key)
+		if !ok {
+			continue
+		}
+
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Int:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("env %s: invalid integer %q", key, value)
+			}
+			field.SetInt(int64(n))
+		case reflect.Float64:
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("env %s: invalid number %q", key, value)
+			}
+			field.SetFloat(f)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("env %s: invalid boolean %q", key, value)
+			}
+			field.SetBool(b)
+		case reflect.Slice:
+			if field.Type().Elem().Kind() != reflect.String {
+				continue
+			}
+			var items []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			field.Set(reflect.ValueOf(items))
+		}
+	}
+	return nil
+}
+
+// Validate 校验配置，返回全部错误
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	switch c.App.Env {
+	case "", "dev", "prod":
+	default:
+		errs = append(errs, fmt.Errorf("app.env: unknown env %q", c.App.Env))
+	}
+	// 随机生成的密钥在重启后失效，多实例之间也不一致
+	check(c.IsDev() || c.Admin.JWTSecret != "", "admin.jwt_secret is required unless app.env is dev")
+
+	check(validPort(c.Port), "port: invalid port %d", c.Port)
+	check(c.PortBackup == 0 || validPort(c.PortBackup), "port_backup: invalid port %d", c.PortBackup)
+	check(c.PortBackup == 0 || c.PortBackup != c.Port, "port_backup: must differ from port %d", c.Port)
+
+	check(c.Database.Host != "", "database.host is required")
+	check(c.Database.User != "", "database.user is required")
+	check(c.Database.DBName != "", "database.dbname is required")
+	check(validPort(c.Database.Port), "database.port: invalid port %d", c.Database.Port)
+
+	checkIPs := func(field string, ips []string) {
+		for _, ip := range ips {
+			check(validIPOrCIDR(ip), "%s: malformed IP or CIDR %q", field, ip)
+		}
+	}
+	checkIPs("ip_whitelist.allowed_ips", c.IPWhitelist.AllowedIPs)
+	checkIPs("ip_whitelist.trusted_proxies", c.IPWhitelist.TrustedProxies)
+	checkIPs("ip_whitelist.deny_ips", c.IPWhitelist.DenyIPs)
+	for i, rule := range c.IPWhitelist.Rules {
+		check(rule.Path != "", "ip_whitelist.rules[%d]: path is required", i)
+		checkIPs(fmt.Sprintf("ip_whitelist.rules[%d].allow", i), rule.Allow)
+	}
+
+	for i, rule := range c.RateLimit.Rules {
+		check(rule.Path != "", "rate_limit.rules[%d]: path is required", i)
+		check(rule.Limit > 0, "rate_limit.rules[%d]: limit must be positive", i)
+		check(rule.Window >= 0, "rate_limit.rules[%d]: window must not be negative", i)
+		switch rule.Key {
+		case "", "ip", "user_id", "app_key":
+		default:
+			errs = append(errs, fmt.Errorf("rate_limit.rules[%d]: unknown key %q", i, rule.Key))
+		}
+	}
+
+	check(c.Logging.MaxBodySize >= -1, "logging.max_body_size: must be -1 or greater")
+	for i, rule := range c.Logging.BodyRules {
+		check(rule.Path != "", "logging.body_rules[%d]: path is required", i)
+		check(rule.MaxBodySize >= -1, "logging.body_rules[%d]: max_body_size must be -1 or greater", i)
+		switch rule.Body {
+		case "", "all", "request", "response", "none":
+		default:
+			errs = append(errs, fmt.Errorf("logging.body_rules[%d]: unknown body %q", i, rule.Body))
+		}
+	}
+
+	switch c.Tracing.Exporter {
+	case "", "none", "otlp", "file":
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter: unknown exporter %q", c.Tracing.Exporter))
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio: must be between 0 and 1")
+
+	for i, client := range c.Auth.Clients {
+		check(client.AppKey != "" && client.Secret != "", "auth.clients[%d]: app_key and secret are required", i)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+func validIPOrCIDR(s string) bool {
+	_, err := ParsePrefix(s)
+	return err == nil
+}
+
+// ParsePrefix 解析 IP 或 CIDR，单个 IP 视为 /32 或 /128，IPv4 映射的 IPv6 地址按 IPv4 处理
+func ParsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		if addr := prefix.Addr(); addr.Is4In6() && prefix.Bits() >= 96 {
+			return netip.PrefixFrom(addr.Unmap(), prefix.Bits()-96), nil
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap().WithZone("")
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// copyReloadable 将可热加载的配置段从 src 复制到 dst，
+// 数据库、Redis、端口、商户等其他配置需重启生效
+func copyReloadable(dst, src *Config) {
+	dst.IPWhitelist = src.IPWhitelist
+	dst.Cors = src.Cors
+	dst.Logging = src.Logging
+	dst.Auth = src.Auth
+	dst.RateLimit = src.RateLimit
+	dst.Idempotency = src.Idempotency
+}
+
+// Reload 重新读取配置文件，校验通过后替换可热加载的配置段。
+// 其他配置段有变化时返回 restart 为 true，提示需要重启生效。
+func Reload(path string) (restart bool, err error) {
+	next, err := Load(path)
+	if err != nil {
+		return false, err
+	}
+
+	cur := Current()
+	merged := *cur
+	copyReloadable(&merged, next)
+
+	compare := *next
+	copyReloadable(&compare, cur)
+	restart = !reflect.DeepEqual(compare, *cur)
+
+	current.Store(&merged)
+	return restart, nil
+}
+
+// Watch 定期检查配置文件，修改后自动热加载，加载失败时保留当前配置
+func Watch(ctx context.Context, path string, interval time.Duration) {
+	modTime := func() time.Time {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+	last := modTime()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if mt := modTime(); !mt.IsZero() && !mt.Equal(last) {
+					last = mt
+					ReloadAndLog(path)
+				}
+			}
+		}
+	}()
+}
+
+// ReloadAndLog 热加载配置并记录结果
+func ReloadAndLog(path string) {
+	restart, err := Reload(path)
+	switch {
+	case err != nil:
+		log.Printf("Config reload failed, keeping current config: %v", err)
+	case restart:
+		log.Printf("Config reloaded; changes outside ip_whitelist, cors, logging, auth, rate_limit and idempotency require a restart")
+	default:
+		log.Printf("Config reloaded")
+	}
+}
@@ -0,0 +1,205 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// validConfig 通过校验的最小配置
+func validConfig() *Config {
+	cfg := &Config{Port: 8080}
+	cfg.Database.Host = "localhost"
+	cfg.Database.User = "root"
+	cfg.Database.DBName = "pay"
+	cfg.Database.Port = 3306
+	cfg.Admin.JWTSecret = "secret"
+	return cfg
+}
+
+func TestValidateJWTSecret(t *testing.T) {
+	tests := []struct {
+		env, secret string
+		wantErr     string
+	}{
+		{"", "secret", ""},
+		{"prod", "secret", ""},
+		{"dev", "", ""},
+		{"", "", "admin.jwt_secret is required"},
+		{"prod", "", "admin.jwt_secret is required"},
+		{"staging", "secret", "app.env: unknown env"},
+	}
+	for _, tt := range tests {
+		cfg := validConfig()
+		cfg.App.Env = tt.env
+		cfg.Admin.JWTSecret = tt.secret
+		err := cfg.Validate()
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("env %q secret %q: unexpected error %v", tt.env, tt.secret, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("env %q secret %q: error = %v, want %q", tt.env, tt.secret, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		edit    func(*Config)
+		wantErr []string
+	}{
+		{name: "valid", edit: func(c *Config) {}},
+		{name: "ports", edit: func(c *Config) { c.Port = 70000; c.PortBackup = 70000 }, wantErr: []string{"port: invalid port 70000", "port_backup: invalid port 70000", "port_backup: must differ"}},
+		{name: "database", edit: func(c *Config) { c.Database.Host = ""; c.Database.Port = 0 }, wantErr: []string{"database.host is required", "database.port: invalid port 0"}},
+		{name: "ipv6 cidr", edit: func(c *Config) { c.IPWhitelist.AllowedIPs = []string{"10.0.0.0/8", "2001:db8::/32", "::ffff:10.0.0.1"} }},
+		{name: "malformed ip", edit: func(c *Config) {
+			c.IPWhitelist.TrustedProxies = []string{"10.0.0.300"}
+			c.IPWhitelist.Rules = []IPRule{{Allow: []string{"10.0.0.0/33"}}}
+		}, wantErr: []string{`ip_whitelist.trusted_proxies: malformed IP or CIDR "10.0.0.300"`, "ip_whitelist.rules[0]: path is required", `ip_whitelist.rules[0].allow: malformed IP or CIDR "10.0.0.0/33"`}},
+		{name: "rate limit", edit: func(c *Config) {
+			c.RateLimit.Rules = []RateLimitRule{{Path: "/api/*", Key: "device"}}
+		}, wantErr: []string{"rate_limit.rules[0]: limit must be positive", `rate_limit.rules[0]: unknown key "device"`}},
+		{name: "logging", edit: func(c *Config) {
+			c.Logging.MaxBodySize = -2
+			c.Logging.BodyRules = []LogBodyRule{{Path: "/api/*", Body: "headers"}}
+		}, wantErr: []string{"logging.max_body_size", `logging.body_rules[0]: unknown body "headers"`}},
+		{name: "tracing", edit: func(c *Config) { c.Tracing.Exporter = "jaeger"; c.Tracing.SampleRatio = 2 }, wantErr: []string{`unknown exporter "jaeger"`, "tracing.sample_ratio"}},
+		{name: "auth client", edit: func(c *Config) { c.Auth.Clients = []AuthClient{{AppKey: "k1"}} }, wantErr: []string{"auth.clients[0]: app_key and secret are required"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.edit(cfg)
+			err := cfg.Validate()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("invalid config accepted")
+			}
+			// 一次返回全部错误
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+// writeConfig 写入临时配置文件并返回路径
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testConfigYAML = `
+port: 8080
+database:
+  host: localhost
+  user: root
+  dbname: pay
+  port: 3306
+admin:
+  jwt_secret: secret
+ip_whitelist:
+  allowed_ips: ["127.0.0.1"]
+`
+
+func TestLoadEnvOverrides(t *testing.T) {
+	path := writeConfig(t, testConfigYAML)
+	t.Setenv("APIPAY_PORT", "9090")
+	t.Setenv("APIPAY_DATABASE_PASSWORD", "from-env")
+	t.Setenv("APIPAY_APP_PREFORK", "true")
+	t.Setenv("APIPAY_TRACING_SAMPLE_RATIO", "0.5")
+	t.Setenv("APIPAY_IP_WHITELIST_ALLOWED_IPS", "10.0.0.0/8, ,192.168.1.1")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != 9090 || cfg.Database.Password != "from-env" || !cfg.App.Prefork || cfg.Tracing.SampleRatio != 0.5 {
+		t.Errorf("overrides not applied: port %d, password %q, prefork %v, ratio %v",
+			cfg.Port, cfg.Database.Password, cfg.App.Prefork, cfg.Tracing.SampleRatio)
+	}
+	if want := []string{"10.0.0.0/8", "192.168.1.1"}; !slices.Equal(cfg.IPWhitelist.AllowedIPs, want) {
+		t.Errorf("allowed_ips = %v, want %v", cfg.IPWhitelist.AllowedIPs, want)
+	}
+	// 未设置环境变量的字段保留文件中的值
+	if cfg.Database.Host != "localhost" {
+		t.Errorf("database.host = %q", cfg.Database.Host)
+	}
+}
+
+func TestLoadEnvInvalid(t *testing.T) {
+	tests := []struct {
+		key, value, wantErr string
+	}{
+		{"APIPAY_PORT", "eighty", `env APIPAY_PORT: invalid integer "eighty"`},
+		{"APIPAY_APP_PREFORK", "maybe", `env APIPAY_APP_PREFORK: invalid boolean "maybe"`},
+		{"APIPAY_TRACING_SAMPLE_RATIO", "half", `env APIPAY_TRACING_SAMPLE_RATIO: invalid number "half"`},
+		// 覆盖后的值同样需要通过校验
+		{"APIPAY_DATABASE_PORT", "0", "database.port: invalid port 0"},
+	}
+	path := writeConfig(t, testConfigYAML)
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			if _, err := Load(path); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	saved := Current()
+	t.Cleanup(func() { SetCurrent(saved) })
+
+	tests := []struct {
+		name        string
+		content     string
+		wantErr     bool
+		wantRestart bool
+		wantIPs     []string
+		wantPort    int
+	}{
+		{name: "unchanged", content: testConfigYAML, wantIPs: []string{"127.0.0.1"}, wantPort: 8080},
+		{name: "hot section", content: strings.Replace(testConfigYAML, "127.0.0.1", "10.0.0.1", 1), wantIPs: []string{"10.0.0.1"}, wantPort: 8080},
+		// 需重启的配置不生效，热加载配置段仍然生效
+		{name: "restart section", content: strings.Replace(strings.Replace(testConfigYAML, "port: 8080", "port: 9090", 1), "127.0.0.1", "10.0.0.1", 1), wantRestart: true, wantIPs: []string{"10.0.0.1"}, wantPort: 8080},
+		{name: "invalid", content: strings.Replace(testConfigYAML, "127.0.0.1", "bad-ip", 1), wantErr: true, wantIPs: []string{"127.0.0.1"}, wantPort: 8080},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initial, err := Load(writeConfig(t, testConfigYAML))
+			if err != nil {
+				t.Fatal(err)
+			}
+			SetCurrent(initial)
+
+			restart, err := Reload(writeConfig(t, tt.content))
+			if (err != nil) != tt.wantErr || restart != tt.wantRestart {
+				t.Fatalf("Reload = %v, %v, want restart %v, error %v", restart, err, tt.wantRestart, tt.wantErr)
+			}
+			cur := Current()
+			if !slices.Equal(cur.IPWhitelist.AllowedIPs, tt.wantIPs) || cur.Port != tt.wantPort {
+				t.Errorf("current = %v port %d, want %v port %d", cur.IPWhitelist.AllowedIPs, cur.Port, tt.wantIPs, tt.wantPort)
+			}
+			// 热加载替换快照，不修改旧快照
+			if initial.IPWhitelist.AllowedIPs[0] != "127.0.0.1" {
+				t.Error("previous snapshot modified")
+			}
+		})
+	}
+}
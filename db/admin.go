@@ -0,0 +1,88 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAdminNotFound   = errors.New("admin user not found")
+	ErrAdminDuplicated = errors.New("admin username already exists")
+)
+
+// AdminUser 管理后台用户，密码使用 bcrypt 存储
+type AdminUser struct {
+	ID           uint       `gorm:"primaryKey;comment:主键ID"`                                          // 主键ID
+	Username     string     `gorm:"size:64;not null;uniqueIndex;comment:用户名"`                         // 用户名
+	PasswordHash string     `gorm:"size:255;not null;comment:密码哈希"`                                   // 密码哈希
+	Role         string     `gorm:"size:32;not null;default:viewer;comment:角色 viewer operator admin"` // 角色
+	Disabled     bool       `gorm:"not null;default:false;comment:是否停用"`                              // 是否停用
+	TokenVersion int        `gorm:"not null;default:0;comment:令牌版本，递增后已签发的令牌失效"`                      // 令牌版本
+	LastLoginAt  *time.Time `gorm:"comment:最后登录时间"`                                                   // 最后登录时间
+	CreatedAt    time.Time  `gorm:"autoCreateTime;comment:创建时间"`                                      // 创建时间
+	UpdatedAt    time.Time  `gorm:"autoUpdateTime;comment:更新时间"`                                      // 更新时间
+}
+
+// CreateAdminUser 创建管理员
+func CreateAdminUser(user *AdminUser) error {
+	err := DB.Create(user).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrAdminDuplicated
+	}
+	return err
+}
+
+// GetAdminUser 按ID查询管理员
+func GetAdminUser(id uint) (*AdminUser, error) {
+	var user AdminUser
+	err := DB.First(&user, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAdminNotFound
+	}
+	return &user, err
+}
+
+// GetAdminUserByUsername 按用户名查询管理员
+func GetAdminUserByUsername(username string) (*AdminUser, error) {
+	var user AdminUser
+	err := DB.Where("username = ?", username).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAdminNotFound
+	}
+	return &user, err
+}
+
+// ListAdminUsers 查询全部管理员
+func ListAdminUsers() ([]AdminUser, error) {
+	var users []AdminUser
+	err := DB.Order("id").Find(&users).Error
+	return users, err
+}
+
+// UpdateAdminUser 更新管理员，修改密码、角色或停用时递增令牌版本使已签发的令牌失效
+func UpdateAdminUser(id uint, changes map[string]interface{}) (*AdminUser, error) {
+	if len(changes) > 0 {
+		changes["token_version"] = gorm.Expr("token_version + 1")
+		result := DB.Model(&AdminUser{}).Where("id = ?", id).Updates(changes)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil, ErrAdminNotFound
+		}
+	}
+	return GetAdminUser(id)
+}
+
+// RecordAdminLogin 记录登录时间
+func RecordAdminLogin(id uint) error {
+	return DB.Model(&AdminUser{}).Where("id = ?", id).Update("last_login_at", time.Now()).Error
+}
+
+// RevokeAdminTokens 递增令牌版本，使已签发的令牌失效
+func RevokeAdminTokens(id uint) error {
+	return DB.Model(&AdminUser{}).Where("id = ?", id).
+		Update("token_version", gorm.Expr("token_version + 1")).Error
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrClientNotFound   = errors.New("api client not found")
+	ErrClientDuplicated = errors.New("api client app key already exists")
+)
+
+// ApiClient 通过管理接口签发的客户端，签名使用 Secret
+type ApiClient struct {
+	ID        uint      `gorm:"primaryKey;comment:主键ID"`                   // 主键ID
+	AppKey    string    `gorm:"size:64;not null;uniqueIndex;comment:应用标识"` // 应用标识
+	Secret    string    `gorm:"size:128;not null;comment:签名密钥"`            // 签名密钥
+	Name      string    `gorm:"size:255;comment:客户端名称"`                    // 客户端名称
+	Disabled  bool      `gorm:"not null;default:false;comment:是否停用"`       // 是否停用
+	CreatedAt time.Time `gorm:"autoCreateTime;comment:创建时间"`               // 创建时间
+	UpdatedAt time.Time `gorm:"autoUpdateTime;comment:更新时间"`               // 更新时间
+}
+
+// GetApiClient 按 app key 查询启用中的客户端
+func GetApiClient(appKey string) (*ApiClient, error) {
+	var client ApiClient
+	err := DB.Where("app_key = ? AND disabled = ?", appKey, false).First(&client).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrClientNotFound
+	}
+	return &client, err
+}
+
+// CreateApiClient 保存新签发的客户端
+func CreateApiClient(client *ApiClient) error {
+	err := DB.Create(client).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrClientDuplicated
+	}
+	return err
+}
+
+// ListApiClients 查询全部客户端
+func ListApiClients() ([]ApiClient, error) {
+	var clients []ApiClient
+	err := DB.Order("id").Find(&clients).Error
+	return clients, err
+}
+
+// SetApiClientDisabled 启用或停用客户端
+func SetApiClientDisabled(appKey string, disabled bool) error {
+	result := DB.Model(&ApiClient{}).Where("app_key = ?", appKey).Update("disabled", disabled)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrClientNotFound
+	}
+	return nil
+}
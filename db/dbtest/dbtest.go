@@ -0,0 +1,69 @@
+// Package dbtest 为测试提供内存 SQLite 数据库和 miniredis，替换 db.DB、db.RedisClient。
+// SQLite 不支持 FOR UPDATE，行锁相关的并发行为需在 MySQL 上验证。
+package dbtest
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"api-pay/db"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var seq atomic.Int64
+
+// Open 创建独立的内存数据库并赋值给 db.DB，测试结束后恢复原值
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	dsn := fmt.Sprintf("file:%s_%d?mode=memory&cache=shared", name, seq.Add(1))
+	conn, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 单连接避免 SQLite 写锁冲突，同时保持内存库在测试期间不被释放
+	sqlDB.SetMaxOpenConns(1)
+
+	if err := conn.AutoMigrate(db.Models()...); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := db.DB
+	db.DB = conn
+	t.Cleanup(func() {
+		db.DB = saved
+		sqlDB.Close()
+	})
+	return conn
+}
+
+// Redis 启动 miniredis 并赋值给 db.RedisClient，测试结束后恢复原值
+func Redis(t testing.TB) *miniredis.Miniredis {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+
+	saved := db.RedisClient
+	db.RedisClient = client
+	t.Cleanup(func() {
+		db.RedisClient = saved
+		client.Close()
+	})
+	return server
+}
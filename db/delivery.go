@@ -0,0 +1,213 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"api-pay/orderstate"
+
+	"gorm.io/gorm"
+)
+
+// 发货投递状态
+const (
+	DeliveryPending = "pending"
+	DeliverySuccess = "success"
+	DeliveryFailed  = "failed"
+)
+
+var (
+	ErrDeliveryNotAllowed   = errors.New("order is not deliverable")
+	ErrDeliveryInProgress   = errors.New("delivery is leased by a worker")
+	ErrDeliveryLeaseExpired = errors.New("delivery lease expired or was reset")
+)
+
+// GameOrderDelivery 发货通知发件箱，支付成功时与订单在同一事务中写入
+type GameOrderDelivery struct {
+	ID            uint       `gorm:"primaryKey;comment:主键ID"`                                            // 主键ID
+	GameOrderNo   string     `gorm:"size:255;uniqueIndex;comment:游戏订单号"`                                 // 游戏订单号
+	ServerFlag    string     `gorm:"size:100;comment:服务器标识"`                                             // 服务器标识
+	Status        string     `gorm:"size:20;index:idx_delivery_due;comment:投递状态 pending success failed"` // 投递状态
+	Attempts      int        `gorm:"not null;default:0;comment:已投递次数"`                                   // 已投递次数
+	NextAttemptAt time.Time  `gorm:"index:idx_delivery_due;comment:下次投递时间"`                              // 下次投递时间
+	LockedUntil   *time.Time `gorm:"comment:投递锁定截止时间"`                                                   // 投递锁定截止时间
+	LastError     string     `gorm:"size:500;comment:最近一次失败原因"`                                          // 最近一次失败原因
+	DeliveredAt   *time.Time `gorm:"comment:发货成功时间"`                                                     // 发货成功时间
+	CreatedAt     time.Time  `gorm:"autoCreateTime;comment:创建时间"`                                        // 创建时间
+	UpdatedAt     time.Time  `gorm:"autoUpdateTime;comment:更新时间"`                                        // 更新时间
+}
+
+// enqueueDelivery 在事务中写入待投递记录
+func enqueueDelivery(tx *gorm.DB, order *GameOrder) error {
+	delivery := GameOrderDelivery{
+		GameOrderNo:   order.Order,
+		ServerFlag:    order.ServerFlag,
+		Status:        DeliveryPending,
+		NextAttemptAt: time.Now(),
+	}
+	return tx.Create(&delivery).Error
+}
+
+// ClaimDueDeliveries 领取到期的待投递记录，每条记录通过条件更新加租约，多实例不会重复领取
+func ClaimDueDeliveries(limit int, lease time.Duration) ([]GameOrderDelivery, error) {
+	now := time.Now()
+	var candidates []GameOrderDelivery
+	if err := DB.Where("status = ? AND next_attempt_at <= ?", DeliveryPending, now).
+		Where("locked_until IS NULL OR locked_until < ?", now).
+		Order("next_attempt_at").Limit(limit).Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	claimed := make([]GameOrderDelivery, 0, len(candidates))
+	for i := range candidates {
+		ok, err := ClaimDelivery(&candidates[i], lease)
+		if err != nil {
+			return claimed, err
+		}
+		if ok {
+			claimed = append(claimed, candidates[i])
+		}
+	}
+	return claimed, nil
+}
+
+// ClaimDelivery 为单条待投递记录加租约，租约期内其他实例不会领取。
+// 领取到的 locked_until 同时作为租约凭证，记录投递结果时据此确认租约仍然有效。
+func ClaimDelivery(delivery *GameOrderDelivery, lease time.Duration) (bool, error) {
+	now := time.Now()
+	// 截断到秒，避免数据库时间精度不同导致凭证比较不相等
+	lockedUntil := now.Add(lease).Truncate(time.Second)
+	result := DB.Model(&GameOrderDelivery{}).
+		Where("id = ? AND status = ? AND (locked_until IS NULL OR locked_until < ?)", delivery.ID, DeliveryPending, now).
+		Update("locked_until", &lockedUntil)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected != 1 {
+		return false, nil
+	}
+	delivery.LockedUntil = &lockedUntil
+	return true, nil
+}
+
+// MarkDeliverySuccess 记录投递成功并将订单置为已发货
+func MarkDeliverySuccess(delivery *GameOrderDelivery, meta orderstate.Meta) error {
+	return withMeta(meta).Transaction(func(tx *gorm.DB) error {
+		order, err := lockOrder(tx, "`order` = ?", delivery.GameOrderNo)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := updateLeased(tx, delivery, map[string]interface{}{
+			"status":       DeliverySuccess,
+			"attempts":     gorm.Expr("attempts + 1"),
+			"locked_until": nil,
+			"last_error":   "",
+			"delivered_at": &now,
+		}); err != nil {
+			return err
+		}
+
+		// 投递期间订单可能已被退款，此时只记录投递结果
+		if !orderstate.CanTransition(order.OrderStatus, orderstate.Delivered) {
+			return nil
+		}
+		return TransitionOrder(tx, order, orderstate.Delivered, meta, nil)
+	})
+}
+
+// MarkDeliveryFailure 记录投递失败；未超过最大次数时在 nextAttempt 重试，否则将订单置为发货失败
+func MarkDeliveryFailure(delivery *GameOrderDelivery, reason string, maxAttempts int, nextAttempt time.Time, meta orderstate.Meta) error {
+	if len(reason) > 500 {
+		reason = reason[:500]
+	}
+
+	return withMeta(meta).Transaction(func(tx *gorm.DB) error {
+		order, err := lockOrder(tx, "`order` = ?", delivery.GameOrderNo)
+		if err != nil {
+			return err
+		}
+
+		attempts := delivery.Attempts + 1
+		updates := map[string]interface{}{
+			"attempts":        attempts,
+			"locked_until":    nil,
+			"last_error":      reason,
+			"next_attempt_at": nextAttempt,
+		}
+		exhausted := attempts >= maxAttempts
+		if exhausted {
+			updates["status"] = DeliveryFailed
+		}
+		if err := updateLeased(tx, delivery, updates); err != nil {
+			return err
+		}
+
+		if !exhausted || !orderstate.CanTransition(order.OrderStatus, orderstate.DeliveryFailed) {
+			return nil
+		}
+		return TransitionOrder(tx, order, orderstate.DeliveryFailed, meta, nil)
+	})
+}
+
+// updateLeased 仅在记录仍由 delivery 领取的租约持有时更新，
+// 租约已过期被其他实例重新领取或被重置时返回 ErrDeliveryLeaseExpired
+func updateLeased(tx *gorm.DB, delivery *GameOrderDelivery, updates map[string]interface{}) error {
+	if delivery.LockedUntil == nil {
+		return ErrDeliveryLeaseExpired
+	}
+	result := tx.Model(&GameOrderDelivery{}).
+		Where("id = ? AND locked_until = ?", delivery.ID, *delivery.LockedUntil).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDeliveryLeaseExpired
+	}
+	return nil
+}
+
+// ResetDelivery 重新投递订单的发货通知，发件箱中没有记录时补建一条。
+// 记录正被投递任务持有时返回 ErrDeliveryInProgress。
+func ResetDelivery(orderNo string) (*GameOrderDelivery, error) {
+	var delivery GameOrderDelivery
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		order, err := lockOrder(tx, "`order` = ?", orderNo)
+		if err != nil {
+			return err
+		}
+		if order.OrderStatus != orderstate.Paid && order.OrderStatus != orderstate.Delivered &&
+			order.OrderStatus != orderstate.DeliveryFailed {
+			return ErrDeliveryNotAllowed
+		}
+
+		result := tx.Where("game_order_no = ?", orderNo).Limit(1).Find(&delivery)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			if err := enqueueDelivery(tx, order); err != nil {
+				return err
+			}
+			return tx.Where("game_order_no = ?", orderNo).First(&delivery).Error
+		}
+
+		now := time.Now()
+		if delivery.LockedUntil != nil && delivery.LockedUntil.After(now) {
+			return ErrDeliveryInProgress
+		}
+		delivery.Status = DeliveryPending
+		delivery.Attempts = 0
+		delivery.NextAttemptAt = now
+		delivery.LockedUntil = nil
+		return tx.Model(&delivery).Updates(map[string]interface{}{
+			"status":          DeliveryPending,
+			"attempts":        0,
+			"next_attempt_at": now,
+			"locked_until":    nil,
+		}).Error
+	})
+	return &delivery, err
+}
@@ -0,0 +1,162 @@
+package db_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"api-pay/db"
+	"api-pay/db/dbtest"
+	"api-pay/orderstate"
+)
+
+// paidDelivery 创建已支付订单，返回支付时写入的待投递记录
+func paidDelivery(t *testing.T, orderNo string) *db.GameOrderDelivery {
+	t.Helper()
+	createOrder(t, orderNo, 1000)
+	payOrder(t, orderNo, "feizhu", 1000)
+	d, err := db.GetOrderDelivery(orderNo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func claim(t *testing.T, d *db.GameOrderDelivery, lease time.Duration) bool {
+	t.Helper()
+	ok, err := db.ClaimDelivery(d, lease)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ok
+}
+
+func TestClaimDeliveryExclusive(t *testing.T) {
+	dbtest.Open(t)
+	d := paidDelivery(t, "811-1")
+
+	if !claim(t, d, time.Minute) {
+		t.Fatal("first claim failed")
+	}
+	other := *d
+	if claim(t, &other, time.Minute) {
+		t.Fatal("second claim succeeded while leased")
+	}
+	claimed, err := db.ClaimDueDeliveries(10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 0 {
+		t.Fatalf("ClaimDueDeliveries returned %d leased records", len(claimed))
+	}
+}
+
+func TestMarkDelivery(t *testing.T) {
+	tests := []struct {
+		name        string
+		success     bool
+		attempts    int // 投递前已失败的次数
+		wantStatus  string
+		wantOrder   orderstate.State
+		wantAttempt int
+	}{
+		{name: "success", success: true, wantStatus: db.DeliverySuccess, wantOrder: orderstate.Delivered, wantAttempt: 1},
+		{name: "retry", wantStatus: db.DeliveryPending, wantOrder: orderstate.Paid, wantAttempt: 1},
+		{name: "exhausted", attempts: 2, wantStatus: db.DeliveryFailed, wantOrder: orderstate.DeliveryFailed, wantAttempt: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbtest.Open(t)
+			d := paidDelivery(t, "811-1")
+			d.Attempts = tt.attempts
+			if !claim(t, d, time.Minute) {
+				t.Fatal("claim failed")
+			}
+
+			next := time.Now().Add(time.Minute)
+			var err error
+			if tt.success {
+				err = db.MarkDeliverySuccess(d, testMeta)
+			} else {
+				err = db.MarkDeliveryFailure(d, "timeout", 3, next, testMeta)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := db.GetOrderDelivery("811-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != tt.wantStatus || got.Attempts != tt.wantAttempt || got.LockedUntil != nil {
+				t.Errorf("delivery = %s/%d/%v, want %s/%d/<nil>", got.Status, got.Attempts, got.LockedUntil, tt.wantStatus, tt.wantAttempt)
+			}
+			if !tt.success && !got.NextAttemptAt.Equal(next) {
+				t.Errorf("next attempt = %v, want %v", got.NextAttemptAt, next)
+			}
+			if status := orderStatus(t, "811-1"); status != tt.wantOrder {
+				t.Errorf("order status = %s, want %s", status, tt.wantOrder)
+			}
+		})
+	}
+}
+
+func TestMarkDeliveryLeaseLost(t *testing.T) {
+	dbtest.Open(t)
+	d := paidDelivery(t, "811-1")
+	if !claim(t, d, -time.Minute) {
+		t.Fatal("claim failed")
+	}
+
+	// 租约过期后被其他实例重新领取，原持有者不能再记录结果
+	other := *d
+	if !claim(t, &other, time.Minute) {
+		t.Fatal("reclaim of expired lease failed")
+	}
+	if err := db.MarkDeliverySuccess(d, testMeta); !errors.Is(err, db.ErrDeliveryLeaseExpired) {
+		t.Fatalf("MarkDeliverySuccess = %v, want ErrDeliveryLeaseExpired", err)
+	}
+	if err := db.MarkDeliveryFailure(d, "timeout", 1, time.Now(), testMeta); !errors.Is(err, db.ErrDeliveryLeaseExpired) {
+		t.Fatalf("MarkDeliveryFailure = %v, want ErrDeliveryLeaseExpired", err)
+	}
+	if status := orderStatus(t, "811-1"); status != orderstate.Paid {
+		t.Fatalf("order status = %s, want paid", status)
+	}
+
+	if err := db.MarkDeliverySuccess(&other, testMeta); err != nil {
+		t.Fatalf("current holder MarkDeliverySuccess = %v", err)
+	}
+}
+
+func TestResetDelivery(t *testing.T) {
+	dbtest.Open(t)
+	d := paidDelivery(t, "811-1")
+	if !claim(t, d, time.Minute) {
+		t.Fatal("claim failed")
+	}
+
+	// 投递任务持有租约时不能重置
+	if _, err := db.ResetDelivery("811-1"); !errors.Is(err, db.ErrDeliveryInProgress) {
+		t.Fatalf("ResetDelivery while leased = %v, want ErrDeliveryInProgress", err)
+	}
+	if err := db.MarkDeliveryFailure(d, "timeout", 1, time.Now().Add(time.Hour), testMeta); err != nil {
+		t.Fatal(err)
+	}
+
+	reset, err := db.ResetDelivery("811-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reset.Status != db.DeliveryPending || reset.Attempts != 0 || reset.LockedUntil != nil {
+		t.Fatalf("reset delivery = %s/%d/%v", reset.Status, reset.Attempts, reset.LockedUntil)
+	}
+	if !claim(t, reset, time.Minute) {
+		t.Fatal("claim after reset failed")
+	}
+
+	// 未支付的订单不能发货
+	createOrder(t, "811-2", 1000)
+	if _, err := db.ResetDelivery("811-2"); !errors.Is(err, db.ErrDeliveryNotAllowed) {
+		t.Fatalf("ResetDelivery unpaid = %v, want ErrDeliveryNotAllowed", err)
+	}
+}
@@ -0,0 +1,171 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"api-pay/money"
+	"api-pay/orderstate"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrVerificationLimit = errors.New("verification limit reached")
+
+// entitledStates 已支付且未全额退款的订单状态，用户拥有该商品
+var entitledStates = []orderstate.State{
+	orderstate.Paid,
+	orderstate.Delivered,
+	orderstate.DeliveryFailed,
+	orderstate.PartiallyRefunded,
+}
+
+// UserVerificationCount 用户商品的验证次数
+type UserVerificationCount struct {
+	ID                uint      `gorm:"primaryKey;comment:主键ID"`                                         // 主键ID
+	UserId            string    `gorm:"size:255;not null;uniqueIndex:idx_verify_user_item;comment:用户ID"` // 用户ID
+	Item              string    `gorm:"size:255;not null;uniqueIndex:idx_verify_user_item;comment:商品属性"` // 商品属性
+	VerificationCount int       `gorm:"not null;default:0;comment:验证次数"`                                 // 验证次数
+	LastVerifiedAt    time.Time `gorm:"comment:最后验证时间"`                                                  // 最后验证时间
+	CreatedAt         time.Time `gorm:"autoCreateTime;comment:创建时间"`                                     // 创建时间
+	UpdatedAt         time.Time `gorm:"autoUpdateTime;comment:更新时间"`                                     // 更新时间
+}
+
+// EntitlementFilter 权益查询条件，ItemId、Order 为空时不限制
+type EntitlementFilter struct {
+	UserId string
+	Item   string
+	ItemId uint
+	Order  string
+}
+
+// Entitlement 一笔有效的购买，Quantity 为扣除已退款部分后的剩余数量
+type Entitlement struct {
+	Order          string
+	Item           string
+	ItemId         uint
+	AmountNum      int64
+	Quantity       int64
+	TotalPrice     money.Money
+	RefundedAmount money.Money
+	Status         orderstate.State
+	PurchasedAt    time.Time
+}
+
+// GetEntitlements 查询用户有效的购买记录：已支付、未全额退款，按购买时间排序
+func GetEntitlements(filter EntitlementFilter) ([]Entitlement, error) {
+	query := DB.Where("user_id = ? AND item = ? AND order_status IN ?", filter.UserId, filter.Item, entitledStates)
+	if filter.ItemId != 0 {
+		query = query.Where("item_id = ?", filter.ItemId)
+	}
+	if filter.Order != "" {
+		query = query.Where("`order` = ?", filter.Order)
+	}
+
+	var orders []GameOrder
+	if err := query.Order("id").Find(&orders).Error; err != nil {
+		return nil, err
+	}
+
+	orderNos := make([]string, 0, len(orders))
+	for _, o := range orders {
+		orderNos = append(orderNos, o.Order)
+	}
+	pays, err := GetOrderPaysByOrderNos(orderNos)
+	if err != nil {
+		return nil, err
+	}
+	refunded, err := sumRefundsByOrders(orderNos)
+	if err != nil {
+		return nil, err
+	}
+
+	entitlements := make([]Entitlement, 0, len(orders))
+	for _, o := range orders {
+		pay, ok := pays[o.Order]
+		if !ok {
+			continue
+		}
+
+		e := Entitlement{
+			Order:          o.Order,
+			Item:           o.Item,
+			ItemId:         o.ItemId,
+			AmountNum:      o.AmountNum,
+			Quantity:       o.AmountNum,
+			TotalPrice:     o.TotalPrice,
+			RefundedAmount: refunded[o.Order],
+			Status:         o.OrderStatus,
+			PurchasedAt:    pay.CreatedAt,
+		}
+		// 部分退款按剩余金额折算剩余数量
+		if e.RefundedAmount.IsPositive() && o.SinglePrice.IsPositive() {
+			remaining := pay.RmbYuan.Minor() - e.RefundedAmount.Minor()
+			if q := remaining / o.SinglePrice.Minor(); q < e.Quantity {
+				e.Quantity = q
+			}
+		}
+		if e.Quantity <= 0 {
+			continue
+		}
+		entitlements = append(entitlements, e)
+	}
+	return entitlements, nil
+}
+
+// RecordVerification 验证次数加一并记录验证时间，limit 大于 0 时超过次数返回 ErrVerificationLimit
+func RecordVerification(userId, item string, limit int) (*UserVerificationCount, error) {
+	counter := &UserVerificationCount{UserId: userId, Item: item}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		// 首次验证时创建计数记录，并发创建由唯一索引兜底
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&UserVerificationCount{
+			UserId:         userId,
+			Item:           item,
+			LastVerifiedAt: time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND item = ?", userId, item).First(counter).Error; err != nil {
+			return err
+		}
+
+		if limit > 0 && counter.VerificationCount >= limit {
+			return ErrVerificationLimit
+		}
+
+		counter.VerificationCount++
+		counter.LastVerifiedAt = time.Now()
+		return tx.Model(counter).Updates(map[string]interface{}{
+			"verification_count": counter.VerificationCount,
+			"last_verified_at":   counter.LastVerifiedAt,
+		}).Error
+	})
+	return counter, err
+}
+
+// sumRefundsByOrders 批量统计订单已成功退款的金额
+func sumRefundsByOrders(orderNos []string) (map[string]money.Money, error) {
+	sums := make(map[string]money.Money, len(orderNos))
+	if len(orderNos) == 0 {
+		return sums, nil
+	}
+
+	var rows []struct {
+		GameOrderNo string
+		Total       int64
+	}
+	err := DB.Model(&GameOrderRefund{}).
+		Select("game_order_no, COALESCE(SUM(amount_minor), 0) AS total").
+		Where("game_order_no IN ? AND status = ?", orderNos, RefundSuccess).
+		Group("game_order_no").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		sums[r.GameOrderNo] = money.FromMinor(r.Total)
+	}
+	return sums, nil
+}
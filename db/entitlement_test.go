@@ -0,0 +1,112 @@
+package db_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"api-pay/db"
+	"api-pay/db/dbtest"
+	"api-pay/money"
+)
+
+// purchase 创建并支付 u1 的订单，单价 100 分
+func purchase(t *testing.T, orderNo, item string, quantity int64) {
+	t.Helper()
+	order := &db.GameOrder{
+		UserId:      "u1",
+		Item:        item,
+		ItemId:      1,
+		Order:       orderNo,
+		SinglePrice: money.FromMinor(100),
+		TotalPrice:  money.FromMinor(100 * quantity),
+		AmountNum:   quantity,
+		Channel:     "feizhu",
+	}
+	if err := db.DB.Create(order).Error; err != nil {
+		t.Fatal(err)
+	}
+	payOrder(t, orderNo, "feizhu", 100*quantity)
+}
+
+// refund 为订单完成一笔退款
+func refund(t *testing.T, refundNo, orderNo string, amount int64) {
+	t.Helper()
+	r := db.GameOrderRefund{RefundNo: refundNo, GameOrderNo: orderNo, UserId: "u1", Amount: money.FromMinor(amount)}
+	if err := db.CreateRefund(&r); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.CompleteRefund(db.RefundResult{RefundNo: refundNo, Success: true}, testMeta); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetEntitlements(t *testing.T) {
+	dbtest.Open(t)
+	purchase(t, "815-1", "gem", 3)
+	purchase(t, "815-2", "gem", 2)
+	refund(t, "R2", "815-2", 100) // 部分退款，剩 1 件
+	purchase(t, "815-3", "gem", 1)
+	refund(t, "R3", "815-3", 100) // 全额退款
+	purchase(t, "815-4", "coin", 1)
+	// 未支付订单不计入
+	if err := db.DB.Create(&db.GameOrder{UserId: "u1", Item: "gem", ItemId: 1, Order: "815-5", AmountNum: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		filter     db.EntitlementFilter
+		wantOrders []string
+		wantQty    []int64
+	}{
+		{name: "all purchases", filter: db.EntitlementFilter{UserId: "u1", Item: "gem"}, wantOrders: []string{"815-1", "815-2"}, wantQty: []int64{3, 1}},
+		{name: "specific order", filter: db.EntitlementFilter{UserId: "u1", Item: "gem", Order: "815-2"}, wantOrders: []string{"815-2"}, wantQty: []int64{1}},
+		{name: "refunded order", filter: db.EntitlementFilter{UserId: "u1", Item: "gem", Order: "815-3"}},
+		{name: "order of other item", filter: db.EntitlementFilter{UserId: "u1", Item: "gem", Order: "815-4"}},
+		{name: "item id", filter: db.EntitlementFilter{UserId: "u1", Item: "gem", ItemId: 2}},
+		{name: "other user", filter: db.EntitlementFilter{UserId: "u2", Item: "gem"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entitlements, err := db.GetEntitlements(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var orders []string
+			var qty []int64
+			for _, e := range entitlements {
+				orders = append(orders, e.Order)
+				qty = append(qty, e.Quantity)
+			}
+			if !slices.Equal(orders, tt.wantOrders) || !slices.Equal(qty, tt.wantQty) {
+				t.Errorf("entitlements = %v %v, want %v %v", orders, qty, tt.wantOrders, tt.wantQty)
+			}
+		})
+	}
+}
+
+func TestRecordVerification(t *testing.T) {
+	dbtest.Open(t)
+
+	for i := 1; i <= 2; i++ {
+		counter, err := db.RecordVerification("u1", "gem", 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if counter.VerificationCount != i || counter.LastVerifiedAt.IsZero() {
+			t.Errorf("verification %d: counter = %+v", i, counter)
+		}
+	}
+	if _, err := db.RecordVerification("u1", "gem", 2); !errors.Is(err, db.ErrVerificationLimit) {
+		t.Fatalf("third verification = %v, want ErrVerificationLimit", err)
+	}
+
+	// 上限按用户和商品分别计数，0 表示不限
+	if counter, err := db.RecordVerification("u1", "coin", 2); err != nil || counter.VerificationCount != 1 {
+		t.Errorf("other item = %+v, %v", counter, err)
+	}
+	if counter, err := db.RecordVerification("u1", "gem", 0); err != nil || counter.VerificationCount != 3 {
+		t.Errorf("unlimited = %+v, %v", counter, err)
+	}
+}
@@ -0,0 +1,316 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"api-pay/money"
+	"api-pay/orderstate"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrGoodsNotFound    = errors.New("goods not found")
+	ErrGoodsUnavailable = errors.New("goods is not on sale")
+	ErrOutOfStock       = errors.New("goods out of stock")
+	ErrPurchaseLimit    = errors.New("per-user purchase limit exceeded")
+	ErrGoodsDuplicated  = errors.New("goods item or sku code already exists")
+	ErrPriceChanged     = errors.New("goods price changed")
+
+	ErrInvalidStockChange = errors.New("stock delta requires limited stock and must not make it negative")
+)
+
+// StockChange 更新商品时的库存调整，零值表示不修改库存
+type StockChange struct {
+	Set   bool   // 将库存设置为 Value
+	Value *int64 // Set 时的库存，nil 表示不限库存
+	Delta int64  // 在当前库存上增减，仅限有库存限制的商品
+}
+
+// GameGoodsPrice 商品价格版本，每次改价新增一条
+type GameGoodsPrice struct {
+	ID        uint        `gorm:"primaryKey;comment:主键ID"`                                            // 主键ID
+	GoodsID   uint        `gorm:"uniqueIndex:idx_goods_price_version;comment:商品ID"`                   // 商品ID
+	Version   int64       `gorm:"uniqueIndex:idx_goods_price_version;comment:价格版本"`                   // 价格版本
+	Price     money.Money `gorm:"column:price_minor;type:bigint;not null;default:0;comment:商品价格，单位分"` // 商品价格
+	Operator  string      `gorm:"size:100;comment:操作人"`                                               // 操作人
+	CreatedAt time.Time   `gorm:"autoCreateTime;comment:创建时间"`                                        // 创建时间
+}
+
+// GoodsFilter 商品列表筛选条件
+type GoodsFilter struct {
+	Item     string
+	SkuCode  string
+	Keyword  string // 模糊匹配商品项和标题
+	Disabled *bool
+}
+
+// CheckAvailable 校验商品是否在售
+func (g *GameGoods) CheckAvailable(now time.Time) error {
+	if g.Disabled {
+		return ErrGoodsUnavailable
+	}
+	if g.SaleStartAt != nil && now.Before(*g.SaleStartAt) {
+		return ErrGoodsUnavailable
+	}
+	if g.SaleEndAt != nil && !now.Before(*g.SaleEndAt) {
+		return ErrGoodsUnavailable
+	}
+	return nil
+}
+
+// CreateGoods 创建商品并记录初始价格版本
+func CreateGoods(goods *GameGoods, operator string) error {
+	return translateDuplicated(DB.Transaction(func(tx *gorm.DB) error {
+		goods.PriceVersion = 1
+		if err := tx.Create(goods).Error; err != nil {
+			return err
+		}
+		return tx.Create(&GameGoodsPrice{
+			GoodsID:  goods.ID,
+			Version:  goods.PriceVersion,
+			Price:    goods.SinglePric,
+			Operator: operator,
+		}).Error
+	}))
+}
+
+// UpdateGoods 更新商品信息，价格变化时生成新的价格版本。
+// 已下单未支付的订单保存了下单时的价格及版本，不受改价影响。
+// 库存只按 stock 调整，changes.Stock 不使用。
+func UpdateGoods(id uint, changes *GameGoods, stock StockChange, operator string) (*GameGoods, error) {
+	var goods GameGoods
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockGoods(tx, id, &goods); err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{
+			"item":           changes.Item,
+			"sku_code":       changes.SkuCode,
+			"title":          changes.Title,
+			"image_list":     changes.ImageList,
+			"type":           changes.Type,
+			"tag_group_id":   changes.TagGroupID,
+			"min_quantity":   changes.MinQuantity,
+			"max_quantity":   changes.MaxQuantity,
+			"per_user_limit": changes.PerUserLimit,
+			"sale_start_at":  changes.SaleStartAt,
+			"sale_end_at":    changes.SaleEndAt,
+		}
+
+		switch {
+		case stock.Set:
+			updates["stock"] = stock.Value
+		case stock.Delta != 0:
+			if goods.Stock == nil || *goods.Stock+stock.Delta < 0 {
+				return ErrInvalidStockChange
+			}
+			updates["stock"] = gorm.Expr("stock + ?", stock.Delta)
+		}
+
+		if !goods.SinglePric.Equal(changes.SinglePric) {
+			version := goods.PriceVersion + 1
+			if err := tx.Create(&GameGoodsPrice{
+				GoodsID:  goods.ID,
+				Version:  version,
+				Price:    changes.SinglePric,
+				Operator: operator,
+			}).Error; err != nil {
+				return err
+			}
+			updates["single_pric_minor"] = changes.SinglePric
+			updates["price_version"] = version
+		}
+
+		if err := tx.Model(&goods).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.First(&goods, id).Error
+	})
+	return &goods, translateDuplicated(err)
+}
+
+// GetGoods 根据ID查询商品，包含已下架商品
+func GetGoods(id uint) (*GameGoods, error) {
+	var goods GameGoods
+	if err := DB.First(&goods, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGoodsNotFound
+		}
+		return nil, err
+	}
+	return &goods, nil
+}
+
+// ListGoods 分页查询商品
+func ListGoods(filter GoodsFilter, page, pageSize int) ([]GameGoods, int64, error) {
+	query := DB.Model(&GameGoods{})
+	if filter.Item != "" {
+		query = query.Where("item = ?", filter.Item)
+	}
+	if filter.SkuCode != "" {
+		query = query.Where("sku_code = ?", filter.SkuCode)
+	}
+	if filter.Keyword != "" {
+		like := "%" + filter.Keyword + "%"
+		query = query.Where("item LIKE ? OR title LIKE ?", like, like)
+	}
+	if filter.Disabled != nil {
+		query = query.Where("disabled = ?", *filter.Disabled)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var goods []GameGoods
+	err := query.Order("id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&goods).Error
+	return goods, total, err
+}
+
+// SetGoodsDisabled 上架或下架商品
+func SetGoodsDisabled(id uint, disabled bool) error {
+	result := DB.Model(&GameGoods{}).Where("id = ?", id).Update("disabled", disabled)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := GetGoods(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteGoods 软删除商品
+func DeleteGoods(id uint) error {
+	result := DB.Delete(&GameGoods{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrGoodsNotFound
+	}
+	return nil
+}
+
+// GetGoodsPrices 查询商品的价格版本记录
+func GetGoodsPrices(id uint) ([]GameGoodsPrice, error) {
+	var prices []GameGoodsPrice
+	err := DB.Where("goods_id = ?", id).Order("version desc").Find(&prices).Error
+	return prices, err
+}
+
+// PlaceOrder 校验限购并扣减库存后写入订单，库存在订单取消或过期时归还。
+// 锁定商品后重新校验在售状态和单价，单价与 order.SinglePrice 不一致时返回 ErrPriceChanged，
+// 总价按锁定时的商品单价重新计算。已存在相同的未支付订单时返回 ErrOrderExists。
+func PlaceOrder(order *GameOrder) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		// 锁定商品行，串行化同一商品的下单
+		var goods GameGoods
+		if err := lockGoods(tx, order.ItemId, &goods); err != nil {
+			return err
+		}
+
+		// 查询商品之后可能已下架或改价
+		if err := goods.CheckAvailable(time.Now()); err != nil {
+			return err
+		}
+		if !goods.SinglePric.Equal(order.SinglePrice) {
+			return ErrPriceChanged
+		}
+		totalPrice, err := goods.SinglePric.Mul(order.AmountNum)
+		if err != nil {
+			return ErrQuantityInvalid
+		}
+		order.TotalPrice = totalPrice
+
+		if goods.PerUserLimit > 0 {
+			var bought int64
+			if err := tx.Model(&GameOrder{}).
+				Select("COALESCE(SUM(amount_num), 0)").
+				Where("user_id = ? AND item_id = ? AND order_status NOT IN ?", order.UserId, goods.ID, inactiveStates()).
+				Scan(&bought).Error; err != nil {
+				return err
+			}
+			if bought+order.AmountNum > goods.PerUserLimit {
+				return ErrPurchaseLimit
+			}
+		}
+
+		if goods.Stock != nil {
+			if *goods.Stock < order.AmountNum {
+				return ErrOutOfStock
+			}
+			if err := tx.Model(&goods).Update("stock", gorm.Expr("stock - ?", order.AmountNum)).Error; err != nil {
+				return err
+			}
+			order.StockReserved = order.AmountNum
+		}
+
+		// 已超过有效期但尚未被扫描置为过期的订单不再占用唯一键
+		if cutoff, ok := orderExpiryCutoff(); ok {
+			if err := tx.Model(&GameOrder{}).
+				Where("active_key = ? AND created_at < ?", activeOrderKey(order), cutoff).
+				Update("active_key", nil).Error; err != nil {
+				return err
+			}
+		}
+
+		order.PriceVersion = goods.PriceVersion
+		if err := tx.Create(order).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return ErrOrderExists
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// releaseStock 归还订单下单时实际扣减的库存。
+// 下单时不限库存的商品之后改为限制库存，归还时也不会多加。
+func releaseStock(tx *gorm.DB, order *GameOrder) error {
+	if order.StockReserved == 0 {
+		return nil
+	}
+	if err := tx.Unscoped().Model(&GameGoods{}).
+		Where("id = ? AND stock IS NOT NULL", order.ItemId).
+		Update("stock", gorm.Expr("stock + ?", order.StockReserved)).Error; err != nil {
+		return err
+	}
+	// 清零避免重复归还
+	if err := tx.Model(&GameOrder{}).Where("id = ?", order.ID).Update("stock_reserved", 0).Error; err != nil {
+		return err
+	}
+	order.StockReserved = 0
+	return nil
+}
+
+// lockGoods 以 FOR UPDATE 锁定商品
+func lockGoods(tx *gorm.DB, id uint, goods *GameGoods) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(goods, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrGoodsNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// translateDuplicated 将唯一索引冲突转换为 ErrGoodsDuplicated
+func translateDuplicated(err error) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrGoodsDuplicated
+	}
+	return err
+}
+
+// inactiveStates 不计入限购的订单状态
+func inactiveStates() []orderstate.State {
+	return []orderstate.State{orderstate.Cancelled, orderstate.Expired, orderstate.Refunded}
+}
@@ -0,0 +1,209 @@
+package db_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	conf "api-pay/config"
+	"api-pay/db"
+	"api-pay/db/dbtest"
+	"api-pay/money"
+	"api-pay/orderstate"
+)
+
+// createGoods 写入单价 10 元的商品
+func createGoods(t *testing.T, edit func(*db.GameGoods)) *db.GameGoods {
+	t.Helper()
+	goods := &db.GameGoods{Item: "gem", SinglePric: money.FromMinor(1000), MinQuantity: 1}
+	if edit != nil {
+		edit(goods)
+	}
+	if err := db.CreateGoods(goods, "test"); err != nil {
+		t.Fatal(err)
+	}
+	return goods
+}
+
+var orderSeq int
+
+// newOrder 按商品单价构造待下单的订单
+func newOrder(goods *db.GameGoods, userId string, quantity int64) *db.GameOrder {
+	orderSeq++
+	return &db.GameOrder{
+		UserId:      userId,
+		Item:        goods.Item,
+		ItemId:      goods.ID,
+		Order:       fmt.Sprintf("811-%d", orderSeq),
+		SinglePrice: goods.SinglePric,
+		AmountNum:   quantity,
+	}
+}
+
+func int64Ptr(v int64) *int64 { return &v }
+
+func TestPlaceOrder(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		goods    func(*db.GameGoods)
+		placed   []int64 // 同一用户先下单的数量
+		quantity int64
+		edit     func(*db.GameOrder)
+		wantErr  error
+	}{
+		{name: "unlimited", quantity: 3},
+		{name: "stock enough", goods: func(g *db.GameGoods) { g.Stock = int64Ptr(3) }, placed: []int64{1}, quantity: 2},
+		{name: "out of stock", goods: func(g *db.GameGoods) { g.Stock = int64Ptr(3) }, placed: []int64{2}, quantity: 2, wantErr: db.ErrOutOfStock},
+		{name: "within user limit", goods: func(g *db.GameGoods) { g.PerUserLimit = 3 }, placed: []int64{1}, quantity: 2},
+		{name: "over user limit", goods: func(g *db.GameGoods) { g.PerUserLimit = 3 }, placed: []int64{2}, quantity: 2, wantErr: db.ErrPurchaseLimit},
+		{name: "disabled", goods: func(g *db.GameGoods) { g.Disabled = true }, quantity: 1, wantErr: db.ErrGoodsUnavailable},
+		{name: "sale ended", goods: func(g *db.GameGoods) { g.SaleEndAt = &past }, quantity: 1, wantErr: db.ErrGoodsUnavailable},
+		{name: "sale not started", goods: func(g *db.GameGoods) { g.SaleStartAt = &future }, quantity: 1, wantErr: db.ErrGoodsUnavailable},
+		{
+			name:     "price changed",
+			quantity: 1,
+			edit:     func(o *db.GameOrder) { o.SinglePrice = money.FromMinor(900) },
+			wantErr:  db.ErrPriceChanged,
+		},
+		{
+			name:     "client total ignored",
+			quantity: 2,
+			edit:     func(o *db.GameOrder) { o.TotalPrice = money.FromMinor(1) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbtest.Open(t)
+			goods := createGoods(t, tt.goods)
+			for _, quantity := range tt.placed {
+				if err := db.PlaceOrder(newOrder(goods, "u1", quantity)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			order := newOrder(goods, "u1", tt.quantity)
+			if tt.edit != nil {
+				tt.edit(order)
+			}
+			err := db.PlaceOrder(order)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("PlaceOrder = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if want := money.FromMinor(1000 * tt.quantity); !order.TotalPrice.Equal(want) {
+				t.Errorf("total = %s, want %s", order.TotalPrice, want)
+			}
+			if order.PriceVersion != goods.PriceVersion {
+				t.Errorf("price version = %d, want %d", order.PriceVersion, goods.PriceVersion)
+			}
+		})
+	}
+}
+
+func TestPlaceOrderStockReleased(t *testing.T) {
+	dbtest.Open(t)
+	goods := createGoods(t, func(g *db.GameGoods) { g.Stock = int64Ptr(5) })
+
+	order := newOrder(goods, "u1", 2)
+	if err := db.PlaceOrder(order); err != nil {
+		t.Fatal(err)
+	}
+	if got := goodsStock(t, goods.ID); got != 3 {
+		t.Fatalf("stock after order = %d, want 3", got)
+	}
+
+	if _, err := db.CancelOrder("u1", order.Order, "", testMeta); err != nil {
+		t.Fatal(err)
+	}
+	if got := goodsStock(t, goods.ID); got != 5 {
+		t.Fatalf("stock after cancel = %d, want 5", got)
+	}
+
+	// 已取消的订单不能再次取消，库存不会重复归还
+	if _, err := db.CancelOrder("u1", order.Order, "", testMeta); !errors.Is(err, orderstate.ErrIllegalTransition) {
+		t.Fatalf("second cancel = %v", err)
+	}
+	if got := goodsStock(t, goods.ID); got != 5 {
+		t.Fatalf("stock after second cancel = %d, want 5", got)
+	}
+}
+
+func TestPlaceOrderDuplicate(t *testing.T) {
+	dbtest.Open(t)
+	goods := createGoods(t, nil)
+
+	if err := db.PlaceOrder(newOrder(goods, "u1", 1)); err != nil {
+		t.Fatal(err)
+	}
+	// 相同用户、商品、价格、数量的未支付订单由唯一键拦截
+	if err := db.PlaceOrder(newOrder(goods, "u1", 1)); !errors.Is(err, db.ErrOrderExists) {
+		t.Fatalf("duplicate PlaceOrder = %v, want ErrOrderExists", err)
+	}
+	if err := db.PlaceOrder(newOrder(goods, "u2", 1)); err != nil {
+		t.Fatalf("other user PlaceOrder = %v", err)
+	}
+}
+
+// TestPlaceOrderActiveKey 未支付订单关闭、支付或超过有效期后，同样的订单可以再次下单
+func TestPlaceOrderActiveKey(t *testing.T) {
+	saved := conf.AppConfig
+	t.Cleanup(func() { conf.AppConfig = saved })
+	conf.AppConfig.Order.TTL = 30
+
+	tests := []struct {
+		name    string
+		close   func(t *testing.T, order *db.GameOrder)
+		wantErr error
+	}{
+		{name: "still unpaid", close: func(t *testing.T, order *db.GameOrder) {}, wantErr: db.ErrOrderExists},
+		{name: "cancelled", close: func(t *testing.T, order *db.GameOrder) {
+			if _, err := db.CancelOrder(order.UserId, order.Order, "", testMeta); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{name: "paid", close: func(t *testing.T, order *db.GameOrder) {
+			payOrder(t, order.Order, "feizhu", order.TotalPrice.Minor())
+		}},
+		{name: "expired", close: func(t *testing.T, order *db.GameOrder) {
+			if _, err := db.ExpireOrders(time.Now().Add(time.Second), 10, testMeta); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{name: "past ttl not yet expired", close: func(t *testing.T, order *db.GameOrder) {
+			db.DB.Model(order).Update("created_at", time.Now().Add(-time.Hour))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbtest.Open(t)
+			goods := createGoods(t, nil)
+			order := newOrder(goods, "u1", 1)
+			if err := db.PlaceOrder(order); err != nil {
+				t.Fatal(err)
+			}
+			tt.close(t, order)
+
+			if err := db.PlaceOrder(newOrder(goods, "u1", 1)); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("PlaceOrder = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func goodsStock(t *testing.T, id uint) int64 {
+	t.Helper()
+	goods, err := db.GetGoods(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if goods.Stock == nil {
+		t.Fatal("stock is unlimited")
+	}
+	return *goods.Stock
+}
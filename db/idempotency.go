@@ -0,0 +1,87 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// idempotencyLease 处理中的记录超过该时长仍未完成，视为请求异常中断，允许重新处理
+const idempotencyLease = time.Minute
+
+// IdempotencyRecord 幂等键记录，保存首次请求的响应用于重放
+type IdempotencyRecord struct {
+	ID           uint      `gorm:"primaryKey;comment:主键ID"`                                        // 主键ID
+	Key          string    `gorm:"size:64;not null;uniqueIndex:idx_idempotency_key;comment:幂等键"`   // 幂等键
+	Route        string    `gorm:"size:191;not null;uniqueIndex:idx_idempotency_key;comment:请求路由"` // 请求路由
+	Caller       string    `gorm:"size:128;not null;uniqueIndex:idx_idempotency_key;comment:调用方"`  // 调用方
+	RequestHash  string    `gorm:"type:char(64);not null;comment:请求体SHA256"`                       // 请求体摘要
+	Completed    bool      `gorm:"not null;default:false;comment:是否已保存响应"`                         // 是否已完成
+	StatusCode   int       `gorm:"not null;default:0;comment:响应状态码"`                               // 响应状态码
+	ContentType  string    `gorm:"size:100;comment:响应类型"`                                          // 响应类型
+	ResponseBody []byte    `gorm:"type:mediumblob;comment:响应内容"`                                   // 响应内容
+	TraceID      string    `gorm:"size:64;comment:首次请求的追踪ID"`                                      // 追踪ID
+	ExpiresAt    time.Time `gorm:"index;not null;comment:过期时间"`                                    // 过期时间
+	CreatedAt    time.Time `gorm:"autoCreateTime;comment:创建时间"`                                    // 创建时间
+}
+
+// ClaimIdempotencyKey 占用幂等键。占用成功返回 nil，
+// 已被占用时返回已有记录，由调用方判断重放或拒绝。
+// 已过期或处理中断的记录会被清除后重新占用。
+func ClaimIdempotencyKey(record *IdempotencyRecord) (*IdempotencyRecord, error) {
+	for attempt := 0; ; attempt++ {
+		err := DB.Create(record).Error
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, err
+		}
+
+		var existing IdempotencyRecord
+		err = DB.Where("`key` = ? AND route = ? AND caller = ?", record.Key, record.Route, record.Caller).
+			First(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) && attempt == 0 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		stale := now.After(existing.ExpiresAt) || (!existing.Completed && now.Sub(existing.CreatedAt) > idempotencyLease)
+		if !stale || attempt > 0 {
+			return &existing, nil
+		}
+		// 条件删除，并发时只有一个请求能接管
+		if err := DB.Where("id = ? AND created_at = ?", existing.ID, existing.CreatedAt).
+			Delete(&IdempotencyRecord{}).Error; err != nil {
+			return nil, err
+		}
+		record.ID = 0
+		record.CreatedAt = time.Time{}
+	}
+}
+
+// CompleteIdempotencyKey 保存首次请求的响应
+func CompleteIdempotencyKey(id uint, statusCode int, contentType string, body []byte, traceID string) error {
+	return DB.Model(&IdempotencyRecord{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"completed":     true,
+		"status_code":   statusCode,
+		"content_type":  contentType,
+		"response_body": body,
+		"trace_id":      traceID,
+	}).Error
+}
+
+// ReleaseIdempotencyKey 删除未保存响应的记录，允许客户端使用同一幂等键重试
+func ReleaseIdempotencyKey(id uint) error {
+	return DB.Where("id = ? AND completed = ?", id, false).Delete(&IdempotencyRecord{}).Error
+}
+
+// PurgeIdempotencyKeys 删除过期的幂等键记录，返回删除数量
+func PurgeIdempotencyKeys(before time.Time, limit int) (int64, error) {
+	result := DB.Where("expires_at < ?", before).Limit(limit).Delete(&IdempotencyRecord{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,172 @@
+package db
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrLockTimeout = errors.New("acquire lock timeout")
+	ErrLockLost    = errors.New("lock is no longer held")
+)
+
+const lockRetryInterval = 50 * time.Millisecond
+
+// 仅持有者（token 一致）才能释放或续期
+var (
+	unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+	renewScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+)
+
+// Lock 分布式锁，基于 Redis SET NX PX 实现，Redis 不可用时退化为进程内锁。
+// 持有期间每 ttl/3 自动续期，直到调用 Release。
+type Lock struct {
+	key   string
+	token string
+	ttl   time.Duration
+	local bool
+	stop  chan struct{}
+	once  sync.Once
+}
+
+// AcquireLock 获取 key 对应的锁，最多等待 wait，超时返回 ErrLockTimeout
+func AcquireLock(key string, ttl, wait time.Duration) (*Lock, error) {
+	l := &Lock{key: "api-pay:lock:" + key, token: uuid.NewString(), ttl: ttl, stop: make(chan struct{})}
+	deadline := time.Now().Add(wait)
+	for {
+		if l.tryAcquire() {
+			go l.watchdog()
+			return l, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrLockTimeout
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// WithLock 持有 key 对应的锁执行 fn
+func WithLock(key string, ttl, wait time.Duration, fn func() error) error {
+	l, err := AcquireLock(key, ttl, wait)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+	return fn()
+}
+
+// tryAcquire 尝试获取一次锁，Redis 出错时改用进程内锁
+func (l *Lock) tryAcquire() bool {
+	if RedisClient != nil {
+		ok, err := RedisClient.SetNX(Ctx, l.key, l.token, l.ttl).Result()
+		if err == nil {
+			l.local = false
+			return ok
+		}
+	}
+	l.local = true
+	return localLocks.acquire(l.key, l.token, l.ttl)
+}
+
+// Refresh 将锁的有效期延长为 ttl，锁已过期或被他人持有时返回 ErrLockLost
+func (l *Lock) Refresh() error {
+	if l.local {
+		if !localLocks.renew(l.key, l.token, l.ttl) {
+			return ErrLockLost
+		}
+		return nil
+	}
+	n, err := renewScript.Run(Ctx, RedisClient, []string{l.key}, l.token, l.ttl.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// Release 释放锁，只会删除自己持有的锁，可重复调用
+func (l *Lock) Release() {
+	l.once.Do(func() {
+		close(l.stop)
+		if l.local {
+			localLocks.release(l.key, l.token)
+			return
+		}
+		unlockScript.Run(Ctx, RedisClient, []string{l.key}, l.token)
+	})
+}
+
+// watchdog 定期续期，锁丢失或释放后退出
+func (l *Lock) watchdog() {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if errors.Is(l.Refresh(), ErrLockLost) {
+				return
+			}
+		}
+	}
+}
+
+// localLocks 进程内锁，仅保证单实例内互斥
+var localLocks = &localLockTable{items: make(map[string]localLock)}
+
+type localLock struct {
+	token    string
+	expireAt time.Time
+}
+
+type localLockTable struct {
+	mu    sync.Mutex
+	items map[string]localLock
+}
+
+func (t *localLockTable) acquire(key, token string, ttl time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if held, ok := t.items[key]; ok && now.Before(held.expireAt) {
+		return false
+	}
+	t.items[key] = localLock{token: token, expireAt: now.Add(ttl)}
+	return true
+}
+
+func (t *localLockTable) renew(key, token string, ttl time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	held, ok := t.items[key]
+	if !ok || held.token != token || time.Now().After(held.expireAt) {
+		return false
+	}
+	t.items[key] = localLock{token: token, expireAt: time.Now().Add(ttl)}
+	return true
+}
+
+func (t *localLockTable) release(key, token string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if held, ok := t.items[key]; ok && held.token == token {
+		delete(t.items, key)
+	}
+}
@@ -0,0 +1,113 @@
+package db_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"api-pay/db"
+	"api-pay/db/dbtest"
+)
+
+func TestAcquireLock(t *testing.T) {
+	// 与限流相同，Redis 不可用时退化为进程内锁
+	for _, backend := range rateLimitBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			backend.setup(t)
+			key := backendKey(t)
+
+			l, err := db.AcquireLock(key, time.Second, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.AcquireLock(key, time.Second, 100*time.Millisecond); !errors.Is(err, db.ErrLockTimeout) {
+				t.Fatalf("second AcquireLock = %v, want ErrLockTimeout", err)
+			}
+			if other, err := db.AcquireLock(key+":other", time.Second, 0); err != nil {
+				t.Fatalf("other key = %v", err)
+			} else {
+				other.Release()
+			}
+			if err := l.Refresh(); err != nil {
+				t.Fatalf("Refresh = %v", err)
+			}
+
+			// 等待中的请求在锁释放后获得锁
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				l.Release()
+			}()
+			next, err := db.AcquireLock(key, time.Second, time.Second)
+			if err != nil {
+				t.Fatalf("AcquireLock after release = %v", err)
+			}
+			// 重复释放不影响新的持有者
+			l.Release()
+			if err := next.Refresh(); err != nil {
+				t.Fatalf("new holder lost the lock: %v", err)
+			}
+			next.Release()
+		})
+	}
+}
+
+func TestLockExpired(t *testing.T) {
+	server := dbtest.Redis(t)
+
+	l, err := db.AcquireLock("order", time.Minute, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Release()
+	// 持有者停顿超过 ttl 后锁被他人获得，原持有者不能续期或释放他人的锁
+	server.FastForward(time.Minute + time.Second)
+	next, err := db.AcquireLock("order", time.Minute, 0)
+	if err != nil {
+		t.Fatalf("AcquireLock after expiry = %v", err)
+	}
+	defer next.Release()
+
+	if err := l.Refresh(); !errors.Is(err, db.ErrLockLost) {
+		t.Fatalf("Refresh = %v, want ErrLockLost", err)
+	}
+	l.Release()
+	if err := next.Refresh(); err != nil {
+		t.Fatalf("new holder lost the lock: %v", err)
+	}
+}
+
+func TestWithLockExclusive(t *testing.T) {
+	for _, backend := range rateLimitBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			backend.setup(t)
+			key := backendKey(t)
+
+			var running, maxRunning atomic.Int32
+			var wg sync.WaitGroup
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					err := db.WithLock(key, time.Second, 5*time.Second, func() error {
+						n := running.Add(1)
+						if n > maxRunning.Load() {
+							maxRunning.Store(n)
+						}
+						time.Sleep(10 * time.Millisecond)
+						running.Add(-1)
+						return nil
+					})
+					if err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+			if maxRunning.Load() != 1 {
+				t.Errorf("%d holders at the same time", maxRunning.Load())
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package db
+
+import "fmt"
+
+// legacyMoneyColumn 旧版 decimal(10,2) 金额列与新的分存储列的对应关系
+type legacyMoneyColumn struct {
+	model  interface{}
+	table  string
+	legacy string
+	minor  string
+}
+
+var legacyMoneyColumns = []legacyMoneyColumn{
+	{&GameGoods{}, "game_goods", "single_pric", "single_pric_minor"},
+	{&GameOrder{}, "game_orders", "single_price", "single_price_minor"},
+	{&GameOrderPay{}, "game_order_pays", "rmb_yuan", "rmb_yuan_minor"},
+	{&GameOrderReview{}, "game_order_reviews", "rmb_yuan", "rmb_yuan_minor"},
+	{&GameOrderRefund{}, "game_order_refunds", "amount", "amount_minor"},
+}
+
+// backfillOrderTotals 历史订单没有总价，按单价乘以数量补全，数量为 0 的按 1 计
+func backfillOrderTotals() error {
+	return DB.Exec("UPDATE `game_orders` SET `total_price_minor` = `single_price_minor` * GREATEST(`amount_num`, 1) " +
+		"WHERE `total_price_minor` = 0 AND `single_price_minor` <> 0").Error
+}
+
+// backfillOrderSeq 补全历史订单的雪花ID
+func backfillOrderSeq() error {
+	return DB.Exec("UPDATE `game_orders` SET `order_seq` = CAST(SUBSTRING_INDEX(`order`, '-', -1) AS UNSIGNED) " +
+		"WHERE `order_seq` = 0 AND `order` <> ''").Error
+}
+
+// migrateMoneyColumns 将旧版 decimal 金额回填到以分存储的整数列。
+// 旧列保留用于回滚：放开 NOT NULL 约束以免新写入失败，确认数据无误后可手动删除，
+// 删除后本迁移自动跳过。回填只处理新列为 0 的行，可重复执行。
+func migrateMoneyColumns() error {
+	migrator := DB.Migrator()
+	for _, col := range legacyMoneyColumns {
+		if !migrator.HasColumn(col.model, col.legacy) {
+			continue
+		}
+
+		if err := DB.Exec(fmt.Sprintf("ALTER TABLE `%s` MODIFY `%s` decimal(10,2) NULL", col.table, col.legacy)).Error; err != nil {
+			return fmt.Errorf("relax legacy column %s.%s: %w", col.table, col.legacy, err)
+		}
+
+		if err := DB.Exec(fmt.Sprintf(
+			"UPDATE `%s` SET `%s` = ROUND(`%s` * 100) WHERE `%s` = 0 AND `%s` IS NOT NULL AND `%s` <> 0",
+			col.table, col.minor, col.legacy, col.minor, col.legacy, col.legacy,
+		)).Error; err != nil {
+			return fmt.Errorf("backfill %s.%s: %w", col.table, col.minor, err)
+		}
+	}
+	return nil
+}
@@ -1,9 +1,15 @@
 package db
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"time"
 
 	config "api-pay/config"
+	"api-pay/money"
+	"api-pay/orderstate"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -11,57 +17,113 @@ import (
 
 var DB *gorm.DB
 
+var (
+	ErrOrderNotFound     = errors.New("order not found")
+	ErrOrderNotPayable   = errors.New("order is not payable")
+	ErrAmountMismatch    = errors.New("amount mismatch")
+	ErrOrderPaidConflict = errors.New("order already paid by another trade")
+	ErrOrderExpired      = errors.New("order expired")
+	ErrQuantityInvalid   = errors.New("quantity out of range")
+	ErrOrderExists       = errors.New("unpaid order already exists")
+)
+
+// GameGoods 商品表模型
 type GameGoods struct {
-	ID         uint      `gorm:"primaryKey;comment:主键ID"`                  // 主键ID
-	Item       string    `gorm:"size:255;uniqueIndex;comment:商品项，表示购买的物品"` // 商品项
-	SinglePric float64   `gorm:"type:decimal(10,2);comment:商品价格，保留两位小数"`   // 商品价格
-	CreatedAt  time.Time `gorm:"autoCreateTime;comment:创建时间"`              // 创建时间
+	ID           uint           `gorm:"primaryKey;comment:主键ID"`                                                  // 主键ID
+	Item         string         `gorm:"size:255;uniqueIndex;comment:商品项，表示购买的物品"`                                 // 商品项
+	SinglePric   money.Money    `gorm:"column:single_pric_minor;type:bigint;not null;default:0;comment:商品价格，单位分"` // 商品价格
+	MinQuantity  int64          `gorm:"not null;default:1;comment:单笔最少购买数量"`                                      // 单笔最少购买数量
+	MaxQuantity  int64          `gorm:"not null;default:0;comment:单笔最多购买数量，0 表示不限"`                               // 单笔最多购买数量
+	SkuCode      *string        `gorm:"size:100;uniqueIndex;comment:SKU编码"`                                       // SKU编码
+	Title        string         `gorm:"size:255;comment:商品标题"`                                                    // 商品标题
+	ImageList    string         `gorm:"type:text;comment:商品图片，JSON数组"`                                            // 商品图片
+	Type         int            `gorm:"not null;default:0;comment:商品类型"`                                          // 商品类型
+	TagGroupID   string         `gorm:"size:100;comment:标签组ID"`                                                   // 标签组ID
+	Stock        *int64         `gorm:"comment:库存，NULL 表示不限"`                                                     // 库存
+	PerUserLimit int64          `gorm:"not null;default:0;comment:每个用户累计限购数量，0 表示不限"`                             // 每用户限购
+	SaleStartAt  *time.Time     `gorm:"comment:开售时间"`                                                             // 开售时间
+	SaleEndAt    *time.Time     `gorm:"comment:停售时间"`                                                             // 停售时间
+	Disabled     bool           `gorm:"not null;default:false;comment:是否下架"`                                      // 是否下架
+	PriceVersion int64          `gorm:"not null;default:1;comment:当前价格版本"`                                        // 当前价格版本
+	CreatedAt    time.Time      `gorm:"autoCreateTime;comment:创建时间"`                                              // 创建时间
+	UpdatedAt    time.Time      `gorm:"autoUpdateTime;comment:更新时间"`                                              // 更新时间
+	DeletedAt    gorm.DeletedAt `gorm:"index;comment:删除时间"`                                                       // 删除时间
 }
 
 // GameOrder 游戏订单表模型
 type GameOrder struct {
-	ID            uint       `gorm:"primaryKey;comment:主键ID"` // 主键ID
-	UserId        string     `gorm:"size:255;comment:用户ID，唯一标识玩家"`
-	Item          string     `gorm:"size:255;comment:商品项，表示购买的物品"`
-	ItemId        uint       `gorm:"type:int;comment:商品属性ID"`                 // 商品属性
-	SinglePrice   float64    `gorm:"type:decimal(10,2);comment:商品价格，保留两位小数"`  // 商品价格
-	OrderStatus   float64    `gorm:"size:255;comment:订单状态 0 未支付 1 已取消 2 已支付"` // 商品价格
-	AmountNum     int64      `gorm:"type:int;comment:购买数量"`                   // 购买数量
-	Order         string     `gorm:"size:255;comment:游戏订单号，用于标识该订单"`          // 游戏订单号
-	ServerFlag    string     `gorm:"size:100;comment:服务器标识，区分订单所属服务器"`        // 服务器标识
-	Description   string     `gorm:"size:255;comment:订单描述，描述订单详细信息"`          // 订单描述
-	GameRoleId    string     `gorm:"size:255;comment:游戏角色ID"`                 // 游戏角色ID
-	GameRoleName  string     `gorm:"size:255;comment:游戏角色名称"`                 // 游戏角色名称
-	GameRoleGrade string     `gorm:"size:255;comment:游戏角色等级"`                 // 游戏角色等级
-	GameOrderNo   string     `gorm:"size:255;comment:游戏订单号"`                  // 游戏订单号
-	GyyxOrderNo   string     `gorm:"size:255;comment:平台订单号"`                  // 平台订单号
-	Timestamp     string     `gorm:"size:50;comment:时间戳"`                     // 时间戳
-	DeletedAt     *time.Time `gorm:"comment:删除时间，记录删除时间戳"`                    // 删除时间
-	CreatedAt     time.Time  `gorm:"autoCreateTime;comment:创建时间"`             // 创建时间
+	ID            uint             `gorm:"primaryKey;comment:主键ID"` // 主键ID
+	UserId        string           `gorm:"size:255;comment:用户ID，唯一标识玩家"`
+	Item          string           `gorm:"size:255;comment:商品项，表示购买的物品"`
+	ItemId        uint             `gorm:"type:int;comment:商品属性ID"`                                                         // 商品属性
+	SinglePrice   money.Money      `gorm:"column:single_price_minor;type:bigint;not null;default:0;comment:商品价格，单位分"`       // 商品价格
+	TotalPrice    money.Money      `gorm:"column:total_price_minor;type:bigint;not null;default:0;comment:订单总价，单价乘以数量，单位分"` // 订单总价
+	PriceVersion  int64            `gorm:"not null;default:0;comment:下单时的商品价格版本"`                                           // 价格版本
+	OrderStatus   orderstate.State `gorm:"type:int;default:0;comment:订单状态，见 orderstate"`                                    // 订单状态
+	AmountNum     int64            `gorm:"type:int;comment:购买数量"`                                                           // 购买数量
+	StockReserved int64            `gorm:"not null;default:0;comment:下单时扣减的库存，取消或过期时按此归还"`                                  // 扣减的库存
+	Order         string           `gorm:"size:255;index;comment:游戏订单号，用于标识该订单"`                                            // 游戏订单号
+	OrderSeq      int64            `gorm:"index;not null;default:0;comment:订单号中的雪花ID，用于游标分页"`                               // 雪花ID
+	ServerFlag    string           `gorm:"size:100;comment:服务器标识，区分订单所属服务器"`                                                // 服务器标识
+	Channel       string           `gorm:"size:32;not null;default:feizhu;comment:支付渠道"`                                    // 支付渠道
+	AppKey        string           `gorm:"size:64;index;comment:创建订单的客户端"`                                                  // 创建订单的客户端
+	ActiveKey     *string          `gorm:"type:char(40);uniqueIndex:idx_order_active;comment:未支付订单唯一键，支付或关闭后置空"`            // 未支付订单唯一键
+	QueriedAt     *time.Time       `gorm:"comment:最近一次向平台查单的时间"`                                                            // 最近查单时间
+	Description   string           `gorm:"size:255;comment:订单描述，描述订单详细信息"`                                                  // 订单描述
+	GameRoleId    string           `gorm:"size:255;comment:游戏角色ID"`                                                         // 游戏角色ID
+	GameRoleName  string           `gorm:"size:255;comment:游戏角色名称"`                                                         // 游戏角色名称
+	GameRoleGrade string           `gorm:"size:255;comment:游戏角色等级"`                                                         // 游戏角色等级
+	GameOrderNo   string           `gorm:"size:255;comment:游戏订单号"`                                                          // 游戏订单号
+	GyyxOrderNo   string           `gorm:"size:255;comment:平台订单号"`                                                          // 平台订单号
+	Timestamp     string           `gorm:"size:50;comment:时间戳"`                                                             // 时间戳
+	DeletedAt     *time.Time       `gorm:"comment:删除时间，记录删除时间戳"`                                                            // 删除时间
+	CreatedAt     time.Time        `gorm:"autoCreateTime;comment:创建时间"`                                                     // 创建时间
 }
 
 // GameOrderPay 游戏支付成功数据
 type GameOrderPay struct {
-	ID            uint      `gorm:"primaryKey;comment:主键ID"`                       // 主键ID
-	UserId        string    `gorm:"size:255;not null;comment:用户ID，唯一标识玩家"`         // 用户ID
-	ItemId        uint      `gorm:"type:int;comment:商品属性ID"`                       // 商品属性
-	Item          string    `gorm:"size:255;not null;comment:商品属性"`                // 商品属性
-	GameOrderNo   string    `gorm:"size:255;comment:游戏订单号"`                        // 游戏订单号
-	GyyxOrderNo   string    `gorm:"size:255;comment:平台订单号"`                        // 平台订单号
-	Result        string    `gorm:"size:50;comment:支付结果"`                          // 支付结果
-	ResultMessage string    `gorm:"size:255;comment:支付结果信息"`                       // 支付结果信息
-	RmbYuan       float64   `gorm:"type:decimal(10,2);not null;comment:金额，保留两位小数"` // 金额
-	ServerFlag    string    `gorm:"size:100;comment:服务器标识"`                        // 服务器标识
-	CommonParam   string    `gorm:"size:255;comment:通用参数"`                         // 通用参数
-	Timestamp     string    `gorm:"size:50;comment:时间戳"`                           // 时间戳
-	CreatedAt     time.Time `gorm:"autoCreateTime;comment:创建时间"`                   // 创建时间
+	ID            uint        `gorm:"primaryKey;comment:主键ID"`                                             // 主键ID
+	UserId        string      `gorm:"size:255;not null;comment:用户ID，唯一标识玩家"`                               // 用户ID
+	ItemId        uint        `gorm:"type:int;comment:商品属性ID"`                                             // 商品属性
+	Item          string      `gorm:"size:255;not null;comment:商品属性"`                                      // 商品属性
+	GameOrderNo   string      `gorm:"size:255;uniqueIndex;comment:游戏订单号"`                                  // 游戏订单号
+	GyyxOrderNo   string      `gorm:"size:255;comment:平台订单号"`                                              // 平台订单号
+	Channel       string      `gorm:"size:32;not null;default:feizhu;comment:支付渠道"`                        // 支付渠道
+	Result        string      `gorm:"size:50;comment:支付结果"`                                                // 支付结果
+	ResultMessage string      `gorm:"size:255;comment:支付结果信息"`                                             // 支付结果信息
+	RmbYuan       money.Money `gorm:"column:rmb_yuan_minor;type:bigint;not null;default:0;comment:金额，单位分"` // 金额
+	ServerFlag    string      `gorm:"size:100;comment:服务器标识"`                                              // 服务器标识
+	CommonParam   string      `gorm:"size:255;comment:通用参数"`                                               // 通用参数
+	Timestamp     string      `gorm:"size:50;comment:时间戳"`                                                 // 时间戳
+	CreatedAt     time.Time   `gorm:"autoCreateTime;comment:创建时间"`                                         // 创建时间
+}
+
+// Models 需要自动迁移的全部表
+func Models() []interface{} {
+	return []interface{}{
+		&GameGoods{},
+		&GameGoodsPrice{},
+		&GameOrder{},
+		&GameOrderPay{},
+		&GameOrderEvent{},
+		&GameOrderReview{},
+		&GameOrderRefund{},
+		&GameOrderDelivery{},
+		&GameReconciliation{},
+		&UserVerificationCount{},
+		&ApiClient{},
+		&AdminUser{},
+		&IdempotencyRecord{},
+	}
 }
 
 // InitDB 初始化数据库连接
 func InitDB() error {
 	dsn := config.GetDBConnectionString()
 	var err error
-	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{
+		TranslateError: true, // 唯一索引冲突等转换为 gorm 的通用错误
+	})
 	if err != nil {
 		return err
 	}
@@ -73,13 +135,39 @@ func InitDB() error {
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
 	// 自动迁移表结构
-	err = DB.AutoMigrate(
-		&GameGoods{},
-		&GameOrder{},
-		&GameOrderPay{},
-	)
+	if err = DB.AutoMigrate(Models()...); err != nil {
+		return err
+	}
+
+	// 旧版 decimal 金额列迁移到以分存储的整数列
+	if err = migrateMoneyColumns(); err != nil {
+		return err
+	}
+
+	// 补全历史订单的总价和雪花ID
+	if err = backfillOrderTotals(); err != nil {
+		return err
+	}
+	return backfillOrderSeq()
+}
+
+// MaxOrderQuantity 单笔订单的购买数量上限，商品未设置 max_quantity 时同样生效
+const MaxOrderQuantity = 9999
 
-	return err
+// CheckQuantity 校验购买数量是否在商品允许的范围内
+func (g *GameGoods) CheckQuantity(quantity int64) error {
+	minQuantity := g.MinQuantity
+	if minQuantity < 1 {
+		minQuantity = 1
+	}
+	maxQuantity := g.MaxQuantity
+	if maxQuantity <= 0 || maxQuantity > MaxOrderQuantity {
+		maxQuantity = MaxOrderQuantity
+	}
+	if quantity < minQuantity || quantity > maxQuantity {
+		return ErrQuantityInvalid
+	}
+	return nil
 }
 
 func InsertOrder(order any) error {
@@ -88,38 +176,39 @@ func InsertOrder(order any) error {
 
 func GetOrderByGoodsId(goodsId int) (*GameGoods, error) {
 	var goods GameGoods
-	result := DB.Where("id = ?", goodsId).Order("created_at desc").First(&goods)
+	result := DB.Where("id = ? AND disabled = ?", goodsId, false).Order("created_at desc").First(&goods)
 	return &goods, result.Error
 }
 
-func GetOrderByGoodsIitem(itemId string, singlePrice float64) (*GameGoods, error) {
+// GetGoodsByItem 根据商品项查询商品，包含已下架商品，由调用方校验在售状态和价格
+func GetGoodsByItem(item string) (*GameGoods, error) {
 	var goods GameGoods
-	result := DB.Where("item = ? AND single_pric = ?", itemId, singlePrice).Order("created_at desc").First(&goods)
-	return &goods, result.Error
-}
-
-func GetOrderByNo(orderNo string) (bool, error) {
-	var exists bool
-	result := DB.Model(&GameOrder{}).Select("1").Where("`order` = ? AND order_status = 0", orderNo).Limit(1).Find(&exists)
-
-	if result.Error != nil {
-		return false, result.Error
+	if err := DB.Where("item = ?", item).First(&goods).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGoodsNotFound
+		}
+		return nil, err
 	}
-	return result.RowsAffected > 0, nil
+	return &goods, nil
 }
 
-// 查询你此订单号是否是未支付的状态
-func GetOrderByNoPrice(orderNo string, single_price float64) (*GameOrder, error) {
+// GetOrderByNo 根据订单号查询订单
+func GetOrderByNo(orderNo string) (*GameOrder, error) {
 	var order GameOrder
-	result := DB.Where("`order` = ? AND single_price = ? AND order_status = 0", orderNo, single_price).First(&order)
-	return &order, result.Error
+	if err := DB.Where("`order` = ?", orderNo).First(&order).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+	return &order, nil
 }
 
-// 查询是否存在未支付的订单
-func GetOrderByUserAndItem(userId string, item string, singlePrice float64) (*GameOrder, error) {
+// 查询是否存在同价格、同数量的未支付订单
+func GetOrderByUserAndItem(userId string, item string, singlePrice money.Money, amountNum int64) (*GameOrder, error) {
 	var order GameOrder
-	// 仅当订单存在且未支付时才返回
-	result := DB.Where("user_id = ? AND item = ? AND single_price = ? AND order_status = 0", userId, item, singlePrice).First(&order)
+	// 仅当订单存在、未支付且未过期时才返回
+	result := DB.Scopes(unpaidScope).Where("user_id = ? AND item = ? AND single_price_minor = ? AND amount_num = ?", userId, item, singlePrice, amountNum).First(&order)
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
 			// 订单不存在，返回nil
@@ -131,36 +220,79 @@ func GetOrderByUserAndItem(userId string, item string, singlePrice float64) (*Ga
 	return &order, nil
 }
 
-// 更改订单为已支付的状态
-func UpdateOrderStatus(userId, orderNo string) error {
-	if err := DB.Model(&GameOrder{}).Where("user_id = ? AND `order` = ?", userId, orderNo).Updates(map[string]interface{}{
-		"order_status": 2,
-	}).Error; err != nil {
-		return err
+// activeOrderKey 同一用户、商品、价格、数量只允许存在一个未支付订单，
+// 唯一键取这些字段的 SHA1，避免超出索引长度
+func activeOrderKey(o *GameOrder) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s\x00%s\x00%d\x00%d", o.UserId, o.Item, o.SinglePrice.Minor(), o.AmountNum)))
+	return hex.EncodeToString(sum[:])
+}
+
+// CancelOrder 取消用户未支付的订单，返回取消后的订单
+func CancelOrder(userId, orderNo, appKey string, meta orderstate.Meta) (*GameOrder, error) {
+	var order *GameOrder
+	err := withMeta(meta).Transaction(func(tx *gorm.DB) error {
+		query, args := ownerCondition(userId, orderNo, appKey)
+		var err error
+		order, err = lockOrder(tx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		return TransitionOrder(tx, order, orderstate.Cancelled, meta, map[string]interface{}{
+			"deleted_at": &now,
+		})
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return order, nil
 }
 
-// 更改订单为取消的状态
-func UpdateOrderStatusCancel(userId, orderNo string) error {
-	now := time.Now()
-	if err := DB.Model(&GameOrder{}).Where("user_id = ? AND `order` = ?", userId, orderNo).Updates(map[string]interface{}{
-		"order_status": 1,
-		"deleted_at":   &now,
-	}).Error; err != nil {
-		return err
+// ownerCondition 订单归属条件：用户一致，且由同一客户端创建；
+// 未启用客户端认证或未记录客户端的历史订单只校验用户
+func ownerCondition(userId, orderNo, appKey string) (string, []interface{}) {
+	if appKey == "" {
+		return "user_id = ? AND `order` = ?", []interface{}{userId, orderNo}
 	}
-	return nil
+	return "user_id = ? AND `order` = ? AND app_key IN ?", []interface{}{userId, orderNo, []string{appKey, ""}}
 }
 
-func GetOrderPayExists(gameOrderNo string, singlePric float64) (bool, error) {
-	var exists bool
-	result := DB.Model(&GameOrderPay{}).Select("1").Where("game_order_no = ? AND rmb_yuan = ?", gameOrderNo, singlePric).Limit(1).Find(&exists)
+// SubmitOrder 提交订单支付：校验订单归属和状态，将已创建的订单改为待支付并记录支付渠道。
+// 已是待支付的订单允许重复提交以重新获取支付参数，可切换支付渠道。
+func SubmitOrder(userId, orderNo, appKey, channel string, meta orderstate.Meta) (*GameOrder, error) {
+	var order *GameOrder
+	err := withMeta(meta).Transaction(func(tx *gorm.DB) error {
+		query, args := ownerCondition(userId, orderNo, appKey)
+		var err error
+		order, err = lockOrder(tx, query, args...)
+		if err != nil {
+			return err
+		}
 
-	if result.Error != nil {
-		return false, result.Error
+		if order.OrderStatus != orderstate.Created && order.OrderStatus != orderstate.PendingPayment {
+			return ErrOrderNotPayable
+		}
+		// 已超过有效期但尚未被扫描置为过期的订单不再提交
+		if cutoff, ok := orderExpiryCutoff(); ok && order.CreatedAt.Before(cutoff) {
+			return ErrOrderExpired
+		}
+
+		if order.OrderStatus == orderstate.PendingPayment {
+			if order.Channel == channel {
+				return nil
+			}
+			return tx.Model(order).Update("channel", channel).Error
+		}
+		return TransitionOrder(tx, order, orderstate.PendingPayment, meta, map[string]interface{}{
+			"channel": channel,
+		})
+	})
+	if err != nil {
+		return nil, err
 	}
-	return result.RowsAffected > 0, nil
+	order.Channel = channel
+	return order, nil
 }
 
 func GetOrderPayExistsByOrderNo(gameOrderNo string) (bool, error) {
@@ -173,8 +305,65 @@ func GetOrderPayExistsByOrderNo(gameOrderNo string) (bool, error) {
 	return result.RowsAffected > 0, nil
 }
 
-func GetOrderPayByUserId(userId string, item string) (*GameOrderPay, error) {
-	var orderPay GameOrderPay
-	result := DB.Where("user_id = ? AND item = ? AND game_order_no != '' ", userId, item).First(&orderPay)
-	return &orderPay, result.Error
+// PayOrder 在同一事务中锁定订单、写入支付记录并将订单改为已支付。
+// 订单已存在同一平台单号的支付记录时视为重复回调，pay 会被替换为原记录且 duplicate 为 true。
+func PayOrder(pay *GameOrderPay, meta orderstate.Meta) (duplicate bool, err error) {
+	err = withMeta(meta).Transaction(func(tx *gorm.DB) error {
+		// 锁定订单行，串行化同一订单的并发回调
+		order, err := lockOrder(tx, "`order` = ?", pay.GameOrderNo)
+		if err != nil {
+			return err
+		}
+
+		// 已有支付记录则按重复回调处理
+		var existing GameOrderPay
+		result := tx.Where("game_order_no = ?", pay.GameOrderNo).Limit(1).Find(&existing)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			if existing.GyyxOrderNo != pay.GyyxOrderNo {
+				return ErrOrderPaidConflict
+			}
+			*pay = existing
+			duplicate = true
+			return nil
+		}
+
+		// 过期后才到达的支付交由人工审核
+		if order.OrderStatus == orderstate.Expired {
+			return ErrOrderExpired
+		}
+		if !orderstate.CanTransition(order.OrderStatus, orderstate.Paid) {
+			return ErrOrderNotPayable
+		}
+		// 回调金额需与订单总价一致
+		if !order.TotalPrice.Equal(pay.RmbYuan) {
+			return ErrAmountMismatch
+		}
+
+		pay.UserId = order.UserId
+		pay.ItemId = order.ItemId
+		pay.Item = order.Item
+		if err := tx.Create(pay).Error; err != nil {
+			return err
+		}
+
+		// 以实际付款的渠道为准，未经提交支付直接在其他渠道付款时同步订单渠道，
+		// 退款按支付记录的渠道提交和校验
+		var extra map[string]interface{}
+		if pay.Channel != "" && pay.Channel != order.Channel {
+			extra = map[string]interface{}{"channel": pay.Channel}
+		}
+		if err := TransitionOrder(tx, order, orderstate.Paid, meta, extra); err != nil {
+			return err
+		}
+		if extra != nil {
+			order.Channel = pay.Channel
+		}
+
+		// 发货通知与支付结果一起提交，由投递任务异步推送给游戏服务器
+		return enqueueDelivery(tx, order)
+	})
+	return duplicate, err
 }
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+// TryAdvisoryLock 尝试获取 MySQL 命名锁（GET_LOCK），用于多实例间互斥执行后台任务。
+// 获取成功时需调用 release 释放锁并归还连接。
+func TryAdvisoryLock(ctx context.Context, name string) (release func(), ok bool, err error) {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return nil, false, err
+	}
+
+	// 命名锁与连接绑定，必须独占一个连接
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var got sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", name).Scan(&got); err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+	if !got.Valid || got.Int64 != 1 {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	release = func() {
+		conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", name)
+		conn.Close()
+	}
+	return release, true, nil
+}
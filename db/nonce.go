@@ -0,0 +1,40 @@
+package db
+
+import (
+	"sync"
+	"time"
+)
+
+// 未连接 Redis 时使用进程内缓存，仅适用于单实例部署
+var localNonces = struct {
+	sync.Mutex
+	items   map[string]time.Time
+	checked time.Time
+}{items: make(map[string]time.Time)}
+
+// UseNonce 记录一次性随机串，ttl 内重复使用返回 false
+func UseNonce(key string, ttl time.Duration) (bool, error) {
+	if RedisClient != nil {
+		return RedisClient.SetNX(Ctx, "api-pay:nonce:"+key, 1, ttl).Result()
+	}
+
+	localNonces.Lock()
+	defer localNonces.Unlock()
+
+	now := time.Now()
+	// 每分钟清理一次过期记录
+	if now.Sub(localNonces.checked) > time.Minute {
+		for k, expireAt := range localNonces.items {
+			if now.After(expireAt) {
+				delete(localNonces.items, k)
+			}
+		}
+		localNonces.checked = now
+	}
+
+	if expireAt, ok := localNonces.items[key]; ok && now.Before(expireAt) {
+		return false, nil
+	}
+	localNonces.items[key] = now.Add(ttl)
+	return true, nil
+}
@@ -0,0 +1,40 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"api-pay/db"
+	"api-pay/db/dbtest"
+)
+
+func TestUseNonce(t *testing.T) {
+	// 与限流相同，Redis 不可用时退化为进程内缓存
+	for _, backend := range rateLimitBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			backend.setup(t)
+			key := backendKey(t)
+
+			if fresh, err := db.UseNonce(key, 50*time.Millisecond); err != nil || !fresh {
+				t.Fatalf("first use = %v, %v", fresh, err)
+			}
+			if fresh, err := db.UseNonce(key, 50*time.Millisecond); err != nil || fresh {
+				t.Fatalf("replay = %v, %v", fresh, err)
+			}
+			if fresh, _ := db.UseNonce(key+":other", 50*time.Millisecond); !fresh {
+				t.Fatal("other nonce rejected")
+			}
+		})
+	}
+}
+
+func TestUseNonceExpires(t *testing.T) {
+	server := dbtest.Redis(t)
+	if fresh, _ := db.UseNonce("n1", time.Minute); !fresh {
+		t.Fatal("first use rejected")
+	}
+	server.FastForward(time.Minute + time.Second)
+	if fresh, _ := db.UseNonce("n1", time.Minute); !fresh {
+		t.Fatal("nonce not released after ttl")
+	}
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	config "api-pay/config"
+	"api-pay/money"
+	"api-pay/orderstate"
+
+	"gorm.io/gorm"
+)
+
+// GameOrderReview 需要人工审核的支付（如订单过期后才到达的回调）
+type GameOrderReview struct {
+	ID          uint        `gorm:"primaryKey;comment:主键ID"`                                             // 主键ID
+	GameOrderNo string      `gorm:"size:255;uniqueIndex:idx_review_order;comment:游戏订单号"`                 // 游戏订单号
+	GyyxOrderNo string      `gorm:"size:255;uniqueIndex:idx_review_order;comment:平台订单号"`                 // 平台订单号
+	RmbYuan     money.Money `gorm:"column:rmb_yuan_minor;type:bigint;not null;default:0;comment:金额，单位分"` // 金额
+	ServerFlag  string      `gorm:"size:100;comment:服务器标识"`                                              // 服务器标识
+	Reason      string      `gorm:"size:255;comment:转审核原因"`                                              // 转审核原因
+	Status      string      `gorm:"size:50;default:pending;comment:审核状态 pending resolved"`               // 审核状态
+	TraceID     string      `gorm:"size:64;comment:请求追踪ID"`                                              // 请求追踪ID
+	CreatedAt   time.Time   `gorm:"autoCreateTime;comment:创建时间"`                                         // 创建时间
+	UpdatedAt   time.Time   `gorm:"autoUpdateTime;comment:更新时间"`                                         // 更新时间
+}
+
+// ExpireOrders 将创建时间早于 cutoff 的未支付订单置为已过期，返回成功过期的数量。
+// 每个订单都是条件更新，多实例同时执行也不会重复迁移。
+func ExpireOrders(cutoff time.Time, limit int, meta orderstate.Meta) (int, error) {
+	var orders []GameOrder
+	if err := withMeta(meta).Where("order_status IN ? AND created_at < ?", orderstate.Unpaid(), cutoff).
+		Order("id").Limit(limit).Find(&orders).Error; err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for i := range orders {
+		err := TransitionOrder(withMeta(meta), &orders[i], orderstate.Expired, meta, nil)
+		if err != nil {
+			// 已被其他实例或回调处理
+			if errors.Is(err, orderstate.ErrStateChanged) {
+				continue
+			}
+			return expired, err
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+// CreateOrderReview 记录待审核的支付，同一订单号和平台单号只记录一次
+func CreateOrderReview(review *GameOrderReview) error {
+	return DB.Where(GameOrderReview{GameOrderNo: review.GameOrderNo, GyyxOrderNo: review.GyyxOrderNo}).
+		FirstOrCreate(review).Error
+}
+
+// unpaidScope 仅查询未支付且未过期的订单
+func unpaidScope(db *gorm.DB) *gorm.DB {
+	db = db.Where("order_status IN ?", orderstate.Unpaid())
+	if cutoff, ok := orderExpiryCutoff(); ok {
+		db = db.Where("created_at >= ?", cutoff)
+	}
+	return db
+}
+
+// orderExpiryCutoff 未支付订单的过期时间点，未配置有效期时返回 false
+func orderExpiryCutoff() (time.Time, bool) {
+	ttl := config.OrderTTL()
+	if ttl <= 0 {
+		return time.Time{}, false
+	}
+	return time.Now().Add(-ttl), true
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-pay/orderstate"
+
+	"gorm.io/gorm"
+)
+
+// OrderFilter 订单列表筛选条件
+type OrderFilter struct {
+	UserId     string
+	AppKey     string // 非空时只查询该客户端创建的订单及历史订单
+	Item       string
+	ServerFlag string
+	Status     *orderstate.State
+	StartTime  *time.Time
+	EndTime    *time.Time
+	Cursor     int64 // 上一页最后一个订单的雪花ID，0 表示第一页
+	Limit      int
+}
+
+// BeforeCreate 写入订单前解析订单号中的雪花ID，未支付订单写入唯一键
+func (o *GameOrder) BeforeCreate(tx *gorm.DB) error {
+	if o.OrderSeq == 0 {
+		o.OrderSeq = ParseOrderSeq(o.Order)
+	}
+	if o.ActiveKey == nil && slices.Contains(orderstate.Unpaid(), o.OrderStatus) {
+		key := activeOrderKey(o)
+		o.ActiveKey = &key
+	}
+	return nil
+}
+
+// ParseOrderSeq 解析订单号（如 811-107552442731859968）中的雪花ID，无法解析时返回 0
+func ParseOrderSeq(orderNo string) int64 {
+	idx := strings.LastIndex(orderNo, "-")
+	seq, err := strconv.ParseInt(orderNo[idx+1:], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return seq
+}
+
+// ListOrders 按雪花ID倒序游标分页查询订单
+func ListOrders(filter OrderFilter) ([]GameOrder, error) {
+	query := DB.Model(&GameOrder{})
+	if filter.UserId != "" {
+		query = query.Where("user_id = ?", filter.UserId)
+	}
+	if filter.AppKey != "" {
+		query = query.Where("app_key IN ?", []string{filter.AppKey, ""})
+	}
+	if filter.Item != "" {
+		query = query.Where("item = ?", filter.Item)
+	}
+	if filter.ServerFlag != "" {
+		query = query.Where("server_flag = ?", filter.ServerFlag)
+	}
+	if filter.Status != nil {
+		query = query.Where("order_status = ?", *filter.Status)
+	}
+	if filter.StartTime != nil {
+		query = query.Where("created_at >= ?", *filter.StartTime)
+	}
+	if filter.EndTime != nil {
+		query = query.Where("created_at < ?", *filter.EndTime)
+	}
+	if filter.Cursor > 0 {
+		query = query.Where("order_seq < ?", filter.Cursor)
+	}
+
+	var orders []GameOrder
+	err := query.Order("order_seq desc").Limit(filter.Limit).Find(&orders).Error
+	return orders, err
+}
+
+// GetOrderPaysByOrderNos 批量查询订单的支付记录，按订单号索引
+func GetOrderPaysByOrderNos(orderNos []string) (map[string]*GameOrderPay, error) {
+	pays := make(map[string]*GameOrderPay, len(orderNos))
+	if len(orderNos) == 0 {
+		return pays, nil
+	}
+
+	var list []GameOrderPay
+	if err := DB.Where("game_order_no IN ?", orderNos).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	for i := range list {
+		pays[list[i].GameOrderNo] = &list[i]
+	}
+	return pays, nil
+}
+
+// GetOrderPayByOrderNo 查询订单的支付记录，未支付时返回 nil
+func GetOrderPayByOrderNo(orderNo string) (*GameOrderPay, error) {
+	var pay GameOrderPay
+	if err := DB.Where("game_order_no = ?", orderNo).First(&pay).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &pay, nil
+}
+
+// GetOrderRefunds 查询订单的退款记录
+func GetOrderRefunds(orderNo string) ([]GameOrderRefund, error) {
+	var refunds []GameOrderRefund
+	err := DB.Where("game_order_no = ?", orderNo).Order("id").Find(&refunds).Error
+	return refunds, err
+}
+
+// GetOrderDelivery 查询订单的发货投递记录，没有时返回 nil
+func GetOrderDelivery(orderNo string) (*GameOrderDelivery, error) {
+	var delivery GameOrderDelivery
+	if err := DB.Where("game_order_no = ?", orderNo).First(&delivery).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// GetOrderEvents 查询订单的状态变更记录
+func GetOrderEvents(orderNo string) ([]GameOrderEvent, error) {
+	var events []GameOrderEvent
+	err := DB.Where("`order` = ?", orderNo).Order("id").Find(&events).Error
+	return events, err
+}
+
+// ListOrdersToQuery 查询需要向平台查单的未支付订单：ID 大于 afterID，创建时间早于 before，
+// 且从未查过或上次查单早于 before
+func ListOrdersToQuery(before time.Time, afterID uint, limit int) ([]GameOrder, error) {
+	var orders []GameOrder
+	err := DB.Where("id > ? AND order_status IN ? AND created_at < ?", afterID, orderstate.Unpaid(), before).
+		Where("queried_at IS NULL OR queried_at < ?", before).
+		Order("id").Limit(limit).Find(&orders).Error
+	return orders, err
+}
+
+// MarkOrderQueried 记录订单的查单时间
+func MarkOrderQueried(id uint) error {
+	return DB.Model(&GameOrder{}).Where("id = ?", id).Update("queried_at", time.Now()).Error
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"api-pay/orderstate"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GameOrderEvent 订单状态变更记录
+type GameOrderEvent struct {
+	ID         uint             `gorm:"primaryKey;comment:主键ID"`      // 主键ID
+	Order      string           `gorm:"size:255;index;comment:游戏订单号"` // 游戏订单号
+	FromStatus orderstate.State `gorm:"type:int;comment:变更前状态"`       // 变更前状态
+	ToStatus   orderstate.State `gorm:"type:int;comment:变更后状态"`       // 变更后状态
+	Actor      string           `gorm:"size:50;comment:操作方"`          // 操作方
+	Reason     string           `gorm:"size:255;comment:变更原因"`        // 变更原因
+	TraceID    string           `gorm:"size:64;index;comment:请求追踪ID"` // 请求追踪ID
+	CreatedAt  time.Time        `gorm:"autoCreateTime;comment:创建时间"`  // 创建时间
+}
+
+// TransitionOrder 将订单迁移到 to 状态并写入变更记录。
+// 使用 order_status 作为更新条件，并发时只有一个迁移能成功，其余返回 ErrStateChanged。
+func TransitionOrder(tx *gorm.DB, order *GameOrder, to orderstate.State, meta orderstate.Meta, extra map[string]interface{}) error {
+	from := order.OrderStatus
+	if err := orderstate.Check(from, to); err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{"order_status": to}
+	// 离开未支付状态后释放唯一键，允许重新下单
+	leavesUnpaid := !slices.Contains(orderstate.Unpaid(), to)
+	if leavesUnpaid {
+		updates["active_key"] = nil
+	}
+	for k, v := range extra {
+		updates[k] = v
+	}
+
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if from == to {
+			// 状态不变（如多次部分退款）时 UPDATE 不改变任何列，MySQL 返回的影响行数为 0，
+			// 改为确认订单仍处于该状态，只写变更记录
+			if err := checkOrderState(tx, order, from); err != nil {
+				return err
+			}
+			if len(extra) > 0 {
+				if err := tx.Model(&GameOrder{}).Where("id = ?", order.ID).Updates(extra).Error; err != nil {
+					return err
+				}
+			}
+		} else {
+			result := tx.Model(&GameOrder{}).Where("id = ? AND order_status = ?", order.ID, from).Updates(updates)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return orderstate.ErrStateChanged
+			}
+		}
+
+		event := GameOrderEvent{
+			Order:      order.Order,
+			FromStatus: from,
+			ToStatus:   to,
+			Actor:      meta.Actor,
+			Reason:     meta.Reason,
+			TraceID:    meta.TraceID,
+		}
+		if err := tx.Create(&event).Error; err != nil {
+			return err
+		}
+
+		// 未支付订单关闭时归还库存
+		if to == orderstate.Cancelled || to == orderstate.Expired {
+			if err := releaseStock(tx, order); err != nil {
+				return err
+			}
+		}
+
+		order.OrderStatus = to
+		if leavesUnpaid {
+			order.ActiveKey = nil
+		}
+		return nil
+	})
+}
+
+// checkOrderState 确认订单当前仍处于 state，否则返回 ErrStateChanged
+func checkOrderState(tx *gorm.DB, order *GameOrder, state orderstate.State) error {
+	var count int64
+	if err := tx.Model(&GameOrder{}).Where("id = ? AND order_status = ?", order.ID, state).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return orderstate.ErrStateChanged
+	}
+	return nil
+}
+
+// withMeta 带上操作的上下文，使数据库 span 挂在请求链路下
+func withMeta(meta orderstate.Meta) *gorm.DB {
+	return DB.WithContext(meta.Context())
+}
+
+// lockOrder 以 FOR UPDATE 锁定并返回订单
+func lockOrder(tx *gorm.DB, query string, args ...interface{}) (*GameOrder, error) {
+	var order GameOrder
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(query, args...).First(&order).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+	return &order, nil
+}
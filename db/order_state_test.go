@@ -0,0 +1,151 @@
+package db_test
+
+import (
+	"errors"
+	"testing"
+
+	"api-pay/db"
+	"api-pay/db/dbtest"
+	"api-pay/orderstate"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestTransitionOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		stored  orderstate.State // 数据库中的状态
+		from    orderstate.State // 调用方读到的状态
+		to      orderstate.State
+		wantErr error
+	}{
+		{name: "pay", stored: orderstate.Created, from: orderstate.Created, to: orderstate.Paid},
+		{name: "cancel", stored: orderstate.PendingPayment, from: orderstate.PendingPayment, to: orderstate.Cancelled},
+		{name: "partial refund again", stored: orderstate.PartiallyRefunded, from: orderstate.PartiallyRefunded, to: orderstate.PartiallyRefunded},
+		{name: "illegal", stored: orderstate.Created, from: orderstate.Created, to: orderstate.Delivered, wantErr: orderstate.ErrIllegalTransition},
+		{name: "changed concurrently", stored: orderstate.Paid, from: orderstate.Created, to: orderstate.Cancelled, wantErr: orderstate.ErrStateChanged},
+		{name: "self transition changed", stored: orderstate.Refunded, from: orderstate.PartiallyRefunded, to: orderstate.PartiallyRefunded, wantErr: orderstate.ErrStateChanged},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbtest.Open(t)
+			order := createOrder(t, "812-1", 1000)
+			if err := db.DB.Model(order).Update("order_status", tt.stored).Error; err != nil {
+				t.Fatal(err)
+			}
+			order.OrderStatus = tt.from
+
+			err := db.TransitionOrder(db.DB, order, tt.to, testMeta, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("TransitionOrder = %v, want %v", err, tt.wantErr)
+			}
+
+			events, err2 := db.GetOrderEvents("812-1")
+			if err2 != nil {
+				t.Fatal(err2)
+			}
+			if err != nil {
+				if len(events) != 0 || orderStatus(t, "812-1") != tt.stored {
+					t.Errorf("failed transition changed the order: status %s, %d events", orderStatus(t, "812-1"), len(events))
+				}
+				return
+			}
+			if got := orderStatus(t, "812-1"); got != tt.to || order.OrderStatus != tt.to {
+				t.Errorf("status = %s (in memory %s), want %s", got, order.OrderStatus, tt.to)
+			}
+			if len(events) != 1 || events[0].FromStatus != tt.from || events[0].ToStatus != tt.to || events[0].Actor != testMeta.Actor {
+				t.Errorf("events = %+v", events)
+			}
+		})
+	}
+}
+
+func TestTransitionOrderReleasesActiveKey(t *testing.T) {
+	dbtest.Open(t)
+	order := createOrder(t, "812-1", 1000)
+	if order.ActiveKey == nil {
+		t.Fatal("unpaid order has no active key")
+	}
+
+	if err := db.TransitionOrder(db.DB, order, orderstate.PendingPayment, testMeta, nil); err != nil {
+		t.Fatal(err)
+	}
+	if order.ActiveKey == nil {
+		t.Error("active key released while still unpaid")
+	}
+
+	if err := db.TransitionOrder(db.DB, order, orderstate.Cancelled, testMeta, nil); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := db.GetOrderByNo("812-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.ActiveKey != nil || stored.ActiveKey != nil {
+		t.Errorf("active key not released: %v / %v", order.ActiveKey, stored.ActiveKey)
+	}
+	// 释放后可以再下同样的订单
+	createOrder(t, "812-2", 1000)
+}
+
+// mockMySQL 用 sqlmock 模拟 MySQL，按 MySQL 的影响行数语义验证条件更新
+func mockMySQL(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gdb, err := gorm.Open(mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true}), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := db.DB
+	db.DB = gdb
+	t.Cleanup(func() {
+		db.DB = saved
+		conn.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return mock
+}
+
+func TestTransitionOrderMySQL(t *testing.T) {
+	t.Run("no rows affected", func(t *testing.T) {
+		mock := mockMySQL(t)
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `game_orders` SET .* WHERE id = \\? AND order_status = \\?").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		order := &db.GameOrder{ID: 1, Order: "812-1", OrderStatus: orderstate.Created}
+		if err := db.TransitionOrder(db.DB, order, orderstate.Paid, testMeta, nil); !errors.Is(err, orderstate.ErrStateChanged) {
+			t.Fatalf("TransitionOrder = %v, want ErrStateChanged", err)
+		}
+		if order.OrderStatus != orderstate.Created {
+			t.Errorf("in-memory status changed to %s", order.OrderStatus)
+		}
+	})
+
+	t.Run("self transition", func(t *testing.T) {
+		// MySQL 对值未变的 UPDATE 返回影响行数 0，状态不变时改为查询确认，不执行 UPDATE
+		mock := mockMySQL(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM `game_orders` WHERE id = \\? AND order_status = \\?").
+			WithArgs(1, orderstate.PartiallyRefunded).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectExec("INSERT INTO `game_order_events`").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		order := &db.GameOrder{ID: 1, Order: "812-1", OrderStatus: orderstate.PartiallyRefunded}
+		if err := db.TransitionOrder(db.DB, order, orderstate.PartiallyRefunded, testMeta, nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
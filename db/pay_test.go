@@ -0,0 +1,103 @@
+package db_test
+
+import (
+	"errors"
+	"testing"
+
+	"api-pay/db"
+	"api-pay/db/dbtest"
+	"api-pay/money"
+	"api-pay/orderstate"
+)
+
+func TestPayOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		prepare  func(t *testing.T) // 在 811-1（总价 10 元）上预先执行
+		order    string
+		platform string
+		amount   int64
+		wantErr  error
+		wantDup  bool
+		wantPays int64 // 执行后 811-1 的支付记录数
+	}{
+		{name: "paid", order: "811-1", platform: "P1", amount: 1000, wantPays: 1},
+		{name: "amount mismatch", order: "811-1", platform: "P1", amount: 999, wantErr: db.ErrAmountMismatch},
+		{name: "unit price only", order: "811-1", platform: "P1", amount: 500, wantErr: db.ErrAmountMismatch},
+		{name: "order not found", order: "811-9", platform: "P1", amount: 1000, wantErr: db.ErrOrderNotFound},
+		{
+			name:     "duplicate callback",
+			prepare:  func(t *testing.T) { payOrder(t, "811-1", "feizhu", 1000) },
+			order:    "811-1",
+			platform: "P-811-1",
+			amount:   1000,
+			wantDup:  true,
+			wantPays: 1,
+		},
+		{
+			name:     "paid by another trade",
+			prepare:  func(t *testing.T) { payOrder(t, "811-1", "feizhu", 1000) },
+			order:    "811-1",
+			platform: "P2",
+			amount:   1000,
+			wantErr:  db.ErrOrderPaidConflict,
+			wantPays: 1,
+		},
+		{
+			name: "cancelled",
+			prepare: func(t *testing.T) {
+				if _, err := db.CancelOrder("u1", "811-1", "", testMeta); err != nil {
+					t.Fatal(err)
+				}
+			},
+			order:    "811-1",
+			platform: "P1",
+			amount:   1000,
+			wantErr:  db.ErrOrderNotPayable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbtest.Open(t)
+			createOrder(t, "811-1", 1000)
+			if tt.prepare != nil {
+				tt.prepare(t)
+			}
+
+			pay := db.GameOrderPay{GameOrderNo: tt.order, GyyxOrderNo: tt.platform, Channel: "feizhu", RmbYuan: money.FromMinor(tt.amount)}
+			duplicate, err := db.PayOrder(&pay, testMeta)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("PayOrder = %v, want %v", err, tt.wantErr)
+			}
+			if duplicate != tt.wantDup {
+				t.Errorf("duplicate = %v, want %v", duplicate, tt.wantDup)
+			}
+			// 失败或重复回调不产生新的支付记录
+			var pays int64
+			db.DB.Model(&db.GameOrderPay{}).Where("game_order_no = ?", "811-1").Count(&pays)
+			if pays != tt.wantPays {
+				t.Errorf("pay records = %d, want %d", pays, tt.wantPays)
+			}
+			if err != nil || tt.wantDup {
+				return
+			}
+
+			if got := orderStatus(t, "811-1"); got != orderstate.Paid {
+				t.Errorf("status = %s, want paid", got)
+			}
+			if pay.UserId != "u1" || pay.Item != "gem" {
+				t.Errorf("pay not filled from order: %+v", pay)
+			}
+			if _, err := db.GetOrderDelivery("811-1"); err != nil {
+				t.Errorf("delivery not enqueued: %v", err)
+			}
+			events, err := db.GetOrderEvents("811-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != 1 || events[0].ToStatus != orderstate.Paid {
+				t.Errorf("events = %+v", events)
+			}
+		})
+	}
+}
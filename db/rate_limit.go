@@ -0,0 +1,123 @@
+package db
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// RateLimit 一条限流规则的计数 key 及额度
+type RateLimit struct {
+	Key    string
+	Limit  int
+	Window time.Duration
+}
+
+// slidingWindowScript 滑动窗口限流：每个 key 的有序集合保存窗口内每次请求的时间（毫秒）。
+// ARGV 为当前时间、本次请求的成员，之后按 KEYS 顺序依次为窗口和额度。
+// 先检查全部 key，都未超限时才在全部 key 上记录本次请求并返回 0，
+// 否则不记录，返回超限的 key 中最久需要等待的毫秒数
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local wait = 0
+for i, key in ipairs(KEYS) do
+	local window = tonumber(ARGV[i * 2 + 1])
+	local limit = tonumber(ARGV[i * 2 + 2])
+	redis.call('ZREMRANGEBYSCORE', key, 0, now - window)
+	if redis.call('ZCARD', key) >= limit then
+		local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+		wait = math.max(wait, tonumber(oldest[2]) + window - now, 1)
+	end
+end
+if wait > 0 then
+	return wait
+end
+for i, key in ipairs(KEYS) do
+	redis.call('ZADD', key, now, ARGV[2])
+	redis.call('PEXPIRE', key, tonumber(ARGV[i * 2 + 1]))
+end
+return 0
+`)
+
+// AllowRequest 按滑动窗口判断请求是否超过 limits 中的任一额度，全部未超限时才计入本次请求，
+// 超限时返回需要等待的时间。Redis 未连接或出错时退化为进程内限流。
+func AllowRequest(limits []RateLimit) (bool, time.Duration) {
+	if len(limits) == 0 {
+		return true, 0
+	}
+	now := time.Now()
+	if RedisClient != nil {
+		keys := make([]string, len(limits))
+		args := []interface{}{now.UnixMilli(), uuid.NewString()}
+		for i, l := range limits {
+			keys[i] = "api-pay:ratelimit:" + l.Key
+			args = append(args, l.Window.Milliseconds(), l.Limit)
+		}
+		wait, err := slidingWindowScript.Run(Ctx, RedisClient, keys, args...).Int64()
+		if err == nil {
+			return wait <= 0, time.Duration(wait) * time.Millisecond
+		}
+	}
+	return localLimiter.allow(limits, now)
+}
+
+// localLimiter 进程内滑动窗口，仅保证单实例内的限流
+var localLimiter = &slidingWindow{hits: make(map[string]*windowHits)}
+
+type slidingWindow struct {
+	mu      sync.Mutex
+	hits    map[string]*windowHits
+	checked time.Time
+}
+
+// windowHits 一个 key 在窗口内的请求时间，window 为该 key 所属规则的窗口
+type windowHits struct {
+	times  []time.Time
+	window time.Duration
+}
+
+func (w *slidingWindow) allow(limits []RateLimit, now time.Time) (bool, time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// 每分钟按各 key 自己的窗口清理一次不再活跃的 key
+	if now.Sub(w.checked) > time.Minute {
+		for k, hits := range w.hits {
+			if len(hits.times) == 0 || now.Sub(hits.times[len(hits.times)-1]) >= hits.window {
+				delete(w.hits, k)
+			}
+		}
+		w.checked = now
+	}
+
+	var wait time.Duration
+	entries := make([]*windowHits, len(limits))
+	for i, l := range limits {
+		hits := w.hits[l.Key]
+		if hits == nil {
+			hits = &windowHits{}
+			w.hits[l.Key] = hits
+		}
+		hits.window = l.Window
+
+		start := 0
+		for start < len(hits.times) && now.Sub(hits.times[start]) >= l.Window {
+			start++
+		}
+		hits.times = hits.times[start:]
+		if len(hits.times) >= l.Limit {
+			wait = max(wait, hits.times[0].Add(l.Window).Sub(now))
+		}
+		entries[i] = hits
+	}
+	if wait > 0 {
+		return false, wait
+	}
+
+	for _, hits := range entries {
+		hits.times = append(hits.times, now)
+	}
+	return true, 0
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocalLimiterCleanupUsesRuleWindow(t *testing.T) {
+	w := &slidingWindow{hits: make(map[string]*windowHits)}
+	long := RateLimit{Key: "long", Limit: 1, Window: 10 * time.Minute}
+	short := RateLimit{Key: "short", Limit: 1, Window: time.Second}
+
+	now := time.Now()
+	w.checked = now
+	if ok, _ := w.allow([]RateLimit{long}, now); !ok {
+		t.Fatal("first request rejected")
+	}
+
+	// 其他规则触发清理时，按 long 自己的窗口判断是否过期
+	later := now.Add(2 * time.Minute)
+	if ok, _ := w.allow([]RateLimit{short}, later); !ok {
+		t.Fatal("short request rejected")
+	}
+	if _, ok := w.hits["long"]; !ok {
+		t.Fatal("active key removed by cleanup")
+	}
+	ok, wait := w.allow([]RateLimit{long}, later)
+	if ok {
+		t.Fatal("request within long window allowed")
+	}
+	if want := 8 * time.Minute; wait != want {
+		t.Fatalf("wait = %v, want %v", wait, want)
+	}
+
+	// 超过各自窗口后清理
+	w.allow(nil, now.Add(11*time.Minute))
+	if len(w.hits) != 0 {
+		t.Fatalf("expired keys kept: %v", w.hits)
+	}
+}
@@ -0,0 +1,80 @@
+package db_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"api-pay/db"
+	"api-pay/db/dbtest"
+)
+
+// rateLimitBackends Redis 和 Redis 不可用时的进程内限流
+var rateLimitBackends = []struct {
+	name  string
+	setup func(t *testing.T)
+}{
+	{"redis", func(t *testing.T) { dbtest.Redis(t) }},
+	{"local", func(t *testing.T) {
+		saved := db.RedisClient
+		db.RedisClient = nil
+		t.Cleanup(func() { db.RedisClient = saved })
+	}},
+}
+
+// backendKey 进程内状态在重复执行（-count）间保留，key 按用例和执行次数区分
+func backendKey(t *testing.T) string {
+	return fmt.Sprintf("%s:%d", t.Name(), time.Now().UnixNano())
+}
+
+func TestAllowRequest(t *testing.T) {
+	for _, backend := range rateLimitBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			backend.setup(t)
+			key := backendKey(t)
+			strict := db.RateLimit{Key: key + ":strict", Limit: 2, Window: time.Minute}
+			loose := db.RateLimit{Key: key + ":loose", Limit: 3, Window: time.Minute}
+
+			for i := 0; i < 2; i++ {
+				if ok, _ := db.AllowRequest([]db.RateLimit{strict, loose}); !ok {
+					t.Fatalf("request %d rejected", i+1)
+				}
+			}
+			ok, wait := db.AllowRequest([]db.RateLimit{strict, loose})
+			if ok {
+				t.Fatal("request over strict limit allowed")
+			}
+			if wait <= 0 || wait > time.Minute {
+				t.Fatalf("wait = %v", wait)
+			}
+
+			// 被拒绝的请求不占用其他规则的额度
+			if ok, _ := db.AllowRequest([]db.RateLimit{loose}); !ok {
+				t.Fatal("loose limit consumed by rejected request")
+			}
+			if ok, _ := db.AllowRequest([]db.RateLimit{loose}); ok {
+				t.Fatal("request over loose limit allowed")
+			}
+		})
+	}
+}
+
+func TestAllowRequestWindow(t *testing.T) {
+	for _, backend := range rateLimitBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			backend.setup(t)
+			limit := db.RateLimit{Key: backendKey(t), Limit: 1, Window: 50 * time.Millisecond}
+
+			if ok, _ := db.AllowRequest([]db.RateLimit{limit}); !ok {
+				t.Fatal("first request rejected")
+			}
+			if ok, _ := db.AllowRequest([]db.RateLimit{limit}); ok {
+				t.Fatal("second request within window allowed")
+			}
+			time.Sleep(60 * time.Millisecond)
+			if ok, _ := db.AllowRequest([]db.RateLimit{limit}); !ok {
+				t.Fatal("request after window rejected")
+			}
+		})
+	}
+}
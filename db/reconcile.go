@@ -0,0 +1,97 @@
+package db
+
+import (
+	"time"
+
+	"api-pay/money"
+
+	"gorm.io/gorm"
+)
+
+// 对账结果
+const (
+	ReconcileMatched         = "matched"           // 平台与本地一致
+	ReconcileMissingLocal    = "missing_local"     // 平台有记录，本地没有支付记录
+	ReconcileMissingRemote   = "missing_remote"    // 本地有支付记录，平台结算文件中没有
+	ReconcileAmountMismatch  = "amount_mismatch"   // 双方都有记录但金额不一致
+	ReconcileOrderNoMismatch = "order_no_mismatch" // 同一游戏订单双方的平台订单号不一致
+)
+
+// GameReconciliation 对账明细，按对账日期保存，重新对账时整体替换
+type GameReconciliation struct {
+	ID           uint        `gorm:"primaryKey;comment:主键ID"`                                                    // 主键ID
+	BillDate     string      `gorm:"size:10;not null;index:idx_reconcile_date_status;comment:对账日期"`              // 对账日期
+	Status       string      `gorm:"size:32;not null;index:idx_reconcile_date_status;comment:对账结果"`              // 对账结果
+	GameOrderNo  string      `gorm:"size:255;index;comment:游戏订单号"`                                               // 游戏订单号
+	GyyxOrderNo  string      `gorm:"size:255;comment:平台订单号"`                                                     // 平台订单号
+	LocalAmount  money.Money `gorm:"column:local_amount_minor;type:bigint;not null;default:0;comment:本地金额，单位分"`  // 本地金额
+	RemoteAmount money.Money `gorm:"column:remote_amount_minor;type:bigint;not null;default:0;comment:平台金额，单位分"` // 平台金额
+	ServerFlag   string      `gorm:"size:100;comment:服务器标识"`                                                     // 服务器标识
+	SourceFile   string      `gorm:"size:255;comment:结算文件"`                                                      // 结算文件
+	Message      string      `gorm:"size:255;comment:说明"`                                                        // 说明
+	CreatedAt    time.Time   `gorm:"autoCreateTime;comment:创建时间"`                                                // 创建时间
+}
+
+// GetOrderPaysBetween 查询时间范围内的支付记录 [start, end)
+func GetOrderPaysBetween(start, end time.Time) ([]GameOrderPay, error) {
+	var pays []GameOrderPay
+	err := DB.Where("created_at >= ? AND created_at < ?", start, end).Order("id").Find(&pays).Error
+	return pays, err
+}
+
+// SaveReconciliation 保存某一天的对账结果，覆盖该日期之前的结果
+func SaveReconciliation(billDate string, items []GameReconciliation) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("bill_date = ?", billDate).Delete(&GameReconciliation{}).Error; err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(items, 200).Error
+	})
+}
+
+// CountReconciliation 统计某一天各对账结果的数量
+func CountReconciliation(billDate string) (map[string]int64, error) {
+	var rows []struct {
+		Status string
+		Total  int64
+	}
+	err := DB.Model(&GameReconciliation{}).
+		Select("status, COUNT(*) AS total").
+		Where("bill_date = ?", billDate).
+		Group("status").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int64{
+		ReconcileMatched:        0,
+		ReconcileMissingLocal:   0,
+		ReconcileMissingRemote:  0,
+		ReconcileAmountMismatch: 0,
+	}
+	for _, r := range rows {
+		counts[r.Status] = r.Total
+	}
+	return counts, nil
+}
+
+// ListReconciliation 分页查询对账明细，status 为空时查询全部
+func ListReconciliation(billDate, status string, page, pageSize int) ([]GameReconciliation, int64, error) {
+	query := DB.Model(&GameReconciliation{}).Where("bill_date = ?", billDate)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var items []GameReconciliation
+	err := query.Order("id").Offset((page - 1) * pageSize).Limit(pageSize).Find(&items).Error
+	return items, total, err
+}
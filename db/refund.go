@@ -0,0 +1,188 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"api-pay/money"
+	"api-pay/orderstate"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 退款状态
+const (
+	RefundPending = "pending"
+	RefundSuccess = "success"
+	RefundFailed  = "failed"
+)
+
+var (
+	ErrRefundNotAllowed = errors.New("order is not refundable")
+	ErrRefundAmount     = errors.New("refund amount exceeds refundable amount")
+	ErrRefundNotFound   = errors.New("refund not found")
+	ErrRefundMismatch   = errors.New("refund notify does not match refund")
+)
+
+// RefundResult 平台退款结果
+type RefundResult struct {
+	RefundNo         string
+	Channel          string      // 发出通知的支付渠道，与订单支付记录的渠道不一致时拒绝；为空时不校验
+	GameOrderNo      string      // 为空时不校验
+	Amount           money.Money // 为 0 时不校验
+	Success          bool
+	PlatformRefundNo string
+	Message          string
+}
+
+// GameOrderRefund 退款记录
+type GameOrderRefund struct {
+	ID               uint        `gorm:"primaryKey;comment:主键ID"`                                             // 主键ID
+	RefundNo         string      `gorm:"size:255;uniqueIndex;comment:退款单号"`                                   // 退款单号
+	GameOrderNo      string      `gorm:"size:255;index;comment:游戏订单号"`                                        // 游戏订单号
+	GyyxOrderNo      string      `gorm:"size:255;comment:平台订单号"`                                              // 平台订单号
+	PlatformRefundNo string      `gorm:"size:255;comment:平台退款单号"`                                             // 平台退款单号
+	UserId           string      `gorm:"size:255;not null;comment:用户ID"`                                      // 用户ID
+	Item             string      `gorm:"size:255;comment:商品属性"`                                               // 商品属性
+	ServerFlag       string      `gorm:"size:100;comment:服务器标识"`                                              // 服务器标识
+	Amount           money.Money `gorm:"column:amount_minor;type:bigint;not null;default:0;comment:退款金额，单位分"` // 退款金额
+	Reason           string      `gorm:"size:255;comment:退款原因"`                                               // 退款原因
+	Status           string      `gorm:"size:20;index;comment:退款状态 pending success failed"`                   // 退款状态
+	ResultMessage    string      `gorm:"size:255;comment:平台返回信息"`                                             // 平台返回信息
+	TraceID          string      `gorm:"size:64;comment:请求追踪ID"`                                              // 请求追踪ID
+	FinishedAt       *time.Time  `gorm:"comment:退款完成时间"`                                                      // 退款完成时间
+	CreatedAt        time.Time   `gorm:"autoCreateTime;comment:创建时间"`                                         // 创建时间
+	UpdatedAt        time.Time   `gorm:"autoUpdateTime;comment:更新时间"`                                         // 更新时间
+}
+
+// CreateRefund 为已支付订单创建退款申请，处理中和已成功的退款合计不能超过实付金额
+func CreateRefund(refund *GameOrderRefund) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		order, err := lockOrder(tx, "user_id = ? AND `order` = ?", refund.UserId, refund.GameOrderNo)
+		if err != nil {
+			return err
+		}
+		if !isRefundable(order.OrderStatus) {
+			return ErrRefundNotAllowed
+		}
+
+		var pay GameOrderPay
+		if err := tx.Where("game_order_no = ?", order.Order).First(&pay).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRefundNotAllowed
+			}
+			return err
+		}
+
+		refunded, err := sumRefunds(tx, order.Order, RefundPending, RefundSuccess)
+		if err != nil {
+			return err
+		}
+		if refunded.Minor()+refund.Amount.Minor() > pay.RmbYuan.Minor() {
+			return ErrRefundAmount
+		}
+
+		refund.GyyxOrderNo = pay.GyyxOrderNo
+		refund.Item = order.Item
+		refund.ServerFlag = order.ServerFlag
+		refund.Status = RefundPending
+		return tx.Create(refund).Error
+	})
+}
+
+// CompleteRefund 处理平台的退款结果通知。
+// 退款成功时根据累计退款金额将订单置为部分退款或已退款；已处理过的通知返回 duplicate 为 true。
+func CompleteRefund(result RefundResult, meta orderstate.Meta) (refund *GameOrderRefund, duplicate bool, err error) {
+	refund = &GameOrderRefund{}
+	err = withMeta(meta).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("refund_no = ?", result.RefundNo).First(refund).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRefundNotFound
+			}
+			return err
+		}
+
+		// 先锁订单再锁退款单，与 CreateRefund 的加锁顺序保持一致
+		order, err := lockOrder(tx, "`order` = ?", refund.GameOrderNo)
+		if err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(refund, refund.ID).Error; err != nil {
+			return err
+		}
+		if result.GameOrderNo != "" && result.GameOrderNo != refund.GameOrderNo {
+			return ErrRefundMismatch
+		}
+		if result.Amount.IsPositive() && !result.Amount.Equal(refund.Amount) {
+			return ErrRefundMismatch
+		}
+		// 退款经支付记录的渠道提交，通知需来自同一渠道
+		var pay GameOrderPay
+		if err := tx.Where("game_order_no = ?", order.Order).First(&pay).Error; err != nil {
+			return err
+		}
+		if result.Channel != "" && result.Channel != pay.Channel {
+			return ErrRefundMismatch
+		}
+		if refund.Status != RefundPending {
+			duplicate = true
+			return nil
+		}
+
+		now := time.Now()
+		status := RefundFailed
+		if result.Success {
+			status = RefundSuccess
+		}
+		if err := tx.Model(refund).Updates(map[string]interface{}{
+			"status":             status,
+			"platform_refund_no": result.PlatformRefundNo,
+			"result_message":     result.Message,
+			"finished_at":        &now,
+		}).Error; err != nil {
+			return err
+		}
+		if !result.Success {
+			return nil
+		}
+
+		refunded, err := sumRefunds(tx, order.Order, RefundSuccess)
+		if err != nil {
+			return err
+		}
+
+		target := orderstate.PartiallyRefunded
+		if refunded.Minor() >= pay.RmbYuan.Minor() {
+			target = orderstate.Refunded
+		}
+		return TransitionOrder(tx, order, target, meta, nil)
+	})
+	return refund, duplicate, err
+}
+
+// sumRefunds 统计订单指定状态的退款合计
+func sumRefunds(tx *gorm.DB, orderNo string, statuses ...string) (money.Money, error) {
+	var total int64
+	err := tx.Model(&GameOrderRefund{}).
+		Select("COALESCE(SUM(amount_minor), 0)").
+		Where("game_order_no = ? AND status IN ?", orderNo, statuses).
+		Scan(&total).Error
+	return money.FromMinor(total), err
+}
+
+func isRefundable(status orderstate.State) bool {
+	for _, s := range orderstate.Refundable() {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// SetRefundPlatformNo 记录平台受理退款后返回的退款单号
+func SetRefundPlatformNo(refundNo, platformRefundNo string) error {
+	return DB.Model(&GameOrderRefund{}).
+		Where("refund_no = ? AND status = ?", refundNo, RefundPending).
+		Update("platform_refund_no", platformRefundNo).Error
+}
@@ -0,0 +1,150 @@
+package db_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"api-pay/db"
+	"api-pay/db/dbtest"
+	"api-pay/money"
+	"api-pay/orderstate"
+)
+
+var testMeta = orderstate.Meta{Actor: orderstate.ActorSystem, Reason: "test"}
+
+// createOrder 写入一笔未支付订单
+func createOrder(t *testing.T, orderNo string, total int64) *db.GameOrder {
+	t.Helper()
+	order := &db.GameOrder{
+		UserId:      "u1",
+		Item:        "gem",
+		ItemId:      1,
+		Order:       orderNo,
+		SinglePrice: money.FromMinor(total),
+		TotalPrice:  money.FromMinor(total),
+		AmountNum:   1,
+		ServerFlag:  "s1",
+		Channel:     "feizhu",
+	}
+	if err := db.DB.Create(order).Error; err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+// payOrder 按 channel 的回调支付订单
+func payOrder(t *testing.T, orderNo, channel string, amount int64) {
+	t.Helper()
+	pay := db.GameOrderPay{GameOrderNo: orderNo, GyyxOrderNo: "P-" + orderNo, Channel: channel, RmbYuan: money.FromMinor(amount)}
+	if _, err := db.PayOrder(&pay, testMeta); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func orderStatus(t *testing.T, orderNo string) orderstate.State {
+	t.Helper()
+	order, err := db.GetOrderByNo(orderNo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return order.OrderStatus
+}
+
+func TestRefundFollowsPaymentChannel(t *testing.T) {
+	dbtest.Open(t)
+	createOrder(t, "811-1", 1000)
+	payOrder(t, "811-1", "tiktok", 1000)
+
+	// 在其他渠道付款后订单渠道与支付记录保持一致
+	order, err := db.GetOrderByNo("811-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Channel != "tiktok" {
+		t.Fatalf("order channel = %q, want tiktok", order.Channel)
+	}
+
+	refund := db.GameOrderRefund{RefundNo: "812-1", GameOrderNo: "811-1", UserId: "u1", Amount: money.FromMinor(400)}
+	if err := db.CreateRefund(&refund); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		channel string
+		wantErr error
+	}{
+		{"other channel rejected", "feizhu", db.ErrRefundMismatch},
+		{"paying channel accepted", "tiktok", nil},
+	}
+	for _, tt := range tests {
+		result := db.RefundResult{RefundNo: "812-1", Channel: tt.channel, Success: true}
+		if _, _, err := db.CompleteRefund(result, testMeta); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: CompleteRefund = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+	if got := orderStatus(t, "811-1"); got != orderstate.PartiallyRefunded {
+		t.Errorf("status = %s, want %s", got, orderstate.PartiallyRefunded)
+	}
+}
+
+func TestPartialRefunds(t *testing.T) {
+	dbtest.Open(t)
+	createOrder(t, "814-1", 1000)
+	payOrder(t, "814-1", "feizhu", 1000)
+
+	// 按顺序执行：amount > 0 为申请退款，否则为平台通知 refundNo 的结果
+	steps := []struct {
+		name       string
+		refundNo   string
+		amount     int64
+		success    bool
+		wantErr    error
+		wantDup    bool
+		wantStatus orderstate.State
+	}{
+		{name: "apply 300", refundNo: "R1", amount: 300, wantStatus: orderstate.Paid},
+		{name: "pending counts toward limit", refundNo: "R2", amount: 800, wantErr: db.ErrRefundAmount, wantStatus: orderstate.Paid},
+		{name: "first refund succeeds", refundNo: "R1", success: true, wantStatus: orderstate.PartiallyRefunded},
+		{name: "duplicate notify", refundNo: "R1", success: true, wantDup: true, wantStatus: orderstate.PartiallyRefunded},
+		{name: "apply 200", refundNo: "R2", amount: 200, wantStatus: orderstate.PartiallyRefunded},
+		{name: "second refund fails", refundNo: "R2", wantStatus: orderstate.PartiallyRefunded},
+		{name: "failed refund frees amount", refundNo: "R3", amount: 500, wantStatus: orderstate.PartiallyRefunded},
+		{name: "still partial", refundNo: "R3", success: true, wantStatus: orderstate.PartiallyRefunded},
+		{name: "exceeds remaining", refundNo: "R4", amount: 201, wantErr: db.ErrRefundAmount, wantStatus: orderstate.PartiallyRefunded},
+		{name: "apply remaining", refundNo: "R4", amount: 200, wantStatus: orderstate.PartiallyRefunded},
+		{name: "fully refunded", refundNo: "R4", success: true, wantStatus: orderstate.Refunded},
+		{name: "nothing left", refundNo: "R5", amount: 1, wantErr: db.ErrRefundNotAllowed, wantStatus: orderstate.Refunded},
+	}
+	for _, step := range steps {
+		var err error
+		duplicate := false
+		if step.amount > 0 {
+			refund := db.GameOrderRefund{RefundNo: step.refundNo, GameOrderNo: "814-1", UserId: "u1", Amount: money.FromMinor(step.amount)}
+			err = db.CreateRefund(&refund)
+		} else {
+			_, duplicate, err = db.CompleteRefund(db.RefundResult{RefundNo: step.refundNo, Success: step.success}, testMeta)
+		}
+		if !errors.Is(err, step.wantErr) || duplicate != step.wantDup {
+			t.Fatalf("%s: err = %v, duplicate = %v, want %v, %v", step.name, err, duplicate, step.wantErr, step.wantDup)
+		}
+		if got := orderStatus(t, "814-1"); got != step.wantStatus {
+			t.Fatalf("%s: status = %s, want %s", step.name, got, step.wantStatus)
+		}
+	}
+
+	// 每次成功的部分退款都留有变更记录
+	events, err := db.GetOrderEvents("814-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var transitions []orderstate.State
+	for _, e := range events {
+		transitions = append(transitions, e.ToStatus)
+	}
+	want := []orderstate.State{orderstate.Paid, orderstate.PartiallyRefunded, orderstate.PartiallyRefunded, orderstate.Refunded}
+	if !slices.Equal(transitions, want) {
+		t.Errorf("events = %v, want %v", transitions, want)
+	}
+}
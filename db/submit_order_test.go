@@ -0,0 +1,92 @@
+package db_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	conf "api-pay/config"
+	"api-pay/db"
+	"api-pay/db/dbtest"
+	"api-pay/orderstate"
+)
+
+func TestSubmitOrder(t *testing.T) {
+	saved := conf.AppConfig
+	t.Cleanup(func() { conf.AppConfig = saved })
+	conf.AppConfig.Order.TTL = 30
+
+	tests := []struct {
+		name        string
+		prepare     func(t *testing.T)
+		userId      string
+		appKey      string
+		channel     string
+		wantErr     error
+		wantStatus  orderstate.State
+		wantChannel string
+		wantEvents  int
+	}{
+		{name: "submit", userId: "u1", appKey: "k1", channel: "tiktok", wantStatus: orderstate.PendingPayment, wantChannel: "tiktok", wantEvents: 1},
+		{name: "without app key", userId: "u1", channel: "feizhu", wantStatus: orderstate.PendingPayment, wantChannel: "feizhu", wantEvents: 1},
+		{name: "other user", userId: "u2", appKey: "k1", channel: "feizhu", wantErr: db.ErrOrderNotFound},
+		{name: "other app key", userId: "u1", appKey: "k2", channel: "feizhu", wantErr: db.ErrOrderNotFound},
+		{
+			name: "resubmit switches channel",
+			prepare: func(t *testing.T) {
+				if _, err := db.SubmitOrder("u1", "816-1", "k1", "feizhu", testMeta); err != nil {
+					t.Fatal(err)
+				}
+			},
+			userId: "u1", appKey: "k1", channel: "tiktok",
+			wantStatus: orderstate.PendingPayment, wantChannel: "tiktok", wantEvents: 1,
+		},
+		{
+			name:    "paid",
+			prepare: func(t *testing.T) { payOrder(t, "816-1", "feizhu", 1000) },
+			userId:  "u1", appKey: "k1", channel: "tiktok",
+			wantErr: db.ErrOrderNotPayable,
+		},
+		{
+			name: "past ttl",
+			prepare: func(t *testing.T) {
+				db.DB.Model(&db.GameOrder{}).Where("`order` = ?", "816-1").Update("created_at", time.Now().Add(-time.Hour))
+			},
+			userId: "u1", appKey: "k1", channel: "tiktok",
+			wantErr: db.ErrOrderExpired,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbtest.Open(t)
+			order := createOrder(t, "816-1", 1000)
+			db.DB.Model(order).Update("app_key", "k1")
+			if tt.prepare != nil {
+				tt.prepare(t)
+			}
+			before, _ := db.GetOrderByNo("816-1")
+
+			got, err := db.SubmitOrder(tt.userId, "816-1", tt.appKey, tt.channel, testMeta)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SubmitOrder = %v, want %v", err, tt.wantErr)
+			}
+			stored, _ := db.GetOrderByNo("816-1")
+			if err != nil {
+				if stored.OrderStatus != before.OrderStatus || stored.Channel != before.Channel {
+					t.Errorf("rejected submit changed the order: %s %s", stored.OrderStatus, stored.Channel)
+				}
+				return
+			}
+			if got.OrderStatus != tt.wantStatus || got.Channel != tt.wantChannel {
+				t.Errorf("returned order = %s %s, want %s %s", got.OrderStatus, got.Channel, tt.wantStatus, tt.wantChannel)
+			}
+			if stored.OrderStatus != tt.wantStatus || stored.Channel != tt.wantChannel {
+				t.Errorf("stored order = %s %s, want %s %s", stored.OrderStatus, stored.Channel, tt.wantStatus, tt.wantChannel)
+			}
+			// 重复提交不再写变更记录
+			if events, _ := db.GetOrderEvents("816-1"); len(events) != tt.wantEvents {
+				t.Errorf("events = %d, want %d", len(events), tt.wantEvents)
+			}
+		})
+	}
+}
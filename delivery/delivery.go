@@ -0,0 +1,121 @@
+package delivery
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	conf "api-pay/config"
+	"api-pay/db"
+	"api-pay/orderstate"
+	"api-pay/sign"
+	"api-pay/utils"
+
+	"github.com/google/uuid"
+)
+
+// Deliver 向订单所属游戏服务器推送发货通知，并记录投递结果。
+// 调用前需通过 db.ClaimDelivery 领取该记录。
+func Deliver(d *db.GameOrderDelivery) error {
+	meta := orderstate.Meta{Actor: orderstate.ActorSystem, Reason: "发货通知"}
+
+	err := notify(d)
+	if err == nil {
+		return db.MarkDeliverySuccess(d, meta)
+	}
+
+	meta.Reason = "发货通知失败次数超过上限"
+	next := time.Now().Add(backoff(d.Attempts + 1))
+	if markErr := db.MarkDeliveryFailure(d, err.Error(), maxAttempts(), next, meta); markErr != nil {
+		return markErr
+	}
+	return err
+}
+
+// notify 构建签名后的发货通知并发送
+func notify(d *db.GameOrderDelivery) error {
+	server, ok := conf.AppConfig.Delivery.Servers[d.ServerFlag]
+	if !ok || server.URL == "" {
+		return fmt.Errorf("no delivery endpoint configured for server_flag %q", d.ServerFlag)
+	}
+
+	order, err := db.GetOrderByNo(d.GameOrderNo)
+	if err != nil {
+		return fmt.Errorf("load order: %w", err)
+	}
+
+	params := map[string]string{
+		"order":           order.Order,
+		"user_id":         order.UserId,
+		"game_role_id":    order.GameRoleId,
+		"game_role_name":  order.GameRoleName,
+		"game_role_grade": order.GameRoleGrade,
+		"item":            order.Item,
+		"item_id":         strconv.FormatUint(uint64(order.ItemId), 10),
+		"amount_num":      strconv.FormatInt(order.AmountNum, 10),
+		"single_price":    order.SinglePrice.String(),
+		"total_price":     order.TotalPrice.String(),
+		"server_flag":     order.ServerFlag,
+		"timestamp":       strconv.FormatInt(time.Now().Unix(), 10),
+		"nonce":           uuid.New().String(),
+	}
+	signature, err := sign.Sign(params, sign.TypeHMACSHA256, server.Secret)
+	if err != nil {
+		return fmt.Errorf("sign notification: %w", err)
+	}
+	params["sign"] = signature
+	params["sign_type"] = sign.TypeHMACSHA256
+
+	client := utils.NewHTTPClient(server.URL)
+	client.HTTPClient.Timeout = timeout()
+
+	// 游戏服务器按标准响应结构返回，result 为 success 表示发货成功
+	var response utils.Response
+	if err := client.Post("", params, &response); err != nil {
+		return err
+	}
+	if response.Result != string(utils.ResultSuccess) {
+		return fmt.Errorf("game server rejected delivery: %s %s", response.ErrorCode, response.State)
+	}
+	return nil
+}
+
+// backoff 第 attempt 次失败后的重试间隔，按 base_delay 指数递增，不超过 max_delay
+func backoff(attempt int) time.Duration {
+	base := time.Duration(conf.AppConfig.Delivery.BaseDelay) * time.Second
+	if base <= 0 {
+		base = 10 * time.Second
+	}
+	maxDelay := time.Duration(conf.AppConfig.Delivery.MaxDelay) * time.Second
+	if maxDelay <= 0 {
+		maxDelay = 30 * time.Minute
+	}
+
+	delay := base
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+func maxAttempts() int {
+	if n := conf.AppConfig.Delivery.MaxAttempts; n > 0 {
+		return n
+	}
+	return 8
+}
+
+func timeout() time.Duration {
+	if n := conf.AppConfig.Delivery.Timeout; n > 0 {
+		return time.Duration(n) * time.Second
+	}
+	return 10 * time.Second
+}
+
+// lease 领取记录的租约时长，需大于单次投递超时
+func lease() time.Duration {
+	return 2*timeout() + 5*time.Second
+}
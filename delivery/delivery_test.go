@@ -0,0 +1,33 @@
+package delivery
+
+import (
+	"testing"
+	"time"
+
+	conf "api-pay/config"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name      string
+		base, max int
+		attempt   int
+		want      time.Duration
+	}{
+		{"default first", 0, 0, 1, 10 * time.Second},
+		{"default doubles", 0, 0, 3, 40 * time.Second},
+		{"default capped", 0, 0, 20, 30 * time.Minute},
+		{"configured", 5, 60, 2, 10 * time.Second},
+		{"configured capped", 5, 60, 5, time.Minute},
+		{"base over max", 120, 60, 1, time.Minute},
+	}
+	saved := conf.AppConfig.Delivery
+	t.Cleanup(func() { conf.AppConfig.Delivery = saved })
+	for _, tt := range tests {
+		conf.AppConfig.Delivery.BaseDelay = tt.base
+		conf.AppConfig.Delivery.MaxDelay = tt.max
+		if got := backoff(tt.attempt); got != tt.want {
+			t.Errorf("%s: backoff(%d) = %v, want %v", tt.name, tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package delivery
+
+import (
+	"context"
+	"time"
+
+	conf "api-pay/config"
+	"api-pay/db"
+	initialization "api-pay/init"
+
+	"go.uber.org/zap"
+)
+
+const deliveryBatch = 50
+
+// StartWorker 定时扫描发件箱并投递到期的发货通知。
+// 主备实例都会启动，记录通过租约领取，同一条记录同一时刻只会被一个实例投递。
+func StartWorker(ctx context.Context) {
+	interval := time.Duration(conf.AppConfig.Delivery.PollInterval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runOnce()
+			}
+		}
+	}()
+}
+
+// runOnce 领取并投递一批记录
+func runOnce() {
+	logger := initialization.GetCurrentLogger()
+
+	deliveries, err := db.ClaimDueDeliveries(deliveryBatch, lease())
+	if err != nil {
+		logger.Error("delivery: claim failed", zap.Error(err))
+	}
+
+	for i := range deliveries {
+		d := &deliveries[i]
+		if err := Deliver(d); err != nil {
+			logger.Warn("delivery: attempt failed",
+				zap.String("order", d.GameOrderNo),
+				zap.String("server_flag", d.ServerFlag),
+				zap.Int("attempts", d.Attempts+1),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// Repush 重置订单的投递记录并立即投递一次，供管理后台使用
+func Repush(orderNo string) (*db.GameOrderDelivery, error) {
+	d, err := db.ResetDelivery(orderNo)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := db.ClaimDelivery(d, lease())
+	if err != nil {
+		return d, err
+	}
+	if !ok {
+		// 正在被投递任务处理
+		return d, nil
+	}
+	if err := Deliver(d); err != nil {
+		return d, err
+	}
+	return d, nil
+}
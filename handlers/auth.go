@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"api-pay/auth"
+	"api-pay/middleware"
+	"api-pay/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// LoginRequest 管理员登录请求
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// HandleLogin 管理员登录，返回访问令牌和刷新令牌
+func HandleLogin(c *fiber.Ctx) error {
+	resp := utils.NewResponse(c)
+	var req LoginRequest
+
+	// 解析请求体
+	if err := c.BodyParser(&req); err != nil {
+		return resp.Fail(fiber.StatusBadRequest, fmt.Sprintf("Invalid request format: %v", err))
+	}
+	if req.Username == "" || req.Password == "" {
+		return resp.FailWithCode(fiber.StatusBadRequest, "Missing required fields", "INVALID_PARAMS")
+	}
+
+	user, tokens, err := auth.Login(req.Username, req.Password)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return resp.FailWithCode(fiber.StatusUnauthorized, "用户名或密码错误", "LOGIN_FAILED")
+		}
+		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+	}
+
+	return resp.SuccessWithData(&fiber.Map{
+		"username":           user.Username,
+		"role":               user.Role,
+		"access_token":       tokens.AccessToken,
+		"refresh_token":      tokens.RefreshToken,
+		"expires_in":         tokens.ExpiresIn,
+		"refresh_expires_in": tokens.RefreshExpiresIn,
+	})
+}
+
+// RefreshRequest 刷新令牌请求
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// HandleRefreshToken 使用刷新令牌换取新的令牌
+func HandleRefreshToken(c *fiber.Ctx) error {
+	resp := utils.NewResponse(c)
+	var req RefreshRequest
+
+	// 解析请求体
+	if err := c.BodyParser(&req); err != nil {
+		return resp.Fail(fiber.StatusBadRequest, fmt.Sprintf("Invalid request format: %v", err))
+	}
+	if req.RefreshToken == "" {
+		return resp.FailWithCode(fiber.StatusBadRequest, "Missing required fields", "INVALID_PARAMS")
+	}
+
+	tokens, err := auth.Refresh(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			return resp.FailWithCode(fiber.StatusUnauthorized, "登录已过期，请重新登录", "401011")
+		}
+		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+	}
+	return resp.SuccessWithData(tokens)
+}
+
+// HandleLogout 退出登录，使该管理员已签发的刷新令牌全部失效
+func HandleLogout(c *fiber.Ctx) error {
+	resp := utils.NewResponse(c)
+
+	if err := auth.Logout(middleware.GetAdmin(c).UserID()); err != nil {
+		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+	}
+	return resp.Success()
+}
+
+// CredentialsRequest 修改密码请求
+type CredentialsRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+// HandleChangeCredentials 修改当前管理员的密码
+func HandleChangeCredentials(c *fiber.Ctx) error {
+	resp := utils.NewResponse(c)
+	var req CredentialsRequest
+
+	// 解析请求体
+	if err := c.BodyParser(&req); err != nil {
+		return resp.Fail(fiber.StatusBadRequest, fmt.Sprintf("Invalid request format: %v", err))
+	}
+	if req.OldPassword == "" || req.NewPassword == "" {
+		return resp.FailWithCode(fiber.StatusBadRequest, "Missing required fields", "INVALID_PARAMS")
+	}
+
+	err := auth.ChangePassword(middleware.GetAdmin(c).UserID(), req.OldPassword, req.NewPassword)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			return resp.FailWithCode(fiber.StatusBadRequest, "原密码错误", "LOGIN_FAILED")
+		case errors.Is(err, auth.ErrWeakPassword):
+			return resp.FailWithCode(fiber.StatusBadRequest, "密码至少 8 位", "PASSWORD_WEAK")
+		default:
+			return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+		}
+	}
+	return resp.SuccessWithData(&fiber.Map{
+		"message": "密码已修改，请重新登录",
+	})
+}
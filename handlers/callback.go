@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+
+	"api-pay/channel"
+	"api-pay/db"
+	"api-pay/metrics"
+	"api-pay/orderstate"
+	"api-pay/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// HandleChannelCallback 处理各支付渠道的支付回调，渠道由路由参数 :channel 指定
+func HandleChannelCallback(c *fiber.Ctx) error {
+	name := c.Params("channel", channel.Feizhu)
+	ch, ok := channel.Get(name)
+	if !ok {
+		// 渠道名来自 URL，未注册时不作为标签值
+		metrics.CallbackFailed(metrics.Unknown, "CHANNEL_NOT_FOUND")
+		return utils.NewResponse(c).FailWithCode(fiber.StatusNotFound, "不支持的支付渠道", "CHANNEL_NOT_FOUND")
+	}
+
+	// 解析参数并校验签名及时间戳
+	n, err := ch.ParseCallback(c)
+	if err != nil {
+		var e *channel.Error
+		if !errors.As(err, &e) {
+			e = &channel.Error{Status: fiber.StatusBadRequest, State: "Invalid request format", Code: "INVALID_PARAMS"}
+		}
+		metrics.CallbackFailed(ch.Name(), e.Code)
+		return ch.Ack(c, channel.AckError(e))
+	}
+
+	// 平台通知支付失败，仅确认收到，订单保持未支付
+	if !n.Paid {
+		return ch.Ack(c, channel.AckOK())
+	}
+
+	// 重复回调直接返回成功，避免平台无限重试
+	_, err = channel.ApplyPayment(n, stateMeta(c, orderstate.ActorPlatform, "支付回调"))
+	ack := paymentAck(err)
+	if !ack.Success {
+		metrics.CallbackFailed(ch.Name(), ack.Code)
+	}
+	return ch.Ack(c, ack)
+}
+
+// paymentAck 支付入账结果转换为回调应答
+func paymentAck(err error) channel.Ack {
+	switch {
+	case err == nil:
+		return channel.AckOK()
+	case errors.Is(err, channel.ErrPaymentReview):
+		// 向平台确认收到，避免重复回调
+		return channel.Ack{Success: true, Status: fiber.StatusOK, State: "订单已过期，已转人工审核", Data: &fiber.Map{"review": true}}
+	case errors.Is(err, db.ErrOrderNotFound), errors.Is(err, db.ErrOrderNotPayable), errors.Is(err, db.ErrAmountMismatch):
+		return channel.AckError(&channel.Error{Status: fiber.StatusInternalServerError, State: "未找到未支付的订单或金额有误", Code: "DATA_ERROR"})
+	case errors.Is(err, db.ErrOrderPaidConflict):
+		return channel.AckError(&channel.Error{Status: fiber.StatusBadRequest, State: "订单已被其他平台单号支付", Code: "ORDER_EXISTS"})
+	default:
+		return channel.AckError(&channel.Error{Status: fiber.StatusInternalServerError, State: "Database error", Code: "DB_ERROR"})
+	}
+}
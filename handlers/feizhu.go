@@ -1,29 +1,41 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"strconv"
 	"time"
 
+	"api-pay/channel"
+	conf "api-pay/config"
 	"api-pay/db"
 	initialization "api-pay/init"
+	"api-pay/metrics"
+	"api-pay/middleware"
+	"api-pay/money"
+	"api-pay/orderstate"
 	"api-pay/utils"
 	"github.com/gofiber/fiber/v2"
 )
 
+// 建单、取消订单的锁：持有期间自动续期，等待超时后提示稍后重试
+const (
+	orderLockTTL  = 10 * time.Second
+	orderLockWait = 3 * time.Second
+)
+
 // CreateOrder 回调请求结构
 type CreateOrder struct {
-	UserId        string  `json:"user_id"`
-	Item          string  `json:"item"`
-	ItemId        string  `json:"item_id"`
-	SinglePric    float64 `json:"single_pric"`
-	AmountNum     int64   `json:"amount_num"`
-	ServerFlag    string  `json:"server_flag"`
-	Description   string  `json:"description"`
-	GameRoleId    string  `json:"game_role_id"`
-	GameRoleName  string  `json:"game_role_name"`
-	GameRoleGrade string  `json:"game_role_grade"`
+	UserId        string      `json:"user_id"`
+	Item          string      `json:"item"`
+	ItemId        string      `json:"item_id"`
+	SinglePric    money.Money `json:"single_pric"`
+	AmountNum     int64       `json:"amount_num"`
+	ServerFlag    string      `json:"server_flag"`
+	Description   string      `json:"description"`
+	GameRoleId    string      `json:"game_role_id"`
+	GameRoleName  string      `json:"game_role_name"`
+	GameRoleGrade string      `json:"game_role_grade"`
 }
 
 // HandleCreateOrder 处理回调请求
@@ -37,18 +49,49 @@ func HandleCreateOrder(c *fiber.Ctx) error {
 	}
 
 	// 验证必要字段
-	if req.UserId == "" || req.Item == "" || req.SinglePric <= 0 {
+	if req.UserId == "" || req.Item == "" || !req.SinglePric.IsPositive() {
 		return resp.Fail(fiber.StatusBadRequest, "Missing required fields")
 	}
 
+	// 未传数量时按 1 件处理
+	if req.AmountNum == 0 {
+		req.AmountNum = 1
+	}
+
 	// 查询商品是否存在
-	gameGoods, err := db.GetOrderByGoodsIitem(req.Item, req.SinglePric)
+	gameGoods, err := db.GetGoodsByItem(req.Item)
+	if err != nil {
+		if errors.Is(err, db.ErrGoodsNotFound) {
+			return resp.FailWithCode(fiber.StatusBadRequest, "商品不存在", "GOODS_NOT_FOUND")
+		}
+		return resp.Fail(fiber.StatusInternalServerError, "查询商品失败")
+	}
+
+	// 客户端单价需与商品当前价格一致
+	if !gameGoods.SinglePric.Equal(req.SinglePric) {
+		return resp.FailWithCode(fiber.StatusConflict, "商品价格已变更，请重新下单", "PRICE_CHANGED")
+	}
+
+	// 校验是否在售
+	if err := gameGoods.CheckAvailable(time.Now()); err != nil {
+		return resp.FailWithCode(fiber.StatusBadRequest, "商品未在售", "GOODS_UNAVAILABLE")
+	}
+
+	// 校验购买数量
+	if err := gameGoods.CheckQuantity(req.AmountNum); err != nil {
+		return resp.FailWithCode(fiber.StatusBadRequest, "购买数量超出限制", "QUANTITY_INVALID")
+	}
+
+	// 同一用户同一商品的建单串行执行，避免并发请求重复建单
+	lock, err := db.AcquireLock("order:create:"+req.UserId+":"+req.Item, orderLockTTL, orderLockWait)
 	if err != nil {
-		return resp.Fail(fiber.StatusBadRequest, "商品不存在，或者价格不正确")
+		middleware.SkipIdempotencyStore(c)
+		return resp.FailWithCode(fiber.StatusConflict, "订单处理中，请稍后重试", "ORDER_BUSY")
 	}
+	defer lock.Release()
 
 	// 先查询是否已存在未支付的订单
-	existingOrder, err := db.GetOrderByUserAndItem(req.UserId, req.Item, req.SinglePric)
+	existingOrder, err := db.GetOrderByUserAndItem(req.UserId, req.Item, req.SinglePric, req.AmountNum)
 	if err != nil {
 		return resp.Fail(fiber.StatusBadRequest, "查询订单失败")
 	}
@@ -60,29 +103,56 @@ func HandleCreateOrder(c *fiber.Ctx) error {
 			"item":        existingOrder.Item,
 			"order":       existingOrder.Order,
 			"single_pric": existingOrder.SinglePrice,
+			"amount_num":  existingOrder.AmountNum,
+			"total_price": existingOrder.TotalPrice,
 		})
 	}
 
+	// 总价以商品价格为准在服务端计算
+	totalPrice, err := gameGoods.SinglePric.Mul(req.AmountNum)
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusBadRequest, "订单金额超出范围", "QUANTITY_INVALID")
+	}
+
 	// 创建订单记录
 	gameOrder := db.GameOrder{
 		UserId:        req.UserId,
 		Item:          req.Item,
 		ItemId:        gameGoods.ID,
 		Order:         initialization.SnowFlake.NextID("811"),
-		SinglePrice:   req.SinglePric,
+		SinglePrice:   gameGoods.SinglePric,
+		TotalPrice:    totalPrice,
 		AmountNum:     req.AmountNum,
 		ServerFlag:    req.ServerFlag,
 		Description:   req.Description,
 		GameRoleId:    req.GameRoleId,
 		GameRoleName:  req.GameRoleName,
 		GameRoleGrade: req.GameRoleGrade,
+		AppKey:        middleware.GetAppKey(c),
 		Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
 	}
 
-	// 保存到数据库
-	if err := db.InsertOrder(&gameOrder); err != nil {
-		return resp.Fail(fiber.StatusInternalServerError, "保存失败，已经存在或者数据不正确")
+	// 校验限购、扣减库存并保存到数据库
+	if err := db.PlaceOrder(&gameOrder); err != nil {
+		switch {
+		case errors.Is(err, db.ErrGoodsUnavailable):
+			return resp.FailWithCode(fiber.StatusBadRequest, "商品未在售", "GOODS_UNAVAILABLE")
+		case errors.Is(err, db.ErrPriceChanged):
+			return resp.FailWithCode(fiber.StatusConflict, "商品价格已变更，请重新下单", "PRICE_CHANGED")
+		case errors.Is(err, db.ErrQuantityInvalid):
+			return resp.FailWithCode(fiber.StatusBadRequest, "订单金额超出范围", "QUANTITY_INVALID")
+		case errors.Is(err, db.ErrOutOfStock):
+			return resp.FailWithCode(fiber.StatusBadRequest, "商品库存不足", "OUT_OF_STOCK")
+		case errors.Is(err, db.ErrPurchaseLimit):
+			return resp.FailWithCode(fiber.StatusBadRequest, "超过每人限购数量", "PURCHASE_LIMIT")
+		case errors.Is(err, db.ErrOrderExists):
+			// 其他实例未经锁保护时并发建单，由唯一索引兜底
+			return resp.FailWithCode(fiber.StatusConflict, "订单存在未支付的订单，请重新查询", "ORDER_EXISTS")
+		default:
+			return resp.Fail(fiber.StatusInternalServerError, "保存失败，已经存在或者数据不正确")
+		}
 	}
+	metrics.OrderCreated(gameOrder.Item, gameOrder.ServerFlag)
 
 	// 返回成功响应
 	return resp.SuccessWithData(&fiber.Map{
@@ -92,16 +162,18 @@ func HandleCreateOrder(c *fiber.Ctx) error {
 		"item_id":     gameOrder.ItemId,
 		"order":       gameOrder.Order,
 		"single_pric": gameOrder.SinglePrice,
+		"amount_num":  gameOrder.AmountNum,
+		"total_price": gameOrder.TotalPrice,
 	})
 }
 
 // cancel
 type CancelOrder struct {
-	UserId      string  `json:"user_id"`
-	Item        string  `json:"item"`
-	SinglePric  float64 `json:"single_pric"`
-	Order       string  `json:"order"`
-	Description string  `json:"description"`
+	UserId      string      `json:"user_id"`
+	Item        string      `json:"item"`
+	SinglePric  money.Money `json:"single_pric"`
+	Order       string      `json:"order"`
+	Description string      `json:"description"`
 }
 
 // HandleCancelOrder
@@ -119,28 +191,27 @@ func HandleCancelOrder(c *fiber.Ctx) error {
 		return resp.Fail(fiber.StatusBadRequest, "Missing required fields")
 	}
 
-	// 验证订单是否存在
-	isExists, err := db.GetOrderByNo(req.Order)
+	// 同一订单的取消串行执行
+	lock, err := db.AcquireLock("order:cancel:"+req.Order, orderLockTTL, orderLockWait)
 	if err != nil {
-		return resp.FailWithCode(fiber.StatusInternalServerError, "查询订单错误", "DATA_ERROR")
-	}
-	if !isExists {
-		return resp.FailWithCode(fiber.StatusInternalServerError, "不存在未支付订单", "DATA_ERROR")
+		middleware.SkipIdempotencyStore(c)
+		return resp.FailWithCode(fiber.StatusConflict, "订单处理中，请稍后重试", "ORDER_BUSY")
 	}
+	defer lock.Release()
 
-	// 查询这个订单是否支付成功
-	isSuccess, _ := db.GetOrderPayExistsByOrderNo(req.Order)
-	if isSuccess {
-		return resp.FailWithCode(fiber.StatusInternalServerError, "订单已支付，无法取消", "DATA_ERROR")
-	}
-
-	// 取消该用户的订单
-	err = db.UpdateOrderStatusCancel(req.UserId, req.Order)
+	// 仅未支付的订单可以取消，状态校验由状态机完成
+	order, err := db.CancelOrder(req.UserId, req.Order, middleware.GetAppKey(c), stateMeta(c, orderstate.ActorUser, "用户取消订单"))
 	if err != nil {
-		return resp.SuccessWithData(&fiber.Map{
-			"message": fmt.Sprintf("Failed to cancel order: %v", err),
-		})
+		switch {
+		case errors.Is(err, db.ErrOrderNotFound):
+			return resp.FailWithCode(fiber.StatusBadRequest, "不存在未支付订单", "DATA_ERROR")
+		case errors.Is(err, orderstate.ErrIllegalTransition), errors.Is(err, orderstate.ErrStateChanged):
+			return resp.FailWithCode(fiber.StatusConflict, "订单已支付或已关闭，无法取消", "DATA_ERROR")
+		default:
+			return resp.FailWithCode(fiber.StatusInternalServerError, "查询订单错误", "DATA_ERROR")
+		}
 	}
+	metrics.OrderCancelled(order.Item, order.ServerFlag)
 
 	// 返回成功响应
 	return resp.SuccessWithData(&fiber.Map{
@@ -150,89 +221,11 @@ func HandleCancelOrder(c *fiber.Ctx) error {
 	})
 }
 
-// CallbackRequest 回调请求结构
-type CallbackRequest struct {
-	GameOrderNo   string  `json:"game_order_no"`
-	GyyxOrderNo   string  `json:"gyyx_order_no"`
-	Result        string  `json:"result"`
-	ResultMessage string  `json:"result_message"`
-	RmbYuan       float64 `json:"rmb_yuan"`
-	ServerFlag    string  `json:"server_flag"`
-	CommonParam   string  `json:"common_param"`
-	Timestamp     string  `json:"timestamp"`
-	Sign          string  `json:"sign"`
-	SignType      string  `json:"sign_type"`
-}
-
-// HandleCallback 处理回调请求
-func HandleCallback(c *fiber.Ctx) error {
-	resp := utils.NewResponse(c)
-
-	// 解析 URL 查询参数
-	req := CallbackRequest{
-		GameOrderNo:   c.Query("game_order_no"),
-		GyyxOrderNo:   c.Query("gyyx_order_no"),
-		Result:        c.Query("result"),
-		ResultMessage: c.Query("result_message"),
-		RmbYuan:       c.QueryFloat("rmb_yuan"),
-		ServerFlag:    c.Query("server_flag"),
-		CommonParam:   c.Query("common_param"),
-		Timestamp:     c.Query("timestamp"),
-		Sign:          c.Query("sign"),
-		SignType:      c.Query("signType"),
-	}
-
-	// 验证必填字段
-	if req.GameOrderNo == "" || req.GyyxOrderNo == "" {
-		return resp.FailWithCode(fiber.StatusBadRequest, "Missing required fields", "INVALID_PARAMS")
-	}
-
-	// 查询是否存在待支付的订单
-	gameOrder, err := db.GetOrderByNoPrice(req.GameOrderNo, req.RmbYuan)
-	if err != nil {
-		return resp.FailWithCode(fiber.StatusInternalServerError, "未找到未支付的订单或金额有误", "DATA_ERROR")
-	}
-
-	// 查询这个单号、价格的订单是否存在
-	exists, _ := db.GetOrderPayExists(req.GameOrderNo, req.RmbYuan)
-	if exists {
-		return resp.FailWithCode(fiber.StatusBadRequest, "订单号已经支付成功", "ORDER_EXISTS")
-	}
-
-	// 构建订单对象
-	order := db.GameOrderPay{
-		UserId:        gameOrder.UserId,
-		ItemId:        gameOrder.ItemId,
-		Item:          gameOrder.Item,
-		GameOrderNo:   req.GameOrderNo,
-		GyyxOrderNo:   req.GyyxOrderNo,
-		Result:        req.Result,
-		ResultMessage: req.ResultMessage,
-		RmbYuan:       req.RmbYuan,
-		ServerFlag:    req.ServerFlag,
-		CommonParam:   req.CommonParam,
-		Timestamp:     req.Timestamp,
-	}
-
-	// 保存到数据库
-	if err := db.InsertOrder(&order); err != nil {
-		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
-	}
-
-	// 更新订单的状态
-	if err := db.UpdateOrderStatus(gameOrder.UserId, req.GameOrderNo); err != nil {
-		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
-	}
-
-	// 返回成功响应
-	return resp.Success()
-}
-
 // GoodsInfo 商品信息结构
 type GoodsInfo struct {
-	Id         uint    `json:"id"`
-	Item       string  `json:"item"`
-	SinglePric float64 `json:"single_pric"`
+	Id         uint        `json:"id"`
+	Item       string      `json:"item"`
+	SinglePric money.Money `json:"single_pric"`
 }
 
 // HandleGoods 处理获取商品信息请求
@@ -284,17 +277,8 @@ type VerificationRequest struct {
 	Order  string `json:"order"`
 }
 
-type UserVerificationCount struct {
-	ID                uint      `gorm:"primaryKey;comment:主键ID"`               // 主键ID
-	UserId            string    `gorm:"size:255;not null;comment:用户ID，唯一标识玩家"` // 用户ID
-	Item              string    `gorm:"size:255;not null;comment:商品属性"`        // 商品属性
-	VerificationCount int       `gorm:"not null;comment:验证次数"`                 // 验证次数
-	LastVerifiedAt    time.Time `gorm:"comment:最后验证时间"`                        // 最后验证时间
-	CreatedAt         time.Time `gorm:"autoCreateTime;comment:创建时间"`           // 创建时间
-	UpdatedAt         time.Time `gorm:"autoUpdateTime;comment:更新时间"`           // 更新时间
-}
-
-// HandleVerification 处理回调请求
+// HandleVerification 校验用户是否拥有该商品：传入订单号时只校验该订单，
+// 否则返回所有已支付且未全额退款的购买记录，并记录验证次数
 func HandleVerification(c *fiber.Ctx) error {
 	resp := utils.NewResponse(c)
 	var req VerificationRequest
@@ -309,48 +293,119 @@ func HandleVerification(c *fiber.Ctx) error {
 		return resp.FailWithCode(fiber.StatusBadRequest, "Missing required fields", "INVALID_PARAMS")
 	}
 
-	gamrOrderPay, err := db.GetOrderPayByUserId(req.UserId, req.Item)
+	filter := db.EntitlementFilter{UserId: req.UserId, Item: req.Item, Order: req.Order}
+	if req.ItemId != "" {
+		itemId, err := strconv.ParseUint(req.ItemId, 10, 32)
+		if err != nil {
+			return resp.FailWithCode(fiber.StatusBadRequest, "商品ID必须是有效的整数", "INVALID_PARAMS")
+		}
+		filter.ItemId = uint(itemId)
+	}
+
+	entitlements, err := db.GetEntitlements(filter)
 	if err != nil {
 		return resp.FailWithCode(fiber.StatusInternalServerError, "Failed to get order by user id", "DATA_ERROR")
 	}
+	if len(entitlements) == 0 {
+		return resp.FailWithCode(fiber.StatusBadRequest, "未找到有效的购买记录", "NOT_PURCHASED")
+	}
 
-	// 返回成功响应
+	counter, err := db.RecordVerification(req.UserId, req.Item, conf.VerificationLimit(req.Item))
+	if err != nil {
+		if errors.Is(err, db.ErrVerificationLimit) {
+			return resp.FailWithCode(fiber.StatusTooManyRequests, "超过验证次数上限", "VERIFICATION_LIMIT")
+		}
+		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+	}
+
+	var totalQuantity int64
+	purchases := make([]fiber.Map, 0, len(entitlements))
+	for _, e := range entitlements {
+		totalQuantity += e.Quantity
+		purchases = append(purchases, fiber.Map{
+			"order":           e.Order,
+			"item":            e.Item,
+			"item_id":         e.ItemId,
+			"amount_num":      e.AmountNum,
+			"quantity":        e.Quantity,
+			"total_price":     e.TotalPrice,
+			"refunded_amount": e.RefundedAmount,
+			"status":          e.Status.String(),
+			"purchase_time":   e.PurchasedAt.Format(timeLayout),
+		})
+	}
+
+	// 返回成功响应，purchase_time 为最早一笔购买时间
 	return resp.SuccessWithData(&fiber.Map{
-		"purchase_time": gamrOrderPay.CreatedAt.Format("2006-01-02 15:04:05"),
+		"purchase_time":      entitlements[0].PurchasedAt.Format(timeLayout),
+		"purchases":          purchases,
+		"total_quantity":     totalQuantity,
+		"verification_count": counter.VerificationCount,
+		"last_verified_at":   counter.LastVerifiedAt.Format(timeLayout),
 	})
 }
 
-// HandleSubmitOrder 提交订单
+// SubmitOrderRequest 提交订单支付请求
+type SubmitOrderRequest struct {
+	UserId  string `json:"user_id"`
+	Order   string `json:"order"`
+	Channel string `json:"channel"`
+}
+
+// HandleSubmitOrder 提交已创建的订单进行支付，返回客户端拉起支付所需的参数
 func HandleSubmitOrder(c *fiber.Ctx) error {
 	resp := utils.NewResponse(c)
+	var req SubmitOrderRequest
 
-	// 创建HTTPClient实例
-	client := utils.NewHTTPClient("https://api.deepseek.com")
+	// 解析请求体
+	if err := c.BodyParser(&req); err != nil {
+		return resp.Fail(fiber.StatusBadRequest, fmt.Sprintf("Invalid request format: %v", err))
+	}
 
-	// 设置API Key
-	client.SetHeader("Authorization", "Bearer <DeepSeek API Key>")
+	// 验证必要字段
+	if req.UserId == "" || req.Order == "" {
+		return resp.FailWithCode(fiber.StatusBadRequest, "Missing required fields", "INVALID_PARAMS")
+	}
 
-	// 创建请求体（使用map[string]interface{}）
-	request := map[string]interface{}{
-		"model": "deepseek-chat",
-		"messages": []map[string]string{
-			{"role": "system", "content": "You are a helpful assistant."},
-			{"role": "user", "content": "Hello!"},
-		},
-		"stream": false,
+	// 未指定渠道时使用飞猪
+	if req.Channel == "" {
+		req.Channel = channel.Feizhu
+	}
+	ch, ok := channel.Get(req.Channel)
+	if !ok {
+		return resp.FailWithCode(fiber.StatusBadRequest, "不支持的支付渠道", "CHANNEL_NOT_FOUND")
 	}
 
-	// 调用API（响应体使用map[string]interface{}）
-	var response map[string]interface{}
-	err := client.Post("/chat/completions", request, &response)
+	// 校验订单归属和状态，并改为待支付
+	order, err := db.SubmitOrder(req.UserId, req.Order, middleware.GetAppKey(c), ch.Name(), stateMeta(c, orderstate.ActorUser, "提交订单支付"))
 	if err != nil {
-		log.Printf("Error calling DeepSeek API: %v", err)
-		return resp.Fail(fiber.StatusInternalServerError, "Failed to call API")
+		switch {
+		case errors.Is(err, db.ErrOrderNotFound):
+			return resp.FailWithCode(fiber.StatusBadRequest, "订单不存在", "DATA_ERROR")
+		case errors.Is(err, db.ErrOrderExpired):
+			return resp.FailWithCode(fiber.StatusBadRequest, "订单已过期", "ORDER_EXPIRED")
+		case errors.Is(err, db.ErrOrderNotPayable), errors.Is(err, orderstate.ErrStateChanged):
+			return resp.FailWithCode(fiber.StatusBadRequest, "订单已支付或已关闭，无法提交", "ORDER_NOT_PAYABLE")
+		default:
+			return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+		}
 	}
 
-	// 打印响应
-	fmt.Printf("Response: %+v\n", response)
+	// 向支付渠道获取支付参数，失败时订单保持待支付，可重新提交
+	params, err := ch.CreatePayment(order)
+	if err != nil {
+		if errors.Is(err, channel.ErrNotSupported) {
+			return resp.FailWithCode(fiber.StatusBadRequest, "支付渠道未配置", "CHANNEL_NOT_SUPPORTED")
+		}
+		return resp.FailWithCode(fiber.StatusBadGateway, fmt.Sprintf("获取支付参数失败: %v", err), "PAYMENT_CREATE_FAILED")
+	}
 
-	// 返回成功响应
-	return resp.SuccessWithData(response)
+	return resp.SuccessWithData(&fiber.Map{
+		"message":     "订单已提交",
+		"order":       order.Order,
+		"channel":     order.Channel,
+		"status":      order.OrderStatus.String(),
+		"total_price": order.TotalPrice,
+		"pay_params":  params,
+	})
 }
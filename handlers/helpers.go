@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"strconv"
+
+	"api-pay/middleware"
+	"api-pay/orderstate"
+	"github.com/gofiber/fiber/v2"
+)
+
+// stateMeta 构建订单状态变更的审计信息
+func stateMeta(c *fiber.Ctx, actor, reason string) orderstate.Meta {
+	traceID, _ := c.Locals("trace_id").(string)
+	return orderstate.Meta{
+		Actor:   actor,
+		Reason:  reason,
+		TraceID: traceID,
+		Ctx:     c.UserContext(),
+	}
+}
+
+// operatorOf 管理操作的操作人标识，优先使用登录的管理员用户名
+func operatorOf(c *fiber.Ctx) string {
+	if admin := middleware.GetAdmin(c); admin != nil {
+		return admin.Username
+	}
+	return middleware.GetClientIP(c)
+}
+
+// pagination 解析分页参数，page 从 1 开始，page_size 默认 20，最大 100
+func pagination(c *fiber.Ctx) (page, pageSize int) {
+	page, _ = strconv.Atoi(c.Query("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ = strconv.Atoi(c.Query("page_size", "20"))
+	if pageSize < 1 {
+		pageSize = 20
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	return page, pageSize
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"api-pay/auth"
+	"api-pay/db"
+	"api-pay/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminUserRequest 创建/更新管理员请求，更新时字段为空表示不修改
+type AdminUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+	Disabled *bool  `json:"disabled"`
+}
+
+// HandleManageAdminList 查询管理员列表
+func HandleManageAdminList(c *fiber.Ctx) error {
+	resp := utils.NewResponse(c)
+
+	users, err := db.ListAdminUsers()
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+	}
+
+	list := make([]fiber.Map, 0, len(users))
+	for i := range users {
+		list = append(list, toAdminDetail(&users[i]))
+	}
+	return resp.SuccessWithData(list)
+}
+
+// HandleManageAdminCreate 创建管理员
+func HandleManageAdminCreate(c *fiber.Ctx) error {
+	resp := utils.NewResponse(c)
+	var req AdminUserRequest
+
+	// 解析请求体
+	if err := c.BodyParser(&req); err != nil {
+		return resp.Fail(fiber.StatusBadRequest, fmt.Sprintf("Invalid request format: %v", err))
+	}
+	if req.Username == "" || req.Password == "" {
+		return resp.FailWithCode(fiber.StatusBadRequest, "Missing required fields", "INVALID_PARAMS")
+	}
+	if req.Role == "" {
+		req.Role = auth.RoleViewer
+	}
+	if !auth.ValidRole(req.Role) {
+		return resp.FailWithCode(fiber.StatusBadRequest, "无效的角色", "INVALID_PARAMS")
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusBadRequest, "密码至少 8 位", "PASSWORD_WEAK")
+	}
+
+	user := db.AdminUser{Username: req.Username, PasswordHash: hash, Role: req.Role}
+	if req.Disabled != nil {
+		user.Disabled = *req.Disabled
+	}
+	if err := db.CreateAdminUser(&user); err != nil {
+		if errors.Is(err, db.ErrAdminDuplicated) {
+			return resp.FailWithCode(fiber.StatusBadRequest, "用户名已存在", "ADMIN_DUPLICATED")
+		}
+		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+	}
+	return resp.SuccessWithData(toAdminDetail(&user))
+}
+
+// HandleManageAdminUpdate 修改管理员的角色、状态或重置密码
+func HandleManageAdminUpdate(c *fiber.Ctx) error {
+	resp := utils.NewResponse(c)
+	var req AdminUserRequest
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusBadRequest, "管理员ID必须是有效的整数", "INVALID_PARAMS")
+	}
+	// 解析请求体
+	if err := c.BodyParser(&req); err != nil {
+		return resp.Fail(fiber.StatusBadRequest, fmt.Sprintf("Invalid request format: %v", err))
+	}
+
+	changes := make(map[string]interface{})
+	if req.Role != "" {
+		if !auth.ValidRole(req.Role) {
+			return resp.FailWithCode(fiber.StatusBadRequest, "无效的角色", "INVALID_PARAMS")
+		}
+		changes["role"] = req.Role
+	}
+	if req.Password != "" {
+		hash, err := auth.HashPassword(req.Password)
+		if err != nil {
+			return resp.FailWithCode(fiber.StatusBadRequest, "密码至少 8 位", "PASSWORD_WEAK")
+		}
+		changes["password_hash"] = hash
+	}
+	if req.Disabled != nil {
+		changes["disabled"] = *req.Disabled
+	}
+
+	user, err := auth.UpdateAdmin(uint(id), changes)
+	if err != nil {
+		if errors.Is(err, db.ErrAdminNotFound) {
+			return resp.FailWithCode(fiber.StatusNotFound, "管理员不存在", "ADMIN_NOT_FOUND")
+		}
+		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+	}
+	return resp.SuccessWithData(toAdminDetail(user))
+}
+
+// toAdminDetail 管理员信息，不包含密码哈希
+func toAdminDetail(user *db.AdminUser) fiber.Map {
+	detail := fiber.Map{
+		"id":            user.ID,
+		"username":      user.Username,
+		"role":          user.Role,
+		"enabled":       !user.Disabled,
+		"last_login_at": nil,
+		"created_at":    user.CreatedAt.Format(timeLayout),
+	}
+	if user.LastLoginAt != nil {
+		detail["last_login_at"] = user.LastLoginAt.Format(timeLayout)
+	}
+	return detail
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"api-pay/db"
+	"api-pay/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ClientRequest 签发客户端请求
+type ClientRequest struct {
+	Name string `json:"name"`
+}
+
+// HandleManageClientCreate 签发新的客户端 app key 和密钥，密钥只在签发时返回一次
+func HandleManageClientCreate(c *fiber.Ctx) error {
+	resp := utils.NewResponse(c)
+	var req ClientRequest
+
+	// 解析请求体
+	if err := c.BodyParser(&req); err != nil {
+		return resp.Fail(fiber.StatusBadRequest, fmt.Sprintf("Invalid request format: %v", err))
+	}
+	if req.Name == "" {
+		return resp.FailWithCode(fiber.StatusBadRequest, "Missing required fields", "INVALID_PARAMS")
+	}
+
+	appKey, err := randomHex(8)
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusInternalServerError, "生成密钥失败", "SYSTEM_ERROR")
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusInternalServerError, "生成密钥失败", "SYSTEM_ERROR")
+	}
+
+	client := db.ApiClient{AppKey: "ak_" + appKey, Secret: secret, Name: req.Name}
+	if err := db.CreateApiClient(&client); err != nil {
+		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+	}
+
+	return resp.SuccessWithData(&fiber.Map{
+		"app_key": client.AppKey,
+		"secret":  client.Secret,
+		"name":    client.Name,
+	})
+}
+
+// HandleManageClientList 查询已签发的客户端，不返回密钥
+func HandleManageClientList(c *fiber.Ctx) error {
+	resp := utils.NewResponse(c)
+
+	clients, err := db.ListApiClients()
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+	}
+
+	list := make([]fiber.Map, 0, len(clients))
+	for _, client := range clients {
+		list = append(list, fiber.Map{
+			"app_key":    client.AppKey,
+			"name":       client.Name,
+			"enabled":    !client.Disabled,
+			"created_at": client.CreatedAt.Format(timeLayout),
+		})
+	}
+	return resp.SuccessWithData(list)
+}
+
+// HandleManageClientEnable 启用客户端
+func HandleManageClientEnable(c *fiber.Ctx) error {
+	return setClientDisabled(c, false)
+}
+
+// HandleManageClientDisable 停用客户端，停用后立即无法通过签名认证
+func HandleManageClientDisable(c *fiber.Ctx) error {
+	return setClientDisabled(c, true)
+}
+
+func setClientDisabled(c *fiber.Ctx, disabled bool) error {
+	resp := utils.NewResponse(c)
+
+	if err := db.SetApiClientDisabled(c.Params("app_key"), disabled); err != nil {
+		if errors.Is(err, db.ErrClientNotFound) {
+			return resp.FailWithCode(fiber.StatusNotFound, "客户端不存在", "CLIENT_NOT_FOUND")
+		}
+		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+	}
+	return resp.Success()
+}
+
+// randomHex 生成 n 字节的随机数并编码为十六进制
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"api-pay/db"
+	"api-pay/delivery"
+	"api-pay/middleware"
+	"api-pay/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// DeliveryRetryRequest 重推发货请求
+type DeliveryRetryRequest struct {
+	Order string `json:"order"`
+}
+
+// HandleDeliveryRetry 管理后台重推订单的发货通知
+func HandleDeliveryRetry(c *fiber.Ctx) error {
+	resp := utils.NewResponse(c)
+	var req DeliveryRetryRequest
+
+	// 解析请求体
+	if err := c.BodyParser(&req); err != nil {
+		return resp.Fail(fiber.StatusBadRequest, fmt.Sprintf("Invalid request format: %v", err))
+	}
+	if req.Order == "" {
+		return resp.FailWithCode(fiber.StatusBadRequest, "Missing required fields", "INVALID_PARAMS")
+	}
+
+	d, err := delivery.Repush(req.Order)
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrOrderNotFound):
+			return resp.FailWithCode(fiber.StatusBadRequest, "订单不存在", "DATA_ERROR")
+		case errors.Is(err, db.ErrDeliveryNotAllowed):
+			return resp.FailWithCode(fiber.StatusBadRequest, "订单未支付或已退款，不能发货", "DELIVERY_NOT_ALLOWED")
+		case errors.Is(err, db.ErrDeliveryInProgress):
+			middleware.SkipIdempotencyStore(c)
+			return resp.FailWithCode(fiber.StatusConflict, "发货通知正在投递中，请稍后重试", "DELIVERY_IN_PROGRESS")
+		case d != nil:
+			// 投递失败，已按退避策略重新排队
+			return resp.FailWithCode(fiber.StatusBadGateway, fmt.Sprintf("发货通知失败: %v", err), "DELIVERY_FAILED")
+		default:
+			return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+		}
+	}
+
+	return resp.SuccessWithData(&fiber.Map{
+		"message": "发货通知已推送",
+		"order":   req.Order,
+	})
+}
@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	conf "api-pay/config"
+	"api-pay/db"
+	"api-pay/money"
+	"api-pay/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GoodsRequest 商品创建/更新请求，SKU 字段沿用 conf.SkuList：
+// price 单位为分，quantity 为库存（小于 0 表示不限库存，创建时不传也不限库存，更新时不传则不修改）
+type GoodsRequest struct {
+	conf.SkuList
+	Quantity     *int       `json:"quantity"`    // 覆盖 SkuList.Quantity，以区分未传和 0
+	StockDelta   int64      `json:"stock_delta"` // 更新时在当前库存上增减，不能与 quantity 同时传
+	Item         string     `json:"item"`
+	MinQuantity  int64      `json:"min_quantity"`
+	MaxQuantity  int64      `json:"max_quantity"`
+	PerUserLimit int64      `json:"per_user_limit"`
+	SaleStartAt  *time.Time `json:"sale_start_at"`
+	SaleEndAt    *time.Time `json:"sale_end_at"`
+}
+
+// GoodsDetail 管理后台商品信息
+type GoodsDetail struct {
+	Id           uint         `json:"id"`
+	Item         string       `json:"item"`
+	SinglePric   money.Money  `json:"single_pric"`
+	PriceVersion int64        `json:"price_version"`
+	Sku          conf.SkuList `json:"sku"`
+	Stock        *int64       `json:"stock"`
+	MinQuantity  int64        `json:"min_quantity"`
+	MaxQuantity  int64        `json:"max_quantity"`
+	PerUserLimit int64        `json:"per_user_limit"`
+	SaleStartAt  *time.Time   `json:"sale_start_at"`
+	SaleEndAt    *time.Time   `json:"sale_end_at"`
+	Enabled      bool         `json:"enabled"`
+	CreatedAt    string       `json:"created_at"`
+	UpdatedAt    string       `json:"updated_at"`
+}
+
+// HandleManageGoodsList 分页查询商品
+func HandleManageGoodsList(c *fiber.Ctx) error {
+	resp := utils.NewResponse(c)
+	page, pageSize := pagination(c)
+
+	filter := db.GoodsFilter{
+		Item:    c.Query("item"),
+		SkuCode: c.Query("sku_code"),
+		Keyword: c.Query("keyword"),
+	}
+	if enabled := c.Query("enabled"); enabled != "" {
+		disabled := enabled != "true" && enabled != "1"
+		filter.Disabled = &disabled
+	}
+
+	goods, total, err := db.ListGoods(filter, page, pageSize)
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+	}
+
+	list := make([]GoodsDetail, 0, len(goods))
+	for i := range goods {
+		list = append(list, toGoodsDetail(&goods[i]))
+	}
+	return resp.SuccessWithData(&fiber.Map{
+		"list":      list,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// HandleManageGoodsCreate 创建商品
+func HandleManageGoodsCreate(c *fiber.Ctx) error {
+	resp := utils.NewResponse(c)
+	var req GoodsRequest
+
+	// 解析请求体
+	if err := c.BodyParser(&req); err != nil {
+		return resp.Fail(fiber.StatusBadRequest, fmt.Sprintf("Invalid request format: %v", err))
+	}
+
+	goods, err := toGoodsModel(&req)
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusBadRequest, err.Error(), "INVALID_PARAMS")
+	}
+	if req.StockDelta != 0 {
+		return resp.FailWithCode(fiber.StatusBadRequest, "创建商品时请使用 quantity 设置库存", "INVALID_PARAMS")
+	}
+	if req.Quantity != nil && *req.Quantity >= 0 {
+		stock := int64(*req.Quantity)
+		goods.Stock = &stock
+	}
+
+	if err := db.CreateGoods(goods, operatorOf(c)); err != nil {
+		return goodsError(resp, err)
+	}
+	return resp.SuccessWithData(toGoodsDetail(goods))
+}
+
+// HandleManageGoodsUpdate 更新商品，价格变化时生成新的价格版本
+func HandleManageGoodsUpdate(c *fiber.Ctx) error {
+	resp := utils.NewResponse(c)
+	var req GoodsRequest
+
+	id, err := goodsID(c)
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusBadRequest, "商品ID必须是有效的整数", "INVALID_PARAMS")
+	}
+
+	// 解析请求体
+	if err := c.BodyParser(&req); err != nil {
+		return resp.Fail(fiber.StatusBadRequest, fmt.Sprintf("Invalid request format: %v", err))
+	}
+
+	changes, err := toGoodsModel(&req)
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusBadRequest, err.Error(), "INVALID_PARAMS")
+	}
+	stock, err := stockChange(&req)
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusBadRequest, err.Error(), "INVALID_PARAMS")
+	}
+
+	goods, err := db.UpdateGoods(id, changes, stock, operatorOf(c))
+	if err != nil {
+		return goodsError(resp, err)
+	}
+	return resp.SuccessWithData(toGoodsDetail(goods))
+}
+
+// HandleManageGoodsEnable 上架商品
+func HandleManageGoodsEnable(c *fiber.Ctx) error {
+	return setGoodsDisabled(c, false)
+}
+
+// HandleManageGoodsDisable 下架商品
+func HandleManageGoodsDisable(c *fiber.Ctx) error {
+	return setGoodsDisabled(c, true)
+}
+
+// HandleManageGoodsDelete 软删除商品
+func HandleManageGoodsDelete(c *fiber.Ctx) error {
+	resp := utils.NewResponse(c)
+
+	id, err := goodsID(c)
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusBadRequest, "商品ID必须是有效的整数", "INVALID_PARAMS")
+	}
+	if err := db.DeleteGoods(id); err != nil {
+		return goodsError(resp, err)
+	}
+	return resp.Success()
+}
+
+// HandleManageGoodsPrices 查询商品价格版本
+func HandleManageGoodsPrices(c *fiber.Ctx) error {
+	resp := utils.NewResponse(c)
+
+	id, err := goodsID(c)
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusBadRequest, "商品ID必须是有效的整数", "INVALID_PARAMS")
+	}
+
+	prices, err := db.GetGoodsPrices(id)
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+	}
+
+	list := make([]fiber.Map, 0, len(prices))
+	for _, p := range prices {
+		list = append(list, fiber.Map{
+			"version":    p.Version,
+			"price":      p.Price,
+			"operator":   p.Operator,
+			"created_at": p.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+	return resp.SuccessWithData(list)
+}
+
+func setGoodsDisabled(c *fiber.Ctx, disabled bool) error {
+	resp := utils.NewResponse(c)
+
+	id, err := goodsID(c)
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusBadRequest, "商品ID必须是有效的整数", "INVALID_PARAMS")
+	}
+	if err := db.SetGoodsDisabled(id, disabled); err != nil {
+		return goodsError(resp, err)
+	}
+	return resp.Success()
+}
+
+// goodsID 解析路径中的商品ID
+func goodsID(c *fiber.Ctx) (uint, error) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	return uint(id), err
+}
+
+// goodsError 将商品相关错误转换为响应
+func goodsError(resp *utils.ResponseWrapper, err error) error {
+	switch {
+	case errors.Is(err, db.ErrGoodsNotFound):
+		return resp.FailWithCode(fiber.StatusNotFound, "商品不存在", "GOODS_NOT_FOUND")
+	case errors.Is(err, db.ErrGoodsDuplicated):
+		return resp.FailWithCode(fiber.StatusBadRequest, "商品项或SKU编码已存在", "GOODS_DUPLICATED")
+	case errors.Is(err, db.ErrInvalidStockChange):
+		return resp.FailWithCode(fiber.StatusBadRequest, "不限库存的商品不能增减库存，且库存不能小于0", "INVALID_STOCK")
+	default:
+		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+	}
+}
+
+// toGoodsModel 校验请求并转换为商品模型
+func toGoodsModel(req *GoodsRequest) (*db.GameGoods, error) {
+	if req.Item == "" {
+		return nil, errors.New("商品项不能为空")
+	}
+	if req.Price <= 0 {
+		return nil, errors.New("商品价格必须大于0")
+	}
+	if req.MinQuantity < 0 || req.MaxQuantity < 0 || req.PerUserLimit < 0 {
+		return nil, errors.New("数量限制不能为负数")
+	}
+	if req.MaxQuantity > 0 && req.MaxQuantity < req.MinQuantity {
+		return nil, errors.New("单笔最多购买数量不能小于最少购买数量")
+	}
+	if req.MinQuantity > db.MaxOrderQuantity || req.MaxQuantity > db.MaxOrderQuantity {
+		return nil, fmt.Errorf("单笔购买数量不能超过 %d", db.MaxOrderQuantity)
+	}
+	if req.SaleStartAt != nil && req.SaleEndAt != nil && !req.SaleEndAt.After(*req.SaleStartAt) {
+		return nil, errors.New("停售时间必须晚于开售时间")
+	}
+
+	images, err := json.Marshal(req.ImageList)
+	if err != nil {
+		return nil, err
+	}
+
+	goods := &db.GameGoods{
+		Item:         req.Item,
+		SinglePric:   money.FromMinor(int64(req.Price)),
+		Title:        req.Title,
+		ImageList:    string(images),
+		Type:         req.Type,
+		TagGroupID:   req.TagGroupID,
+		MinQuantity:  req.MinQuantity,
+		MaxQuantity:  req.MaxQuantity,
+		PerUserLimit: req.PerUserLimit,
+		SaleStartAt:  req.SaleStartAt,
+		SaleEndAt:    req.SaleEndAt,
+	}
+	if goods.MinQuantity == 0 {
+		goods.MinQuantity = 1
+	}
+	if req.SkuID != "" {
+		skuCode := req.SkuID
+		goods.SkuCode = &skuCode
+	}
+	return goods, nil
+}
+
+// stockChange 更新商品时的库存调整，未传 quantity 和 stock_delta 时不修改库存，
+// 避免覆盖读取商品之后下单扣减的库存
+func stockChange(req *GoodsRequest) (db.StockChange, error) {
+	if req.Quantity != nil && req.StockDelta != 0 {
+		return db.StockChange{}, errors.New("quantity 和 stock_delta 不能同时传")
+	}
+	if req.Quantity == nil {
+		return db.StockChange{Delta: req.StockDelta}, nil
+	}
+	change := db.StockChange{Set: true}
+	if *req.Quantity >= 0 {
+		stock := int64(*req.Quantity)
+		change.Value = &stock
+	}
+	return change, nil
+}
+
+// toGoodsDetail 商品模型转换为管理后台展示结构
+func toGoodsDetail(goods *db.GameGoods) GoodsDetail {
+	sku := conf.SkuList{
+		Price:      int(goods.SinglePric.Minor()),
+		Quantity:   -1,
+		Title:      goods.Title,
+		Type:       goods.Type,
+		TagGroupID: goods.TagGroupID,
+		ImageList:  []string{},
+	}
+	if goods.SkuCode != nil {
+		sku.SkuID = *goods.SkuCode
+	}
+	if goods.Stock != nil {
+		sku.Quantity = int(*goods.Stock)
+	}
+	if goods.ImageList != "" {
+		_ = json.Unmarshal([]byte(goods.ImageList), &sku.ImageList)
+	}
+
+	return GoodsDetail{
+		Id:           goods.ID,
+		Item:         goods.Item,
+		SinglePric:   goods.SinglePric,
+		PriceVersion: goods.PriceVersion,
+		Sku:          sku,
+		Stock:        goods.Stock,
+		MinQuantity:  goods.MinQuantity,
+		MaxQuantity:  goods.MaxQuantity,
+		PerUserLimit: goods.PerUserLimit,
+		SaleStartAt:  goods.SaleStartAt,
+		SaleEndAt:    goods.SaleEndAt,
+		Enabled:      !goods.Disabled,
+		CreatedAt:    goods.CreatedAt.Format("2006-01-02 15:04:05"),
+		UpdatedAt:    goods.UpdatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"api-pay/channel"
+	"api-pay/db"
+	"api-pay/orderstate"
+	"api-pay/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// OrderQueryRequest 强制查单请求
+type OrderQueryRequest struct {
+	Order string `json:"order"`
+}
+
+// HandleManageOrderQuery 管理后台强制向平台查询订单，平台确认已支付时立即入账
+func HandleManageOrderQuery(c *fiber.Ctx) error {
+	resp := utils.NewResponse(c)
+	var req OrderQueryRequest
+
+	// 解析请求体
+	if err := c.BodyParser(&req); err != nil {
+		return resp.Fail(fiber.StatusBadRequest, fmt.Sprintf("Invalid request format: %v", err))
+	}
+	if req.Order == "" {
+		return resp.FailWithCode(fiber.StatusBadRequest, "Missing required fields", "INVALID_PARAMS")
+	}
+
+	order, err := db.GetOrderByNo(req.Order)
+	if err != nil {
+		if errors.Is(err, db.ErrOrderNotFound) {
+			return resp.FailWithCode(fiber.StatusBadRequest, "订单不存在", "DATA_ERROR")
+		}
+		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+	}
+
+	n, err := channel.QueryAndApply(order, stateMeta(c, orderstate.ActorAdmin, "管理后台查单确认支付"))
+	if err == nil || errors.Is(err, channel.ErrPaymentReview) {
+		_ = db.MarkOrderQueried(order.ID)
+	}
+	if err != nil && !errors.Is(err, channel.ErrPaymentReview) {
+		switch {
+		case errors.Is(err, channel.ErrNotSupported):
+			return resp.FailWithCode(fiber.StatusBadRequest, "该支付渠道未开通查单接口", "QUERY_NOT_SUPPORTED")
+		case errors.Is(err, db.ErrOrderNotPayable), errors.Is(err, db.ErrAmountMismatch), errors.Is(err, db.ErrOrderPaidConflict):
+			return resp.FailWithCode(fiber.StatusConflict, fmt.Sprintf("平台支付信息与订单不一致: %v", err), "DATA_ERROR")
+		default:
+			return resp.FailWithCode(fiber.StatusBadGateway, fmt.Sprintf("查单失败: %v", err), "QUERY_FAILED")
+		}
+	}
+
+	// 重新读取入账后的订单状态
+	if latest, err := db.GetOrderByNo(req.Order); err == nil {
+		order = latest
+	}
+
+	return resp.SuccessWithData(&fiber.Map{
+		"order":          order.Order,
+		"channel":        order.Channel,
+		"status":         order.OrderStatus.String(),
+		"paid":           n.Paid,
+		"platform_order": n.PlatformOrderNo,
+		"amount":         n.Amount,
+		"review":         errors.Is(err, channel.ErrPaymentReview),
+	})
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"time"
+
+	"api-pay/db"
+	"api-pay/reconcile"
+	"api-pay/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// HandleManageReconciliation 查询某一天的对账报告，包括各结果的数量和明细
+func HandleManageReconciliation(c *fiber.Ctx) error {
+	resp := utils.NewResponse(c)
+	page, pageSize := pagination(c)
+
+	billDate := c.Query("date", time.Now().AddDate(0, 0, -1).Format(reconcile.DateLayout))
+	if _, err := time.ParseInLocation(reconcile.DateLayout, billDate, time.Local); err != nil {
+		return resp.FailWithCode(fiber.StatusBadRequest, "对账日期格式错误", "INVALID_PARAMS")
+	}
+
+	status := c.Query("status")
+	switch status {
+	case "", db.ReconcileMatched, db.ReconcileMissingLocal, db.ReconcileMissingRemote, db.ReconcileAmountMismatch, db.ReconcileOrderNoMismatch:
+	default:
+		return resp.FailWithCode(fiber.StatusBadRequest, "无效的对账结果", "INVALID_PARAMS")
+	}
+
+	counts, err := db.CountReconciliation(billDate)
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+	}
+	items, total, err := db.ListReconciliation(billDate, status, page, pageSize)
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+	}
+
+	list := make([]fiber.Map, 0, len(items))
+	for _, item := range items {
+		list = append(list, fiber.Map{
+			"status":        item.Status,
+			"game_order_no": item.GameOrderNo,
+			"gyyx_order_no": item.GyyxOrderNo,
+			"local_amount":  item.LocalAmount,
+			"remote_amount": item.RemoteAmount,
+			"server_flag":   item.ServerFlag,
+			"source_file":   item.SourceFile,
+			"message":       item.Message,
+			"created_at":    item.CreatedAt.Format(timeLayout),
+		})
+	}
+
+	return resp.SuccessWithData(&fiber.Map{
+		"bill_date": billDate,
+		"summary":   counts,
+		"list":      list,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"api-pay/db"
+	"api-pay/middleware"
+	"api-pay/money"
+	"api-pay/orderstate"
+	"api-pay/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+const timeLayout = "2006-01-02 15:04:05"
+
+// OrderView 订单信息
+type OrderView struct {
+	Order         string       `json:"order"`
+	UserId        string       `json:"user_id"`
+	Item          string       `json:"item"`
+	ItemId        uint         `json:"item_id"`
+	SinglePrice   money.Money  `json:"single_pric"`
+	AmountNum     int64        `json:"amount_num"`
+	TotalPrice    money.Money  `json:"total_price"`
+	Status        string       `json:"status"`
+	ServerFlag    string       `json:"server_flag"`
+	GameRoleId    string       `json:"game_role_id"`
+	GameRoleName  string       `json:"game_role_name"`
+	GameRoleGrade string       `json:"game_role_grade"`
+	CreatedAt     string       `json:"created_at"`
+	Payment       *PaymentView `json:"payment,omitempty"`
+}
+
+// PaymentView 支付信息
+type PaymentView struct {
+	GyyxOrderNo string      `json:"gyyx_order_no"`
+	Channel     string      `json:"channel"`
+	RmbYuan     money.Money `json:"rmb_yuan"`
+	Result      string      `json:"result"`
+	PaidAt      string      `json:"paid_at"`
+}
+
+// HandleOrderDetail 查询订单的完整生命周期：订单、支付、发货、退款及状态变更记录
+func HandleOrderDetail(c *fiber.Ctx) error {
+	resp := utils.NewResponse(c)
+
+	orderNo := c.Params("order")
+	userId := c.Query("user_id")
+	if orderNo == "" || userId == "" {
+		return resp.FailWithCode(fiber.StatusBadRequest, "Missing required fields", "INVALID_PARAMS")
+	}
+
+	order, err := db.GetOrderByNo(orderNo)
+	if err != nil || !ownsOrder(c, order, userId) {
+		return resp.FailWithCode(fiber.StatusNotFound, "订单不存在", "ORDER_NOT_FOUND")
+	}
+
+	pay, err := db.GetOrderPayByOrderNo(orderNo)
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+	}
+	delivery, err := db.GetOrderDelivery(orderNo)
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+	}
+	refunds, err := db.GetOrderRefunds(orderNo)
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+	}
+	events, err := db.GetOrderEvents(orderNo)
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+	}
+
+	data := fiber.Map{
+		"order": toOrderView(order, pay),
+	}
+
+	if delivery != nil {
+		deliveryView := fiber.Map{
+			"status":   delivery.Status,
+			"attempts": delivery.Attempts,
+		}
+		if delivery.DeliveredAt != nil {
+			deliveryView["delivered_at"] = delivery.DeliveredAt.Format(timeLayout)
+		}
+		data["delivery"] = deliveryView
+	}
+
+	refundViews := make([]fiber.Map, 0, len(refunds))
+	for _, r := range refunds {
+		refundViews = append(refundViews, fiber.Map{
+			"refund_no":  r.RefundNo,
+			"amount":     r.Amount,
+			"reason":     r.Reason,
+			"status":     r.Status,
+			"created_at": r.CreatedAt.Format(timeLayout),
+		})
+	}
+	data["refunds"] = refundViews
+
+	eventViews := make([]fiber.Map, 0, len(events))
+	for _, e := range events {
+		eventViews = append(eventViews, fiber.Map{
+			"from":       e.FromStatus.String(),
+			"to":         e.ToStatus.String(),
+			"actor":      e.Actor,
+			"reason":     e.Reason,
+			"created_at": e.CreatedAt.Format(timeLayout),
+		})
+	}
+	data["events"] = eventViews
+
+	return resp.SuccessWithData(data)
+}
+
+// HandleOrderList 按条件查询用户订单，基于雪花订单号游标分页
+func HandleOrderList(c *fiber.Ctx) error {
+	resp := utils.NewResponse(c)
+
+	filter := db.OrderFilter{
+		UserId:     c.Query("user_id"),
+		AppKey:     middleware.GetAppKey(c),
+		Item:       c.Query("item"),
+		ServerFlag: c.Query("server_flag"),
+		Limit:      c.QueryInt("limit", 20),
+	}
+	if filter.UserId == "" {
+		return resp.FailWithCode(fiber.StatusBadRequest, "Missing required fields", "INVALID_PARAMS")
+	}
+	if filter.Limit < 1 || filter.Limit > 100 {
+		filter.Limit = 20
+	}
+
+	if status := c.Query("status"); status != "" {
+		s, ok := orderstate.Parse(status)
+		if !ok {
+			return resp.FailWithCode(fiber.StatusBadRequest, "无效的订单状态", "INVALID_PARAMS")
+		}
+		filter.Status = &s
+	}
+
+	var err error
+	if filter.StartTime, err = parseTimeQuery(c, "start_time"); err != nil {
+		return resp.FailWithCode(fiber.StatusBadRequest, "开始时间格式错误", "INVALID_PARAMS")
+	}
+	if filter.EndTime, err = parseTimeQuery(c, "end_time"); err != nil {
+		return resp.FailWithCode(fiber.StatusBadRequest, "结束时间格式错误", "INVALID_PARAMS")
+	}
+
+	// 游标为上一页最后一个订单号
+	if cursor := c.Query("cursor"); cursor != "" {
+		if filter.Cursor = db.ParseOrderSeq(cursor); filter.Cursor == 0 {
+			return resp.FailWithCode(fiber.StatusBadRequest, "无效的游标", "INVALID_PARAMS")
+		}
+	}
+
+	orders, err := db.ListOrders(filter)
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+	}
+
+	orderNos := make([]string, 0, len(orders))
+	for _, o := range orders {
+		orderNos = append(orderNos, o.Order)
+	}
+	pays, err := db.GetOrderPaysByOrderNos(orderNos)
+	if err != nil {
+		return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+	}
+
+	list := make([]OrderView, 0, len(orders))
+	for i := range orders {
+		list = append(list, toOrderView(&orders[i], pays[orders[i].Order]))
+	}
+
+	nextCursor := ""
+	if len(orders) == filter.Limit {
+		nextCursor = orders[len(orders)-1].Order
+	}
+
+	return resp.SuccessWithData(&fiber.Map{
+		"list":        list,
+		"next_cursor": nextCursor,
+	})
+}
+
+// ownsOrder 订单属于该用户，且由当前客户端创建（未记录客户端的历史订单只校验用户）
+func ownsOrder(c *fiber.Ctx, order *db.GameOrder, userId string) bool {
+	if order.UserId != userId {
+		return false
+	}
+	appKey := middleware.GetAppKey(c)
+	return appKey == "" || order.AppKey == "" || order.AppKey == appKey
+}
+
+// parseTimeQuery 解析 2006-01-02 15:04:05 格式的时间参数，未传时返回 nil
+func parseTimeQuery(c *fiber.Ctx, key string) (*time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.ParseInLocation(timeLayout, value, time.Local)
+	if err != nil {
+		// 兼容秒级时间戳
+		sec, convErr := strconv.ParseInt(value, 10, 64)
+		if convErr != nil {
+			return nil, err
+		}
+		t = time.Unix(sec, 0)
+	}
+	return &t, nil
+}
+
+// toOrderView 订单及支付记录转换为展示结构
+func toOrderView(order *db.GameOrder, pay *db.GameOrderPay) OrderView {
+	view := OrderView{
+		Order:         order.Order,
+		UserId:        order.UserId,
+		Item:          order.Item,
+		ItemId:        order.ItemId,
+		SinglePrice:   order.SinglePrice,
+		AmountNum:     order.AmountNum,
+		TotalPrice:    order.TotalPrice,
+		Status:        order.OrderStatus.String(),
+		ServerFlag:    order.ServerFlag,
+		GameRoleId:    order.GameRoleId,
+		GameRoleName:  order.GameRoleName,
+		GameRoleGrade: order.GameRoleGrade,
+		CreatedAt:     order.CreatedAt.Format(timeLayout),
+	}
+	if pay != nil {
+		view.Payment = &PaymentView{
+			GyyxOrderNo: pay.GyyxOrderNo,
+			Channel:     pay.Channel,
+			RmbYuan:     pay.RmbYuan,
+			Result:      pay.Result,
+			PaidAt:      pay.CreatedAt.Format(timeLayout),
+		}
+	}
+	return view
+}
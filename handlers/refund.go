@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"api-pay/channel"
+	"api-pay/db"
+	initialization "api-pay/init"
+	"api-pay/money"
+	"api-pay/orderstate"
+	"api-pay/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RefundRequest 退款申请
+type RefundRequest struct {
+	UserId string      `json:"user_id"`
+	Order  string      `json:"order"`
+	Amount money.Money `json:"amount"`
+	Reason string      `json:"reason"`
+}
+
+// HandleRefund 为已支付订单创建退款申请，支持部分退款
+func HandleRefund(c *fiber.Ctx) error {
+	resp := utils.NewResponse(c)
+	var req RefundRequest
+
+	// 解析请求体
+	if err := c.BodyParser(&req); err != nil {
+		return resp.Fail(fiber.StatusBadRequest, fmt.Sprintf("Invalid request format: %v", err))
+	}
+
+	// 验证必要字段
+	if req.UserId == "" || req.Order == "" || !req.Amount.IsPositive() {
+		return resp.FailWithCode(fiber.StatusBadRequest, "Missing required fields", "INVALID_PARAMS")
+	}
+
+	traceID, _ := c.Locals("trace_id").(string)
+	refund := db.GameOrderRefund{
+		RefundNo:    initialization.SnowFlake.NextID("812"),
+		GameOrderNo: req.Order,
+		UserId:      req.UserId,
+		Amount:      req.Amount,
+		Reason:      req.Reason,
+		TraceID:     traceID,
+	}
+
+	if err := db.CreateRefund(&refund); err != nil {
+		switch {
+		case errors.Is(err, db.ErrOrderNotFound):
+			return resp.FailWithCode(fiber.StatusBadRequest, "订单不存在", "DATA_ERROR")
+		case errors.Is(err, db.ErrRefundNotAllowed):
+			return resp.FailWithCode(fiber.StatusBadRequest, "订单未支付或已全额退款", "REFUND_NOT_ALLOWED")
+		case errors.Is(err, db.ErrRefundAmount):
+			return resp.FailWithCode(fiber.StatusBadRequest, "退款金额超过可退金额", "REFUND_AMOUNT_INVALID")
+		default:
+			return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+		}
+	}
+
+	// 向支付渠道提交退款，渠道未开通退款接口时保持待处理，由人工在平台操作
+	if err := submitRefund(c, &refund); err != nil {
+		return resp.FailWithCode(fiber.StatusBadGateway, fmt.Sprintf("退款提交失败: %v", err), "REFUND_SUBMIT_FAILED")
+	}
+
+	return resp.SuccessWithData(&fiber.Map{
+		"message":   "退款申请已提交",
+		"refund_no": refund.RefundNo,
+		"order":     refund.GameOrderNo,
+		"amount":    refund.Amount,
+		"status":    refund.Status,
+	})
+}
+
+// submitRefund 调用订单支付渠道的退款接口，提交失败时退款单置为失败，释放可退金额
+func submitRefund(c *fiber.Ctx, refund *db.GameOrderRefund) error {
+	pay, err := db.GetOrderPayByOrderNo(refund.GameOrderNo)
+	if err != nil || pay == nil {
+		return err
+	}
+	ch, ok := channel.Get(pay.Channel)
+	if !ok {
+		return nil
+	}
+
+	receipt, err := ch.Refund(c.UserContext(), pay, refund)
+	switch {
+	case errors.Is(err, channel.ErrNotSupported):
+		return nil
+	case err != nil:
+		result := db.RefundResult{RefundNo: refund.RefundNo, Message: err.Error()}
+		if _, _, markErr := db.CompleteRefund(result, stateMeta(c, orderstate.ActorSystem, "退款提交失败")); markErr != nil {
+			return markErr
+		}
+		refund.Status = db.RefundFailed
+		return err
+	}
+
+	refund.PlatformRefundNo = receipt.PlatformRefundNo
+	return db.SetRefundPlatformNo(refund.RefundNo, receipt.PlatformRefundNo)
+}
+
+// HandleRefundNotify 处理平台退款结果通知，渠道由路由参数 :channel 指定，
+// 通知只能完成该渠道订单的退款
+func HandleRefundNotify(c *fiber.Ctx) error {
+	name := c.Params("channel", channel.Feizhu)
+	ch, ok := channel.Get(name)
+	if !ok {
+		return utils.NewResponse(c).FailWithCode(fiber.StatusNotFound, "不支持的支付渠道", "CHANNEL_NOT_FOUND")
+	}
+
+	// 解析参数并校验签名及时间戳
+	result, err := ch.ParseRefundNotify(c)
+	if err != nil {
+		var e *channel.Error
+		if !errors.As(err, &e) {
+			e = &channel.Error{Status: fiber.StatusBadRequest, State: "Invalid request format", Code: "INVALID_PARAMS"}
+		}
+		return ch.Ack(c, channel.AckError(e))
+	}
+
+	// 重复通知直接返回成功
+	meta := stateMeta(c, orderstate.ActorPlatform, "退款结果通知")
+	if _, _, err := db.CompleteRefund(*result, meta); err != nil {
+		return ch.Ack(c, refundNotifyAck(err))
+	}
+	return ch.Ack(c, channel.AckOK())
+}
+
+// refundNotifyAck 退款结果处理失败时的应答
+func refundNotifyAck(err error) channel.Ack {
+	switch {
+	case errors.Is(err, db.ErrRefundNotFound), errors.Is(err, db.ErrOrderNotFound):
+		return channel.AckError(&channel.Error{Status: fiber.StatusBadRequest, State: "退款单不存在", Code: "DATA_ERROR"})
+	case errors.Is(err, db.ErrRefundMismatch):
+		return channel.AckError(&channel.Error{Status: fiber.StatusBadRequest, State: "退款单与订单、渠道或金额不匹配", Code: "DATA_ERROR"})
+	default:
+		return channel.AckError(&channel.Error{Status: fiber.StatusInternalServerError, State: "Database error", Code: "DB_ERROR"})
+	}
+}
@@ -5,6 +5,8 @@ import (
 
 	config "api-pay/config"
 	"api-pay/db"
+	"api-pay/metrics"
+	"api-pay/tracing"
 	"api-pay/utils"
 )
 
@@ -29,10 +31,23 @@ func Initialization() {
 		log.Fatal("Failed to connect to database ")
 	}
 
-	//// 初始化Redis
-	//if err := db.InitRedis(); err != nil {
-	//	log.Fatal("Failed to connect to redis ")
-	//}
+	// 采集数据库语句耗时和连接池指标
+	if err := metrics.RegisterDB(db.DB); err != nil {
+		log.Printf("Failed to register database metrics: %v", err)
+	}
+
+	// 数据库语句链路追踪
+	if err := tracing.RegisterDB(db.DB); err != nil {
+		log.Printf("Failed to register database tracing: %v", err)
+	}
+
+	// 初始化Redis，未配置或连接失败时防重放等功能退化为进程内实现
+	if config.AppConfig.Redis.Addr != "" {
+		if err := db.InitRedis(); err != nil {
+			log.Printf("Failed to connect to redis, falling back to in-memory store: %v", err)
+			db.RedisClient = nil
+		}
+	}
 
 	//// 初始化机器人
 	//wxbot.InitBot()
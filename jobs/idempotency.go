@@ -0,0 +1,61 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"api-pay/db"
+	initialization "api-pay/init"
+
+	"go.uber.org/zap"
+)
+
+const (
+	idempotencyPurgeLock     = "api-pay:idempotency-purge"
+	idempotencyPurgeBatch    = 1000
+	idempotencyPurgeInterval = time.Hour
+)
+
+// StartIdempotencyPurger 定时清理过期的幂等键记录。
+// 幂等配置支持热加载，未启用时也运行，清理启用期间留下的记录。
+func StartIdempotencyPurger(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(idempotencyPurgeInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purgeIdempotencyKeys(ctx)
+			}
+		}
+	}()
+}
+
+// purgeIdempotencyKeys 执行一轮清理
+func purgeIdempotencyKeys(ctx context.Context) {
+	logger := initialization.GetCurrentLogger()
+
+	release, ok, err := db.TryAdvisoryLock(ctx, idempotencyPurgeLock)
+	if err != nil {
+		logger.Error("idempotency purge: acquire lock failed", zap.Error(err))
+		return
+	}
+	if !ok {
+		return
+	}
+	defer release()
+
+	for {
+		n, err := db.PurgeIdempotencyKeys(time.Now(), idempotencyPurgeBatch)
+		if err != nil {
+			logger.Error("idempotency purge: delete failed", zap.Error(err))
+			return
+		}
+		if n < idempotencyPurgeBatch || ctx.Err() != nil {
+			return
+		}
+	}
+}
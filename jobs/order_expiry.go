@@ -0,0 +1,77 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	conf "api-pay/config"
+	"api-pay/db"
+	initialization "api-pay/init"
+	"api-pay/orderstate"
+
+	"go.uber.org/zap"
+)
+
+const (
+	orderExpiryLock  = "api-pay:order-expiry"
+	orderExpiryBatch = 200
+)
+
+// StartOrderExpirySweeper 定时将超过有效期的未支付订单置为已过期。
+// 主备实例都会启动该任务，通过 MySQL 命名锁保证同一时刻只有一个实例在扫描，
+// 单个订单的迁移本身也是条件更新，即使锁失效也不会重复处理。
+func StartOrderExpirySweeper(ctx context.Context) {
+	if conf.OrderTTL() <= 0 {
+		return
+	}
+
+	interval := time.Duration(conf.AppConfig.Order.SweepInterval) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				sweepExpiredOrders(ctx)
+			}
+		}
+	}()
+}
+
+// sweepExpiredOrders 执行一轮过期扫描
+func sweepExpiredOrders(ctx context.Context) {
+	logger := initialization.GetCurrentLogger()
+
+	release, ok, err := db.TryAdvisoryLock(ctx, orderExpiryLock)
+	if err != nil {
+		logger.Error("order expiry: acquire lock failed", zap.Error(err))
+		return
+	}
+	if !ok {
+		return
+	}
+	defer release()
+
+	meta := orderstate.Meta{Actor: orderstate.ActorSystem, Reason: "订单超时未支付"}
+	cutoff := time.Now().Add(-conf.OrderTTL())
+	for {
+		n, err := db.ExpireOrders(cutoff, orderExpiryBatch, meta)
+		if err != nil {
+			logger.Error("order expiry: sweep failed", zap.Error(err))
+			return
+		}
+		if n > 0 {
+			logger.Info("order expiry: orders expired", zap.Int("count", n))
+		}
+		if n < orderExpiryBatch || ctx.Err() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"api-pay/channel"
+	conf "api-pay/config"
+	"api-pay/db"
+	initialization "api-pay/init"
+	"api-pay/orderstate"
+
+	"go.uber.org/zap"
+)
+
+const (
+	orderQueryLock  = "api-pay:order-query"
+	orderQueryBatch = 100
+)
+
+// StartOrderQueryPoller 定时向平台查询长时间未支付的订单，补偿丢失的支付回调。
+// 与过期扫描一样通过 MySQL 命名锁保证同一时刻只有一个实例在查单。
+func StartOrderQueryPoller(ctx context.Context) {
+	if conf.AppConfig.Order.QueryDelay <= 0 {
+		return
+	}
+
+	interval := time.Duration(conf.AppConfig.Order.QueryInterval) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				pollPendingOrders(ctx)
+			}
+		}
+	}()
+}
+
+// pollPendingOrders 执行一轮查单
+func pollPendingOrders(ctx context.Context) {
+	logger := initialization.GetCurrentLogger()
+
+	release, ok, err := db.TryAdvisoryLock(ctx, orderQueryLock)
+	if err != nil {
+		logger.Error("order query: acquire lock failed", zap.Error(err))
+		return
+	}
+	if !ok {
+		return
+	}
+	defer release()
+
+	before := time.Now().Add(-time.Duration(conf.AppConfig.Order.QueryDelay) * time.Minute)
+	if err := queryPendingOrders(ctx, before); err != nil {
+		logger.Error("order query: round aborted", zap.Error(err))
+	}
+}
+
+// queryPendingOrders 按订单ID顺序分批查询 before 之前创建的未支付订单。
+// 记录查单时间失败时结束本轮，避免反复查询同一批订单。
+func queryPendingOrders(ctx context.Context, before time.Time) error {
+	meta := orderstate.Meta{Actor: orderstate.ActorSystem, Reason: "主动查单确认支付"}
+	var afterID uint
+	for {
+		orders, err := db.ListOrdersToQuery(before, afterID, orderQueryBatch)
+		if err != nil {
+			return fmt.Errorf("list orders: %w", err)
+		}
+
+		for i := range orders {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err := queryOrder(&orders[i], meta); err != nil {
+				return fmt.Errorf("mark order %s queried: %w", orders[i].Order, err)
+			}
+			afterID = orders[i].ID
+		}
+		if len(orders) < orderQueryBatch {
+			return nil
+		}
+	}
+}
+
+// queryOrder 查询单个订单，无论结果如何都记录查单时间，避免同一订单被反复查询。
+// 只返回记录查单时间的错误，查单本身的错误记录日志后跳过
+func queryOrder(order *db.GameOrder, meta orderstate.Meta) error {
+	logger := initialization.GetCurrentLogger()
+
+	n, err := channel.QueryAndApply(order, meta)
+	if markErr := db.MarkOrderQueried(order.ID); markErr != nil {
+		return markErr
+	}
+
+	switch {
+	case errors.Is(err, channel.ErrNotSupported):
+	case errors.Is(err, channel.ErrPaymentReview):
+		logger.Warn("order query: paid after expiry, sent to review", zap.String("order", order.Order))
+	case err != nil:
+		logger.Error("order query: failed", zap.String("order", order.Order), zap.String("channel", order.Channel), zap.Error(err))
+	case n.Paid:
+		logger.Info("order query: payment confirmed", zap.String("order", order.Order), zap.String("platform_order", n.PlatformOrderNo))
+	}
+	return nil
+}
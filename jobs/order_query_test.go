@@ -0,0 +1,179 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	conf "api-pay/config"
+	"api-pay/db"
+	"api-pay/db/dbtest"
+	"api-pay/money"
+	"api-pay/orderstate"
+	"api-pay/sign"
+	"api-pay/utils"
+
+	"gorm.io/gorm"
+)
+
+const testSecret = "secret"
+
+// mockPlatform 进程内模拟飞猪查单接口，paid 中的订单返回已支付
+type mockPlatform struct {
+	mu      sync.Mutex
+	paid    map[string]string // 订单号 -> 支付金额（元）
+	queries []string
+}
+
+func (p *mockPlatform) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var params map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil || r.URL.Path != "/order/query" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := sign.Verify(params, params["sign_type"], params["sign"], testSecret); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	orderNo := params["game_order_no"]
+	p.mu.Lock()
+	p.queries = append(p.queries, orderNo)
+	amount, paid := p.paid[orderNo]
+	p.mu.Unlock()
+
+	data := map[string]string{"result": "", "result_message": "未支付"}
+	if paid {
+		data = map[string]string{
+			"gyyx_order_no":  "P" + orderNo,
+			"result":         string(utils.ResultSuccess),
+			"result_message": "支付成功",
+			"rmb_yuan":       amount,
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(utils.Response{Result: string(utils.ResultSuccess), Data: data})
+}
+
+func (p *mockPlatform) queried() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.queries...)
+}
+
+// setupPoller 准备数据库、飞猪商户和模拟平台，日志写入临时目录
+func setupPoller(t *testing.T, paid map[string]string) *mockPlatform {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	dbtest.Open(t)
+	platform := &mockPlatform{paid: paid}
+	server := httptest.NewServer(platform)
+	t.Cleanup(server.Close)
+
+	saved := conf.AppConfig
+	t.Cleanup(func() { conf.AppConfig = saved })
+	conf.AppConfig.Pay.Merchants = []conf.Merchant{{Secret: testSecret, APIBase: server.URL}}
+	return platform
+}
+
+// createUnpaidOrders 创建 n 个一小时前下单的未支付订单，订单号为 811-1 起
+func createUnpaidOrders(t *testing.T, n int) {
+	t.Helper()
+	created := time.Now().Add(-time.Hour)
+	for i := 1; i <= n; i++ {
+		order := db.GameOrder{
+			UserId:      fmt.Sprintf("u%d", i),
+			Item:        "gem",
+			Order:       fmt.Sprintf("811-%d", i),
+			SinglePrice: money.FromMinor(100),
+			TotalPrice:  money.FromMinor(100),
+			AmountNum:   1,
+			Channel:     "feizhu",
+			CreatedAt:   created,
+		}
+		if err := db.DB.Create(&order).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestQueryPendingOrders(t *testing.T) {
+	platform := setupPoller(t, map[string]string{"811-2": "1.00", "811-104": "1.00"})
+	count := orderQueryBatch + 5
+	createUnpaidOrders(t, count)
+
+	before := time.Now().Add(-time.Minute)
+	if err := queryPendingOrders(context.Background(), before); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(platform.queried()); got != count {
+		t.Fatalf("queried %d orders, want %d", got, count)
+	}
+
+	for orderNo, want := range map[string]orderstate.State{"811-1": orderstate.Created, "811-2": orderstate.Paid, "811-104": orderstate.Paid} {
+		order, err := db.GetOrderByNo(orderNo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if order.OrderStatus != want {
+			t.Errorf("%s status = %s, want %s", orderNo, order.OrderStatus, want)
+		}
+		if order.QueriedAt == nil {
+			t.Errorf("%s queried_at not recorded", orderNo)
+		}
+	}
+
+	// 查过的订单在下一个查单周期前不会重复查询
+	if err := queryPendingOrders(context.Background(), before); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(platform.queried()); got != count {
+		t.Fatalf("orders queried again: %d queries", got)
+	}
+}
+
+func TestQueryPendingOrdersMarkFailure(t *testing.T) {
+	platform := setupPoller(t, nil)
+	createUnpaidOrders(t, 3)
+
+	// 记录查单时间失败，订单仍会被再次列出
+	errMark := errors.New("mark failed")
+	if err := db.DB.Callback().Update().Before("gorm:update").Register("test:fail_mark", func(tx *gorm.DB) {
+		if dest, ok := tx.Statement.Dest.(map[string]interface{}); ok {
+			if _, ok := dest["queried_at"]; ok {
+				tx.AddError(errMark)
+			}
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- queryPendingOrders(context.Background(), time.Now().Add(-time.Minute)) }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, errMark) {
+			t.Fatalf("queryPendingOrders = %v, want mark error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("queryPendingOrders did not stop after mark failure")
+	}
+	if got := platform.queried(); len(got) != 1 {
+		t.Fatalf("queried %v, want only the first order", got)
+	}
+}
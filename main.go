@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
@@ -11,17 +12,36 @@ import (
 	"time"
 
 	conf "api-pay/config"
+	"api-pay/delivery"
 	initialization "api-pay/init"
+	"api-pay/jobs"
 	"api-pay/middleware"
 	"api-pay/routes"
+	"api-pay/tracing"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
 )
 
 func main() {
+	// 子命令：对账、初始化管理员
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "reconcile":
+			os.Exit(runReconcile(os.Args[2:]))
+		case "admin":
+			os.Exit(runAdmin(os.Args[2:]))
+		}
+	}
+
 	initialization.Initialization()
 
+	// 初始化链路追踪，失败时不导出 span
+	shutdownTracing, err := tracing.Init(context.Background(), tracingOptions())
+	if err != nil {
+		fmt.Printf("Error initializing tracing: %v\n", err)
+		shutdownTracing = func(context.Context) error { return nil }
+	}
+
 	port := getPort()
 
 	app := fiber.New(fiber.Config{
@@ -32,18 +52,11 @@ func main() {
 	})
 
 	// 启用 CORS 中间件，放在其他中间件之前
-	app.Use(cors.New(cors.Config{
-		AllowOrigins:     conf.AppConfig.Cors.AllowOrigins, // 允许的前端域名
-		AllowMethods:     conf.AppConfig.Cors.AllowMethods, // 允许的方法
-		AllowHeaders:     conf.AppConfig.Cors.AllowHeaders, // 允许的请求头
-		AllowCredentials: false,                            // 是否允许发送 Cookie 或凭证
-	}))
+	app.Use(middleware.CORSMiddleware())
 
 	// 使用请求日志中间件
 	app.Use(middleware.RequestLogger(middleware.RequestLoggerConfig{
-		Logger:       initialization.GetCurrentLogger(),
-		SkipPaths:    conf.AppConfig.Logging.SkipPaths,
-		ExcludePaths: conf.AppConfig.Logging.ExcludePaths,
+		Logger: initialization.GetCurrentLogger(),
 	}))
 
 	// 初始化IP白名单配置
@@ -52,8 +65,29 @@ func main() {
 	// 添加IP白名单中间件 (需要在认证中间件之前)
 	app.Use(middleware.IPWhitelistMiddleware(ipConfig))
 
+	// 客户端接口签名认证
+	app.Use(middleware.AppAuthMiddleware())
+
+	// 接口限流，按 app key 限流依赖签名认证的结果
+	app.Use(middleware.RateLimitMiddleware())
+
+	// Idempotency-Key 幂等请求
+	app.Use(middleware.IdempotencyMiddleware())
+
 	routes.InitRoutes(app)
 
+	// 启动后台任务，主备实例都会运行，任务内部保证互斥
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	jobs.StartOrderExpirySweeper(jobCtx)
+	jobs.StartOrderQueryPoller(jobCtx)
+	jobs.StartIdempotencyPurger(jobCtx)
+	delivery.StartWorker(jobCtx)
+
+	// 配置热加载：IP白名单、跨域、日志、认证、限流、幂等配置修改后无需重启
+	if interval := conf.AppConfig.App.ConfigReload; interval > 0 {
+		conf.Watch(jobCtx, conf.ConfigFile, time.Duration(interval)*time.Second)
+	}
+
 	// 捕获所有未匹配的路由
 	app.Use(func(c *fiber.Ctx) error {
 		return c.Status(http.StatusNotFound).SendString("Hi - This is a bad request. Please stop accessing it !")
@@ -61,7 +95,7 @@ func main() {
 
 	// 创建通道监听信号
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGUSR2)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGUSR2, syscall.SIGHUP)
 
 	// 创建关闭通道
 	done := make(chan bool, 1)
@@ -71,6 +105,12 @@ func main() {
 			sig := <-sigChan
 			fmt.Printf("Received signal: %v on port %d\n", sig, port)
 
+			if sig == syscall.SIGHUP {
+				// 重新加载配置
+				conf.ReloadAndLog(conf.ConfigFile)
+				continue
+			}
+
 			if sig == syscall.SIGUSR2 {
 				// 启动新实例
 				if err := startNewInstance(port); err != nil {
@@ -78,6 +118,7 @@ func main() {
 					continue
 				}
 			} else {
+				stopJobs()
 				if err := app.ShutdownWithTimeout(3 * time.Second); err != nil {
 					fmt.Printf("Error during shutdown on port %d: %v\n", port, err)
 				}
@@ -94,6 +135,30 @@ func main() {
 	}
 
 	<-done // 等待关闭信号
+
+	// 导出剩余的 span
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		fmt.Printf("Error shutting down tracing: %v\n", err)
+	}
+}
+
+// tracingOptions 链路追踪配置，服务名默认使用应用名
+func tracingOptions() tracing.Options {
+	cfg := conf.AppConfig.Tracing
+	opts := tracing.Options{
+		ServiceName: cfg.ServiceName,
+		Exporter:    cfg.Exporter,
+		Endpoint:    cfg.Endpoint,
+		Insecure:    cfg.Insecure,
+		File:        cfg.File,
+		SampleRatio: cfg.SampleRatio,
+	}
+	if opts.ServiceName == "" {
+		opts.ServiceName = conf.AppConfig.App.Name
+	}
+	return opts
 }
 
 // 获取端口配置
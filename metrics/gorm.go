@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+)
+
+const dbStartKey = "metrics:start"
+
+var dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "db_query_duration_seconds",
+	Help:      "数据库语句耗时",
+	Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+}, []string{"operation", "table"})
+
+// RegisterDB 为 GORM 注册语句耗时回调，并采集连接池状态
+func RegisterDB(gdb *gorm.DB) error {
+	sqlDB, err := gdb.DB()
+	if err != nil {
+		return err
+	}
+	if err := registry.Register(collectors.NewDBStatsCollector(sqlDB, "mysql")); err != nil {
+		return err
+	}
+
+	cb := gdb.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("metrics:before_create", startTimer),
+		cb.Create().After("gorm:create").Register("metrics:after_create", observeQuery("create")),
+		cb.Query().Before("gorm:query").Register("metrics:before_query", startTimer),
+		cb.Query().After("gorm:query").Register("metrics:after_query", observeQuery("query")),
+		cb.Update().Before("gorm:update").Register("metrics:before_update", startTimer),
+		cb.Update().After("gorm:update").Register("metrics:after_update", observeQuery("update")),
+		cb.Delete().Before("gorm:delete").Register("metrics:before_delete", startTimer),
+		cb.Delete().After("gorm:delete").Register("metrics:after_delete", observeQuery("delete")),
+		cb.Row().Before("gorm:row").Register("metrics:before_row", startTimer),
+		cb.Row().After("gorm:row").Register("metrics:after_row", observeQuery("row")),
+		cb.Raw().Before("gorm:raw").Register("metrics:before_raw", startTimer),
+		cb.Raw().After("gorm:raw").Register("metrics:after_raw", observeQuery("raw")),
+	)
+}
+
+func startTimer(tx *gorm.DB) {
+	tx.InstanceSet(dbStartKey, time.Now())
+}
+
+func observeQuery(operation string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		value, ok := tx.InstanceGet(dbStartKey)
+		if !ok {
+			return
+		}
+		start, ok := value.(time.Time)
+		if !ok {
+			return
+		}
+		dbQueryDuration.WithLabelValues(operation, tx.Statement.Table).Observe(time.Since(start).Seconds())
+	}
+}
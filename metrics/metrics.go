@@ -0,0 +1,120 @@
+// Package metrics 提供 Prometheus 指标：HTTP 请求、订单与支付业务、数据库查询和连接池
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	conf "api-pay/config"
+	"api-pay/money"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "apipay"
+
+var registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP 请求数",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP 请求耗时",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	ordersCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orders_created_total",
+		Help:      "创建的订单数",
+	}, []string{"item", "server_flag"})
+
+	ordersCancelled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orders_cancelled_total",
+		Help:      "用户取消的订单数",
+	}, []string{"item", "server_flag"})
+
+	ordersPaid = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orders_paid_total",
+		Help:      "支付成功的订单数",
+	}, []string{"item", "server_flag", "channel"})
+
+	paidAmount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "paid_amount_yuan_total",
+		Help:      "支付成功的金额，单位元",
+	}, []string{"item", "server_flag", "channel"})
+
+	callbackFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "callback_failures_total",
+		Help:      "处理失败的支付回调数",
+	}, []string{"channel", "code"})
+)
+
+func init() {
+	registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		ordersCreated, ordersCancelled, ordersPaid, paidAmount,
+		callbackFailures,
+		dbQueryDuration,
+	)
+}
+
+// Handler Prometheus 抓取接口
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+}
+
+// ObserveHTTP 记录一次 HTTP 请求，route 为路由模板（如 /api/order/:order），避免路径参数导致标签过多
+func ObserveHTTP(method, route string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(method, route, code).Inc()
+	httpDuration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+}
+
+// Unknown 取值不在配置中的标签值，避免客户端传入的任意值产生大量时间序列
+const Unknown = "unknown"
+
+// OrderCreated 记录创建订单
+func OrderCreated(item, serverFlag string) {
+	ordersCreated.WithLabelValues(item, serverFlagLabel(serverFlag)).Inc()
+}
+
+// OrderCancelled 记录用户取消订单
+func OrderCancelled(item, serverFlag string) {
+	ordersCancelled.WithLabelValues(item, serverFlagLabel(serverFlag)).Inc()
+}
+
+// OrderPaid 记录订单支付成功及金额
+func OrderPaid(item, serverFlag, channel string, amount money.Money) {
+	serverFlag = serverFlagLabel(serverFlag)
+	ordersPaid.WithLabelValues(item, serverFlag, channel).Inc()
+	paidAmount.WithLabelValues(item, serverFlag, channel).Add(float64(amount.Minor()) / 100)
+}
+
+// serverFlagLabel 服务器标识来自客户端请求，仅使用发货地址或商户中配置过的值
+func serverFlagLabel(serverFlag string) string {
+	if conf.KnownServerFlag(serverFlag) {
+		return serverFlag
+	}
+	return Unknown
+}
+
+// CallbackFailed 记录处理失败的支付回调
+func CallbackFailed(channel, code string) {
+	callbackFailures.WithLabelValues(channel, code).Inc()
+}
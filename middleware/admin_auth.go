@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"errors"
+	"strings"
+
+	"api-pay/auth"
+	"api-pay/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminAuthMiddleware 管理后台认证中间件，校验 Authorization: Bearer <access_token>
+func AdminAuthMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		resp := utils.NewResponse(c)
+
+		token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !ok || token == "" {
+			return resp.FailWithCode(fiber.StatusUnauthorized, "请先登录", "401010")
+		}
+
+		claims, err := auth.ParseToken(token, auth.TokenAccess)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidToken) {
+				return resp.FailWithCode(fiber.StatusUnauthorized, "登录已过期，请重新登录", "401011")
+			}
+			return resp.FailWithCode(fiber.StatusInternalServerError, "Database error", "DB_ERROR")
+		}
+
+		c.Locals("admin", claims)
+		return c.Next()
+	}
+}
+
+// RequireRole 要求管理员至少具备指定角色，需在 AdminAuthMiddleware 之后使用
+func RequireRole(role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims := GetAdmin(c)
+		if claims == nil || !auth.HasRole(claims.Role, role) {
+			return utils.NewResponse(c).FailWithCode(fiber.StatusForbidden, "没有权限执行该操作", "403010")
+		}
+		return c.Next()
+	}
+}
+
+// GetAdmin 获取当前登录的管理员，未登录时为 nil
+func GetAdmin(c *fiber.Ctx) *auth.Claims {
+	claims, _ := c.Locals("admin").(*auth.Claims)
+	return claims
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"api-pay/auth"
+	"api-pay/db"
+	"api-pay/db/dbtest"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAdminRoles(t *testing.T) {
+	dbtest.Open(t)
+
+	tokens := map[string]string{}
+	for _, role := range []string{auth.RoleViewer, auth.RoleOperator, auth.RoleAdmin} {
+		user := &db.AdminUser{Username: role, PasswordHash: "-", Role: role}
+		if err := db.CreateAdminUser(user); err != nil {
+			t.Fatal(err)
+		}
+		pair, err := auth.IssueTokens(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[role] = pair.AccessToken
+		tokens[role+"-refresh"] = pair.RefreshToken
+	}
+
+	app := fiber.New()
+	admin := app.Group("/manage", AdminAuthMiddleware())
+	ok := func(c *fiber.Ctx) error { return c.SendString(GetAdmin(c).Role) }
+	admin.Get("/goods", RequireRole(auth.RoleViewer), ok)
+	admin.Post("/goods", RequireRole(auth.RoleOperator), ok)
+	admin.Post("/admins", RequireRole(auth.RoleAdmin), ok)
+
+	tests := []struct {
+		method, path, token string
+		want                int
+	}{
+		{"GET", "/manage/goods", "", fiber.StatusUnauthorized},
+		{"GET", "/manage/goods", "garbage", fiber.StatusUnauthorized},
+		{"GET", "/manage/goods", tokens["viewer-refresh"], fiber.StatusUnauthorized},
+		{"GET", "/manage/goods", tokens["viewer"], fiber.StatusOK},
+		{"POST", "/manage/goods", tokens["viewer"], fiber.StatusForbidden},
+		{"POST", "/manage/goods", tokens["operator"], fiber.StatusOK},
+		{"POST", "/manage/admins", tokens["operator"], fiber.StatusForbidden},
+		{"POST", "/manage/admins", tokens["admin"], fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set(fiber.HeaderAuthorization, "Bearer "+tt.token)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.path, resp.StatusCode, tt.want)
+		}
+	}
+}
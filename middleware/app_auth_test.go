@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	conf "api-pay/config"
+	"api-pay/db"
+	"api-pay/db/dbtest"
+	"api-pay/sign"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// signedRequest 客户端签名请求的各部分，测试用例按需改动
+type signedRequest struct {
+	appKey, secret, timestamp, nonce, body string
+	uri                                    string // 参与签名的 URI，为空时与请求路径相同
+}
+
+func (r signedRequest) send(t *testing.T, app *fiber.App, path string) (int, string) {
+	t.Helper()
+	uri := r.uri
+	if uri == "" {
+		uri = path
+	}
+	req := httptest.NewRequest(fiber.MethodPost, path, strings.NewReader(r.body))
+	req.Header.Set(HeaderAppKey, r.appKey)
+	req.Header.Set(HeaderTimestamp, r.timestamp)
+	req.Header.Set(HeaderNonce, r.nonce)
+	if r.secret != "" {
+		req.Header.Set(HeaderSignature, sign.SignRequest(r.secret, fiber.MethodPost, uri, r.timestamp, r.nonce, []byte(r.body)))
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == fiber.StatusOK {
+		return resp.StatusCode, string(data)
+	}
+	var body struct {
+		ErrorCode string `json:"error_code"`
+	}
+	json.Unmarshal(data, &body)
+	return resp.StatusCode, body.ErrorCode
+}
+
+func appAuthApp(t *testing.T) *fiber.App {
+	t.Helper()
+	dbtest.Open(t)
+	dbtest.Redis(t)
+	cfg := &conf.Config{}
+	cfg.Auth.Enabled = true
+	cfg.Auth.IncludePaths = []string{"/api/*"}
+	cfg.Auth.Clients = []conf.AuthClient{{AppKey: "k1", Secret: "s1"}, {AppKey: "nosecret"}}
+	useConfig(t, cfg)
+
+	// 通过管理接口签发的客户端
+	for _, client := range []*db.ApiClient{{AppKey: "k2", Secret: "s2"}, {AppKey: "k3", Secret: "s3"}} {
+		if err := db.CreateApiClient(client); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.SetApiClientDisabled("k3", true); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Use(AppAuthMiddleware())
+	app.Post("/api/create-order", func(c *fiber.Ctx) error { return c.SendString(GetAppKey(c)) })
+	app.Post("/public", func(c *fiber.Ctx) error { return c.SendString("public") })
+	return app
+}
+
+func TestAppAuth(t *testing.T) {
+	app := appAuthApp(t)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name     string
+		path     string
+		req      signedRequest
+		want     int
+		wantBody string // 成功时为 app key，失败时为错误码
+	}{
+		{name: "config client", req: signedRequest{appKey: "k1", secret: "s1", timestamp: now, body: `{"a":1}`}, want: 200, wantBody: "k1"},
+		{name: "db client", req: signedRequest{appKey: "k2", secret: "s2", timestamp: now}, want: 200, wantBody: "k2"},
+		{name: "query in signature", path: "/api/create-order?x=1", req: signedRequest{appKey: "k1", secret: "s1", timestamp: now}, want: 200, wantBody: "k1"},
+		{name: "not included", path: "/public", req: signedRequest{}, want: 200, wantBody: "public"},
+		{name: "missing signature", req: signedRequest{appKey: "k1", timestamp: now}, want: 401, wantBody: "401001"},
+		{name: "unknown key", req: signedRequest{appKey: "k9", secret: "s1", timestamp: now}, want: 401, wantBody: "401002"},
+		{name: "disabled db client", req: signedRequest{appKey: "k3", secret: "s3", timestamp: now}, want: 401, wantBody: "401002"},
+		{name: "client without secret", req: signedRequest{appKey: "nosecret", secret: "x", timestamp: now}, want: 401, wantBody: "401002"},
+		{name: "stale timestamp", req: signedRequest{appKey: "k1", secret: "s1", timestamp: stale}, want: 401, wantBody: "401003"},
+		{name: "wrong secret", req: signedRequest{appKey: "k1", secret: "s2", timestamp: now}, want: 401, wantBody: "401005"},
+		{name: "other uri signed", req: signedRequest{appKey: "k1", secret: "s1", timestamp: now, uri: "/api/cancel-order"}, want: 401, wantBody: "401005"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.path
+			if path == "" {
+				path = "/api/create-order"
+			}
+			tt.req.nonce = "n" + strconv.Itoa(i)
+			status, body := tt.req.send(t, app, path)
+			if status != tt.want || body != tt.wantBody {
+				t.Errorf("got %d %q, want %d %q", status, body, tt.want, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAppAuthNonce(t *testing.T) {
+	app := appAuthApp(t)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	// 签名错误的请求不占用随机串
+	forged := signedRequest{appKey: "k1", secret: "bad", timestamp: now, nonce: "n1"}
+	if status, code := forged.send(t, app, "/api/create-order"); status != 401 || code != "401005" {
+		t.Fatalf("forged request = %d %s", status, code)
+	}
+
+	valid := signedRequest{appKey: "k1", secret: "s1", timestamp: now, nonce: "n1"}
+	if status, _ := valid.send(t, app, "/api/create-order"); status != 200 {
+		t.Fatalf("first request = %d", status)
+	}
+	if status, code := valid.send(t, app, "/api/create-order"); status != 401 || code != "401004" {
+		t.Fatalf("replay = %d %s, want 401 401004", status, code)
+	}
+
+	// 随机串按客户端区分
+	other := signedRequest{appKey: "k2", secret: "s2", timestamp: now, nonce: "n1"}
+	if status, _ := other.send(t, app, "/api/create-order"); status != 200 {
+		t.Fatalf("same nonce of other client = %d", status)
+	}
+}
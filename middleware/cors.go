@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"sync/atomic"
+
+	"api-pay/config"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+// corsHandler 按某一份跨域配置生成的处理函数
+type corsHandler struct {
+	settings string
+	handler  fiber.Handler
+}
+
+// CORSMiddleware 跨域中间件，配置热加载后按新配置重新生成
+func CORSMiddleware() fiber.Handler {
+	var cached atomic.Pointer[corsHandler]
+
+	return func(c *fiber.Ctx) error {
+		cfg := conf.Current().Cors
+		settings := cfg.AllowOrigins + "\n" + cfg.AllowMethods + "\n" + cfg.AllowHeaders
+
+		h := cached.Load()
+		if h == nil || h.settings != settings {
+			h = &corsHandler{settings: settings, handler: cors.New(cors.Config{
+				AllowOrigins:     cfg.AllowOrigins, // 允许的前端域名
+				AllowMethods:     cfg.AllowMethods, // 允许的方法
+				AllowHeaders:     cfg.AllowHeaders, // 允许的请求头
+				AllowCredentials: false,            // 是否允许发送 Cookie 或凭证
+			})}
+			cached.Store(h)
+		}
+		return h.handler(c)
+	}
+}
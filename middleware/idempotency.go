@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"api-pay/config"
+	"api-pay/db"
+	"api-pay/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// 幂等请求头
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	HeaderReplayed       = "Idempotent-Replayed"
+)
+
+const (
+	defaultIdempotencyTTL = 24 * time.Hour
+	maxIdempotencyKeyLen  = 64
+	idempotencySkipKey    = "idempotency_skip"
+)
+
+// IdempotencyMiddleware 对携带 Idempotency-Key 的 POST 请求保存首次响应，
+// 同一调用方使用相同的键重复请求时直接重放该响应（包括原 trace_id），
+// 相同的键对应不同请求体时拒绝。需放在签名认证之后，以便按 app key 区分调用方。
+// 业务拒绝（4xx）同样保存，服务端错误、429 和 SkipIdempotencyStore 标记的响应不保存。
+func IdempotencyMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		cfg := conf.Current().Idempotency
+		key := c.Get(HeaderIdempotencyKey)
+		if key == "" || c.Method() != fiber.MethodPost || !cfg.Enabled || !matchPath(c.Path(), cfg.IncludePaths) {
+			return c.Next()
+		}
+		resp := utils.NewResponse(c)
+		if len(key) > maxIdempotencyKeyLen {
+			return resp.FailWithCode(fiber.StatusBadRequest, "Idempotency-Key 过长", "400101")
+		}
+
+		ttl := time.Duration(cfg.TTL) * time.Hour
+		if ttl <= 0 {
+			ttl = defaultIdempotencyTTL
+		}
+		hash := sha256.Sum256(c.Body())
+		record := &db.IdempotencyRecord{
+			Key:         key,
+			Route:       c.Path(),
+			Caller:      idempotencyCaller(c),
+			RequestHash: hex.EncodeToString(hash[:]),
+			ExpiresAt:   time.Now().Add(ttl),
+		}
+
+		existing, err := db.ClaimIdempotencyKey(record)
+		if err != nil {
+			return resp.FailWithCode(fiber.StatusServiceUnavailable, "幂等服务暂不可用", "503002")
+		}
+		if existing != nil {
+			return replayIdempotent(c, existing, record.RequestHash)
+		}
+
+		if err := c.Next(); err != nil {
+			db.ReleaseIdempotencyKey(record.ID)
+			return err
+		}
+
+		// 服务端错误和需要稍后重试的响应不保存，客户端可使用同一幂等键重试
+		status := c.Response().StatusCode()
+		skip, _ := c.Locals(idempotencySkipKey).(bool)
+		if skip || status >= fiber.StatusInternalServerError || status == fiber.StatusTooManyRequests {
+			db.ReleaseIdempotencyKey(record.ID)
+			return nil
+		}
+		traceID, _ := c.Locals("trace_id").(string)
+		body := append([]byte(nil), c.Response().Body()...)
+		db.CompleteIdempotencyKey(record.ID, status, string(c.Response().Header.ContentType()), body, traceID)
+		return nil
+	}
+}
+
+// SkipIdempotencyStore 标记本次响应为暂时性失败（如等待锁超时），不保存为幂等响应，
+// 客户端可使用同一幂等键重试
+func SkipIdempotencyStore(c *fiber.Ctx) {
+	c.Locals(idempotencySkipKey, true)
+}
+
+// replayIdempotent 重放已保存的响应
+func replayIdempotent(c *fiber.Ctx, record *db.IdempotencyRecord, requestHash string) error {
+	resp := utils.NewResponse(c)
+	if record.RequestHash != requestHash {
+		return resp.FailWithCode(fiber.StatusUnprocessableEntity, "Idempotency-Key 已用于其他请求", "422101")
+	}
+	if !record.Completed {
+		return resp.FailWithCode(fiber.StatusConflict, "相同 Idempotency-Key 的请求正在处理", "409101")
+	}
+
+	if record.TraceID != "" {
+		c.Set("X-Trace-ID", record.TraceID)
+	}
+	c.Set(HeaderReplayed, "true")
+	if record.ContentType != "" {
+		c.Set(fiber.HeaderContentType, record.ContentType)
+	}
+	return c.Status(record.StatusCode).Send(record.ResponseBody)
+}
+
+// idempotencyCaller 调用方标识，优先使用签名认证的 app key
+func idempotencyCaller(c *fiber.Ctx) string {
+	if appKey := GetAppKey(c); appKey != "" {
+		return "app:" + appKey
+	}
+	return "ip:" + GetClientIP(c)
+}
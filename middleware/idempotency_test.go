@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	conf "api-pay/config"
+	"api-pay/db/dbtest"
+	"api-pay/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// useConfig 在测试期间替换当前配置快照
+func useConfig(t *testing.T, cfg *conf.Config) {
+	t.Helper()
+	saved := conf.Current()
+	conf.SetCurrent(cfg)
+	t.Cleanup(func() { conf.SetCurrent(saved) })
+}
+
+// idempotencyApp 每次调用 /api/:status 都返回不同内容，skip 时标记为暂时性失败
+func idempotencyApp(t *testing.T) (*fiber.App, *int) {
+	t.Helper()
+	dbtest.Open(t)
+	cfg := &conf.Config{}
+	cfg.Idempotency.Enabled = true
+	cfg.Idempotency.IncludePaths = []string{"/api/*"}
+	useConfig(t, cfg)
+
+	calls := 0
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("trace_id", fmt.Sprintf("trace-%d", calls))
+		return c.Next()
+	})
+	app.Use(IdempotencyMiddleware())
+	app.Post("/api/:status", func(c *fiber.Ctx) error {
+		calls++
+		status, _ := c.ParamsInt("status")
+		if c.Query("skip") != "" {
+			SkipIdempotencyStore(c)
+		}
+		if status >= 400 {
+			return utils.NewResponse(c).FailWithCode(status, fmt.Sprintf("call %d", calls), "REJECTED")
+		}
+		return utils.NewResponse(c).SuccessWithData(fiber.Map{"call": calls})
+	})
+	return app, &calls
+}
+
+func postIdempotent(t *testing.T, app *fiber.App, path, key, body string) (*http.Response, []byte) {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodPost, path, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(HeaderIdempotencyKey, key)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, data
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		wantStore bool
+	}{
+		{"success", "/api/200", true},
+		{"business rejection", "/api/400", true},
+		{"conflict", "/api/409", true},
+		{"lock timeout", "/api/409?skip=1", false},
+		{"too many requests", "/api/429", false},
+		{"server error", "/api/500", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, calls := idempotencyApp(t)
+			first, firstBody := postIdempotent(t, app, tt.path, "key-1", `{"a":1}`)
+			second, secondBody := postIdempotent(t, app, tt.path, "key-1", `{"a":1}`)
+
+			if !tt.wantStore {
+				if *calls != 2 {
+					t.Fatalf("handler called %d times, want 2", *calls)
+				}
+				if second.Header.Get(HeaderReplayed) != "" {
+					t.Fatal("unstored response was replayed")
+				}
+				return
+			}
+			if *calls != 1 {
+				t.Fatalf("handler called %d times, want 1", *calls)
+			}
+			if second.Header.Get(HeaderReplayed) != "true" {
+				t.Fatal("missing replayed header")
+			}
+			if second.StatusCode != first.StatusCode {
+				t.Errorf("replayed status = %d, want %d", second.StatusCode, first.StatusCode)
+			}
+			if second.Header.Get(fiber.HeaderContentType) != first.Header.Get(fiber.HeaderContentType) {
+				t.Errorf("replayed content type = %q, want %q", second.Header.Get(fiber.HeaderContentType), first.Header.Get(fiber.HeaderContentType))
+			}
+			if !bytes.Equal(secondBody, firstBody) {
+				t.Errorf("replayed body = %s, want %s", secondBody, firstBody)
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeyReuse(t *testing.T) {
+	app, calls := idempotencyApp(t)
+	postIdempotent(t, app, "/api/200", "key-1", `{"a":1}`)
+
+	tests := []struct {
+		name, path, key, body string
+		wantStatus            int
+	}{
+		{"different body", "/api/200", "key-1", `{"a":2}`, fiber.StatusUnprocessableEntity},
+		{"different route", "/api/201", "key-1", `{"a":1}`, fiber.StatusOK},
+		{"different key", "/api/200", "key-2", `{"a":1}`, fiber.StatusOK},
+		{"key too long", "/api/200", strings.Repeat("k", 65), `{"a":1}`, fiber.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		resp, _ := postIdempotent(t, app, tt.path, tt.key, tt.body)
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, resp.StatusCode, tt.wantStatus)
+		}
+	}
+	if *calls != 3 {
+		t.Errorf("handler called %d times, want 3", *calls)
+	}
+}
@@ -2,13 +2,18 @@ package middleware
 
 import (
 	"net"
+	"net/netip"
 	"strings"
+	"sync/atomic"
 
 	"api-pay/config"
+	"api-pay/init"
 	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
 )
 
-// IPWhitelistMiddleware IP白名单中间件
+// IPWhitelistMiddleware IP白名单中间件：先检查拒绝列表，再按路径规则检查允许列表。
+// 规则每次请求从当前配置快照读取，支持热加载。
 func IPWhitelistMiddleware(config conf.IPWhitelistConfig) fiber.Handler {
 	// 如果没有配置,使用默认配置
 	if config.ErrorHandler == nil {
@@ -16,93 +21,190 @@ func IPWhitelistMiddleware(config conf.IPWhitelistConfig) fiber.Handler {
 	}
 
 	return func(c *fiber.Ctx) error {
-		// 提取 IP 部分，去掉端口号
-		clientIP := GetClientIP(c)
+		policy := currentIPPolicy()
+		path := c.Path()
 
-		// 检查IP是否在白名单中
-		allowed := false
-		for _, ip := range config.AllowedIPs {
-			if ip == clientIP {
-				allowed = true
-				break
+		clientIP := GetClientIP(c)
+		addr, err := netip.ParseAddr(clientIP)
+		if err != nil {
+			if policy.restricts(path) || len(policy.deny) > 0 {
+				logIPDenied(c, clientIP, path, "invalid client ip")
+				return config.ErrorHandler(c)
 			}
+			return c.Next()
 		}
 
-		// 检查排除路径
-		pathExcluded := false
-		path := c.Path()
-		for _, excludePath := range config.ExcludePaths {
-			// 如果路径是通配符格式，检查前缀
-			if strings.HasSuffix(excludePath, "/*") {
-				basePath := strings.TrimSuffix(excludePath, "/*")
-				if strings.HasPrefix(path, basePath) {
-					pathExcluded = true
-					break
-				}
-			} else if path == excludePath {
-				// 精确匹配
-				pathExcluded = true
-				break
-			}
+		if policy.deny.contains(addr) {
+			logIPDenied(c, clientIP, path, "ip in deny list")
+			return config.ErrorHandler(c)
 		}
 
-		// 检查包含路径
-		for _, includePath := range config.IncludePaths {
-			if path == includePath {
-				pathExcluded = false
-				break
+		// 按顺序匹配第一条规则，未匹配的路径不限制来源
+		for _, rule := range policy.rules {
+			if !matchPath(path, []string{rule.path}) {
+				continue
 			}
-		}
-
-		if !allowed && pathExcluded {
-			return config.ErrorHandler(c)
+			if !rule.allow.contains(addr) {
+				logIPDenied(c, clientIP, path, "ip not allowed for "+rule.path)
+				return config.ErrorHandler(c)
+			}
+			break
 		}
 
 		return c.Next()
 	}
 }
 
-// GetClientIP 安全地获取客户端 IP 地址
+// logIPDenied 记录被拒绝的请求及原因
+func logIPDenied(c *fiber.Ctx, ip, path, reason string) {
+	traceID, _ := c.Locals("trace_id").(string)
+	initialization.GetCurrentLogger().Warn("ip whitelist: request denied",
+		zap.String("trace_id", traceID),
+		zap.String("ip", ip),
+		zap.String("remote_addr", c.Context().RemoteAddr().String()),
+		zap.String("method", c.Method()),
+		zap.String("path", path),
+		zap.String("reason", reason),
+	)
+}
+
+// GetClientIP 安全地获取客户端 IP 地址：仅当直连地址是受信任的代理时，
+// 才从 X-Forwarded-For（自右向左跳过受信任代理）或 X-Real-IP 中读取
 func GetClientIP(c *fiber.Ctx) string {
-	// 按优先级获取 IP
-	// 1. 优先使用 X-Real-IP
-	if realIP := c.Get("X-Real-IP"); realIP != "" {
-		if ip := parseIP(realIP); ip != "" {
-			return ip
-		}
+	remoteIP := parseIP(c.Context().RemoteAddr().String())
+	remote, err := netip.ParseAddr(remoteIP)
+	if err != nil {
+		return remoteIP
+	}
+
+	proxies := currentIPPolicy().proxies
+	if !proxies.contains(remote) {
+		return remoteIP
 	}
 
-	// 2. 尝试 X-Forwarded-For
-	if forwardedIP := c.Get("X-Forwarded-For"); forwardedIP != "" {
-		// 处理可能的多个 IP 情况
-		ips := strings.Split(forwardedIP, ",")
-		for _, ipStr := range ips {
-			if ip := parseIP(strings.TrimSpace(ipStr)); ip != "" {
+	// X-Forwarded-For 由各级代理依次追加，最右侧最可信；
+	// 遇到无效的地址时使用其右侧最近的受信任代理
+	if forwarded := c.Get(fiber.HeaderXForwardedFor); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		last := remoteIP
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := parseIP(hops[i])
+			addr, err := netip.ParseAddr(ip)
+			if err != nil {
+				return last
+			}
+			if !proxies.contains(addr) {
 				return ip
 			}
+			last = ip
 		}
+		return last
 	}
 
-	// 3. 最后使用 RemoteAddr
-	remoteAddr := c.Context().RemoteAddr().String()
-	if ip := parseIP(remoteAddr); ip != "" {
+	if ip := parseIP(c.Get("X-Real-IP")); ip != "" {
 		return ip
 	}
-
-	return ""
+	return remoteIP
 }
 
-// parseIP 安全地解析 IP 地址
+// parseIP 安全地解析 IP 地址，支持 IPv4、IPv6 及带端口的形式（1.2.3.4:80、[::1]:80），
+// 返回规范化的地址，IPv4 映射的 IPv6 地址按 IPv4 返回，无效时返回空串
 func parseIP(ipStr string) string {
-	// 如果包含端口，先分割
-	if strings.Contains(ipStr, ":") {
-		ipStr = strings.Split(ipStr, ":")[0]
+	ipStr = strings.TrimSpace(ipStr)
+	if host, _, err := net.SplitHostPort(ipStr); err == nil {
+		ipStr = host
+	}
+	ipStr = strings.TrimSuffix(strings.TrimPrefix(ipStr, "["), "]")
+
+	addr, err := netip.ParseAddr(ipStr)
+	if err != nil {
+		return ""
+	}
+	return addr.Unmap().WithZone("").String()
+}
+
+// ipSet IP 或网段集合
+type ipSet []netip.Prefix
+
+func newIPSet(items []string) ipSet {
+	set := make(ipSet, 0, len(items))
+	for _, item := range items {
+		// 配置加载时已校验，这里忽略无效项
+		if prefix, err := conf.ParsePrefix(item); err == nil {
+			set = append(set, prefix)
+		}
+	}
+	return set
+}
+
+func (s ipSet) contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range s {
+		if prefix.Contains(addr) {
+			return true
+		}
 	}
+	return false
+}
 
-	// 验证 IP 地址的有效性
-	if ip := net.ParseIP(ipStr); ip != nil {
-		return ipStr
+type ipRule struct {
+	path  string
+	allow ipSet
+}
+
+// ipPolicy 由某一份配置解析出的来源限制
+type ipPolicy struct {
+	source  *conf.Config
+	proxies ipSet
+	deny    ipSet
+	rules   []ipRule
+}
+
+// restricts 路径是否受规则限制
+func (p *ipPolicy) restricts(path string) bool {
+	for _, rule := range p.rules {
+		if matchPath(path, []string{rule.path}) {
+			return true
+		}
+	}
+	return false
+}
+
+var cachedIPPolicy atomic.Pointer[ipPolicy]
+
+// currentIPPolicy 返回当前配置对应的来源限制，配置热加载后重新解析
+func currentIPPolicy() *ipPolicy {
+	cfg := conf.Current()
+	if p := cachedIPPolicy.Load(); p != nil && p.source == cfg {
+		return p
+	}
+
+	whitelist := cfg.IPWhitelist
+	allowed := newIPSet(whitelist.AllowedIPs)
+	p := &ipPolicy{
+		source:  cfg,
+		proxies: newIPSet(whitelist.TrustedProxies),
+		deny:    newIPSet(whitelist.DenyIPs),
+	}
+	for _, rule := range whitelist.Rules {
+		allow := allowed
+		if len(rule.Allow) > 0 {
+			allow = newIPSet(rule.Allow)
+		}
+		p.rules = append(p.rules, ipRule{path: rule.Path, allow: allow})
+	}
+
+	// 兼容旧配置：include_paths 不限制来源，exclude_paths 仅 allowed_ips 可访问
+	if len(whitelist.Rules) == 0 {
+		anywhere := newIPSet([]string{"0.0.0.0/0", "::/0"})
+		for _, path := range whitelist.IncludePaths {
+			p.rules = append(p.rules, ipRule{path: path, allow: anywhere})
+		}
+		for _, path := range whitelist.ExcludePaths {
+			p.rules = append(p.rules, ipRule{path: path, allow: allowed})
+		}
 	}
 
-	return ""
+	cachedIPPolicy.Store(p)
+	return p
 }
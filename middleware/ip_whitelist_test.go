@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	conf "api-pay/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// serveFrom 以 remoteAddr 作为直连地址执行一次请求，返回状态码和响应体
+func serveFrom(t *testing.T, app *fiber.App, remoteAddr, path string, headers map[string]string) (int, string) {
+	t.Helper()
+	var req fasthttp.Request
+	req.SetRequestURI(path)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	addr, err := net.ResolveTCPAddr("tcp", remoteAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ctx fasthttp.RequestCtx
+	ctx.Init(&req, addr, nil)
+	app.Handler()(&ctx)
+	return ctx.Response.StatusCode(), string(ctx.Response.Body())
+}
+
+func TestGetClientIP(t *testing.T) {
+	cfg := &conf.Config{}
+	cfg.IPWhitelist.TrustedProxies = []string{"10.0.0.0/8", "fd00::/8"}
+	useConfig(t, cfg)
+
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString(GetClientIP(c)) })
+
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{name: "direct", remote: "1.2.3.4:5000", want: "1.2.3.4"},
+		{name: "untrusted forwarded", remote: "1.2.3.4:5000", headers: map[string]string{"X-Forwarded-For": "9.9.9.9", "X-Real-IP": "8.8.8.8"}, want: "1.2.3.4"},
+		{name: "trusted proxy", remote: "10.0.0.1:5000", headers: map[string]string{"X-Forwarded-For": "9.9.9.9"}, want: "9.9.9.9"},
+		{name: "spoofed left hop", remote: "10.0.0.1:5000", headers: map[string]string{"X-Forwarded-For": "6.6.6.6, 9.9.9.9, 10.0.0.2"}, want: "9.9.9.9"},
+		{name: "all hops trusted", remote: "10.0.0.1:5000", headers: map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, want: "10.0.0.3"},
+		{name: "invalid hop", remote: "10.0.0.1:5000", headers: map[string]string{"X-Forwarded-For": "9.9.9.9, garbage, 10.0.0.2"}, want: "10.0.0.2"},
+		{name: "forwarded with port", remote: "10.0.0.1:5000", headers: map[string]string{"X-Forwarded-For": "[2001:db8::1]:443"}, want: "2001:db8::1"},
+		{name: "real ip", remote: "10.0.0.1:5000", headers: map[string]string{"X-Real-IP": "8.8.8.8"}, want: "8.8.8.8"},
+		{name: "ipv6 proxy", remote: "[fd00::1]:5000", headers: map[string]string{"X-Forwarded-For": "9.9.9.9"}, want: "9.9.9.9"},
+		{name: "ipv4 mapped remote", remote: "[::ffff:1.2.3.4]:5000", want: "1.2.3.4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, got := serveFrom(t, app, tt.remote, "/", tt.headers); got != tt.want {
+				t.Errorf("GetClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPWhitelist(t *testing.T) {
+	// 拒绝时写日志，日志目录建在临时目录
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	cfg := &conf.Config{}
+	cfg.IPWhitelist.AllowedIPs = []string{"192.168.0.0/16", "2001:db8::/32"}
+	cfg.IPWhitelist.TrustedProxies = []string{"10.0.0.1"}
+	cfg.IPWhitelist.DenyIPs = []string{"192.168.9.0/24"}
+	cfg.IPWhitelist.Rules = []conf.IPRule{
+		{Path: "/notify/*", Allow: []string{"203.0.113.0/24"}},
+		{Path: "/manage/*"},
+	}
+	useConfig(t, cfg)
+
+	app := fiber.New()
+	app.Use(IPWhitelistMiddleware(conf.NewIPWhitelistConfig()))
+	app.Get("/*", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	tests := []struct {
+		name      string
+		remote    string
+		path      string
+		forwarded string
+		want      int
+	}{
+		{name: "allowed ip", remote: "192.168.1.1:1", path: "/manage/orders", want: 200},
+		{name: "allowed ipv6", remote: "[2001:db8::5]:1", path: "/manage/orders", want: 200},
+		{name: "not allowed", remote: "8.8.8.8:1", path: "/manage/orders", want: 403},
+		{name: "deny overrides allow", remote: "192.168.9.1:1", path: "/manage/orders", want: 403},
+		{name: "deny applies to every path", remote: "192.168.9.1:1", path: "/api/create-order", want: 403},
+		{name: "unrestricted path", remote: "8.8.8.8:1", path: "/api/create-order", want: 200},
+		{name: "rule allow list", remote: "203.0.113.7:1", path: "/notify/feizhu", want: 200},
+		{name: "rule replaces default list", remote: "192.168.1.1:1", path: "/notify/feizhu", want: 403},
+		{name: "through trusted proxy", remote: "10.0.0.1:1", path: "/manage/orders", forwarded: "192.168.1.1", want: 200},
+		{name: "forwarded from untrusted", remote: "8.8.8.8:1", path: "/manage/orders", forwarded: "192.168.1.1", want: 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var headers map[string]string
+			if tt.forwarded != "" {
+				headers = map[string]string{"X-Forwarded-For": tt.forwarded}
+			}
+			if status, _ := serveFrom(t, app, tt.remote, tt.path, headers); status != tt.want {
+				t.Errorf("status = %d, want %d", status, tt.want)
+			}
+		})
+	}
+}
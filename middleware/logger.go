@@ -1,11 +1,15 @@
 package middleware
 
 import (
-	"encoding/json"
+	"errors"
+	"slices"
 	"strings"
 	"time"
 
+	"api-pay/config"
 	"api-pay/init"
+	"api-pay/metrics"
+	"api-pay/tracing"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
@@ -26,80 +30,47 @@ type RequestLog struct {
 	Response  string            `json:"response"`
 }
 
-// RequestLoggerConfig 中间件配置
+// RequestLoggerConfig 中间件配置，跳过和强制记录的路径每次请求从当前配置快照读取
 type RequestLoggerConfig struct {
-	Logger       *zap.Logger
-	SkipPaths    []string
-	ExcludePaths []string
-}
-
-// cleanJSON 清理和压缩JSON字符串，去除换行符、多余空格和不必要的转义
-func cleanJSON(input string) string {
-	input = strings.TrimSpace(input)
-	if !strings.HasPrefix(input, "{") && !strings.HasPrefix(input, "[") {
-		return input
-	}
-
-	// 尝试解析JSON到通用接口
-	var temp interface{}
-	if err := json.Unmarshal([]byte(input), &temp); err != nil {
-		return input
-	}
-
-	// 重新编码为紧凑的JSON
-	clean, err := json.Marshal(temp)
-	if err != nil {
-		return input
-	}
-
-	return string(clean)
+	Logger *zap.Logger
 }
 
 // RequestLogger 创建请求日志中间件
 func RequestLogger(config RequestLoggerConfig) fiber.Handler {
-	// 预处理路径映射
-	skipPaths := make(map[string]bool)
-	for _, path := range config.SkipPaths {
-		if strings.HasSuffix(path, "/*") {
-			skipPaths[strings.TrimSuffix(path, "/*")] = true
-		} else {
-			skipPaths[path] = true
-		}
-	}
-
-	// 预处理强制记录日志的路径
-	excludePaths := make(map[string]bool)
-	for _, path := range config.ExcludePaths {
-		excludePaths[path] = true
-	}
-
 	return func(c *fiber.Ctx) error {
 		path := c.Path()
 
-		// 判断是否需要跳过日志记录
-		if shouldSkipLogging(path, skipPaths) && !excludePaths[path] {
-			return c.Next()
+		// 判断是否需要跳过日志记录，跳过日志的请求仍记录指标
+		logging := conf.Current().Logging
+		if shouldSkipLogging(path, logging.SkipPaths) && !slices.Contains(logging.ExcludePaths, path) {
+			startTime := time.Now()
+			err := c.Next()
+			observeRequest(c, startTime, err)
+			return err
 		}
 
 		// 获取当前的 logger
 		logger := initialization.GetCurrentLogger()
 
-		// 生成 trace_id
-		traceID := uuid.New().String()
+		// 建立请求链路，trace_id 与 span 的 trace id 保持一致
+		ctx, span := startRequestSpan(c)
+		traceID := tracing.TraceID(ctx)
+		if traceID == "" {
+			// 未初始化链路追踪（如命令行工具）时生成随机 trace_id
+			traceID = strings.ReplaceAll(uuid.New().String(), "-", "")
+		}
 		c.Locals("trace_id", traceID)
-		c.Set("X-Trace-ID", traceID)
+		c.Set(HeaderTraceID, traceID)
 
 		// 记录请求开始时间
 		startTime := time.Now()
 
-		// 获取请求头
-		headers := extractHeaders(c)
-
-		// 清理请求体的 JSON
-		requestBody := cleanJSON(string(c.Body()))
+		// 按当前配置脱敏请求头、查询参数和请求体
+		rules := currentRedactor()
+		policy := rules.bodyPolicy(path)
 
 		// 构建请求日志对象
-		reqLog := buildRequestLog(traceID, c, headers, requestBody, startTime)
+		reqLog := buildRequestLog(traceID, c, rules, policy, startTime)
 
 		// 记录请求日志
 		logRequest(logger, reqLog)
@@ -108,44 +79,56 @@ func RequestLogger(config RequestLoggerConfig) fiber.Handler {
 		err := c.Next()
 
 		// 更新并记录响应日志
-		updateAndLogResponse(logger, c, &reqLog, startTime)
+		updateAndLogResponse(logger, c, rules, policy, &reqLog, startTime)
+		observeRequest(c, startTime, err)
+		endRequestSpan(c, span, responseStatus(c, err), err)
 
 		return err
 	}
 }
 
-// 判断是否跳过日志记录的辅助函数
-func shouldSkipLogging(path string, skipPaths map[string]bool) bool {
-	for basePath := range skipPaths {
-		if strings.HasPrefix(path, basePath) {
+// observeRequest 记录 HTTP 请求指标，按路由模板统计，避免路径参数导致标签过多
+func observeRequest(c *fiber.Ctx, startTime time.Time, err error) {
+	metrics.ObserveHTTP(c.Method(), c.Route().Path, responseStatus(c, err), time.Since(startTime))
+}
+
+// responseStatus 响应状态码，处理函数返回的错误稍后才由错误处理器写入响应
+func responseStatus(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return fe.Code
+	}
+	return fiber.StatusInternalServerError
+}
+
+// 判断是否跳过日志记录的辅助函数，按前缀匹配，/* 结尾与不带 /* 等价
+func shouldSkipLogging(path string, skipPaths []string) bool {
+	for _, basePath := range skipPaths {
+		if strings.HasPrefix(path, strings.TrimSuffix(basePath, "/*")) {
 			return true
 		}
 	}
 	return false
 }
 
-// 提取请求头的辅助函数
-func extractHeaders(c *fiber.Ctx) map[string]string {
-	headers := make(map[string]string)
-	c.Request().Header.VisitAll(func(key, value []byte) {
-		headers[string(key)] = string(value)
-	})
-	return headers
-}
-
 // 构建请求日志对象的辅助函数
-func buildRequestLog(traceID string, c *fiber.Ctx, headers map[string]string,
-	requestBody string, startTime time.Time) RequestLog {
-	return RequestLog{
+func buildRequestLog(traceID string, c *fiber.Ctx, rules *redactor, policy logBody, startTime time.Time) RequestLog {
+	reqLog := RequestLog{
 		TraceID:   traceID,
 		Method:    c.Method(),
 		Path:      c.Path(),
-		Query:     string(c.Request().URI().QueryString()),
-		Headers:   headers,
-		Body:      requestBody,
+		Query:     rules.redactQuery(string(c.Request().URI().QueryString())),
+		Headers:   rules.redactHeaders(c.Request().Header.VisitAll),
 		IP:        c.Get("X-Forwarded-For"),
 		StartTime: startTime,
 	}
+	if policy.request {
+		reqLog.Body = rules.redactBody(c.Body(), string(c.Request().Header.ContentType()), policy.maxSize)
+	}
+	return reqLog
 }
 
 // 记录请求日志的辅助函数
@@ -162,11 +145,13 @@ func logRequest(logger *zap.Logger, reqLog RequestLog) {
 }
 
 // 更新并记录响应日志的辅助函数
-func updateAndLogResponse(logger *zap.Logger, c *fiber.Ctx,
+func updateAndLogResponse(logger *zap.Logger, c *fiber.Ctx, rules *redactor, policy logBody,
 	reqLog *RequestLog, startTime time.Time) {
-	responseBody := c.Response().Body()
-	if responseBody != nil {
-		reqLog.Response = cleanJSON(string(responseBody))
+	if policy.response {
+		responseBody := c.Response().Body()
+		if responseBody != nil {
+			reqLog.Response = rules.redactBody(responseBody, string(c.Response().Header.ContentType()), policy.maxSize)
+		}
 	}
 
 	reqLog.Status = c.Response().StatusCode()
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-pay/config"
+	"api-pay/db"
+	"api-pay/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+const defaultRateLimitWindow = 60 * time.Second
+
+// RateLimitMiddleware 按配置的规则进行滑动窗口限流，超限时返回 429 并设置 Retry-After。
+// 命中的规则全部未超限时才计入本次请求。需放在签名认证之后，以便按 app key 限流。
+func RateLimitMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		cfg := conf.Current().RateLimit
+		if !cfg.Enabled {
+			return c.Next()
+		}
+
+		var limits []db.RateLimit
+		for _, i := range matchRateLimitRules(cfg.Rules, c.Method(), c.Path()) {
+			rule := cfg.Rules[i]
+			window := time.Duration(rule.Window) * time.Second
+			if window <= 0 {
+				window = defaultRateLimitWindow
+			}
+			limits = append(limits, db.RateLimit{
+				Key:    fmt.Sprintf("%d:%s:%s", i, rule.Path, rateLimitKey(c, rule.Key)),
+				Limit:  rule.Limit,
+				Window: window,
+			})
+		}
+
+		allowed, wait := db.AllowRequest(limits)
+		if !allowed {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			return utils.NewResponse(c).FailWithCode(fiber.StatusTooManyRequests, "请求过于频繁，请稍后再试", "429001")
+		}
+		return c.Next()
+	}
+}
+
+// matchRateLimitRules 返回请求命中的规则下标。同一限流维度命中多条规则时只取最具体的一条，
+// 不同维度的规则都生效
+func matchRateLimitRules(rules []conf.RateLimitRule, method, path string) []int {
+	best := map[string]int{}
+	var kinds []string
+	for i, rule := range rules {
+		if rule.Limit <= 0 || !matchPath(path, []string{rule.Path}) {
+			continue
+		}
+		if rule.Method != "" && !strings.EqualFold(rule.Method, method) {
+			continue
+		}
+
+		kind := rule.Key
+		if kind == "" {
+			kind = "ip"
+		}
+		j, ok := best[kind]
+		if !ok {
+			kinds = append(kinds, kind)
+		}
+		if !ok || moreSpecific(rule, rules[j]) {
+			best[kind] = i
+		}
+	}
+
+	matched := make([]int, 0, len(kinds))
+	for _, kind := range kinds {
+		matched = append(matched, best[kind])
+	}
+	return matched
+}
+
+// moreSpecific 规则 a 是否比 b 更具体：精确路径优先，其次路径中非通配字符更多的，
+// 再其次限定了请求方法的；完全相同时按配置顺序取靠前的一条
+func moreSpecific(a, b conf.RateLimitRule) bool {
+	aExact, bExact := !strings.Contains(a.Path, "*"), !strings.Contains(b.Path, "*")
+	if aExact != bExact {
+		return aExact
+	}
+	aLiteral, bLiteral := len(a.Path)-strings.Count(a.Path, "*"), len(b.Path)-strings.Count(b.Path, "*")
+	if aLiteral != bLiteral {
+		return aLiteral > bLiteral
+	}
+	return a.Method != "" && b.Method == ""
+}
+
+// rateLimitKey 按规则维度取限流标识，取不到 user_id 或 app key 时按客户端 IP
+func rateLimitKey(c *fiber.Ctx, kind string) string {
+	switch kind {
+	case "user_id":
+		if userId := requestUserId(c); userId != "" {
+			return "user:" + userId
+		}
+	case "app_key":
+		if appKey := GetAppKey(c); appKey != "" {
+			return "app:" + appKey
+		}
+	}
+	return "ip:" + GetClientIP(c)
+}
+
+// requestUserId 从查询参数或 JSON 请求体中读取 user_id
+func requestUserId(c *fiber.Ctx) string {
+	if userId := c.Query("user_id"); userId != "" {
+		return userId
+	}
+	var body struct {
+		UserId json.RawMessage `json:"user_id"`
+	}
+	if err := json.Unmarshal(c.Body(), &body); err != nil || len(body.UserId) == 0 {
+		return ""
+	}
+	var userId string
+	if err := json.Unmarshal(body.UserId, &userId); err == nil {
+		return userId
+	}
+	// 兼容数字类型的 user_id
+	if raw := string(body.UserId); raw != "null" {
+		return raw
+	}
+	return ""
+}
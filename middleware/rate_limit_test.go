@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	conf "api-pay/config"
+	"api-pay/db/dbtest"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMatchRateLimitRules(t *testing.T) {
+	rules := []conf.RateLimitRule{
+		0: {Path: "/api/*", Key: "ip", Limit: 300},
+		1: {Path: "/api/*/callback", Method: "POST", Key: "ip", Limit: 600},
+		2: {Path: "/api/create-order", Key: "user_id", Limit: 10},
+		3: {Path: "/api/*/callback", Limit: 500},
+		4: {Path: "/api/refund", Limit: 20},
+		5: {Path: "/api/manage/*", Key: "app_key", Limit: 0},
+	}
+	tests := []struct {
+		method, path string
+		want         []int
+	}{
+		{"GET", "/api/goods", []int{0}},
+		{"POST", "/api/feizhu/callback", []int{1}},
+		{"GET", "/api/feizhu/callback", []int{3}},
+		{"POST", "/api/create-order", []int{0, 2}},
+		{"POST", "/api/refund", []int{4}},
+		{"GET", "/api/manage/goods", []int{0}},
+		{"GET", "/health", []int{}},
+	}
+	for _, tt := range tests {
+		got := matchRateLimitRules(rules, tt.method, tt.path)
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s %s: matched %v, want %v", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	dbtest.Redis(t)
+	cfg := &conf.Config{}
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.Rules = []conf.RateLimitRule{
+		{Path: "/api/*", Key: "ip", Limit: 2, Window: 60},
+		{Path: "/api/*/callback", Method: "POST", Key: "ip", Limit: 4, Window: 60},
+		{Path: "/api/create-order", Key: "user_id", Limit: 1, Window: 60},
+	}
+	useConfig(t, cfg)
+
+	app := fiber.New()
+	app.Use(RateLimitMiddleware())
+	app.All("/api/*", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	send := func(method, path string) int {
+		resp, err := app.Test(httptest.NewRequest(method, path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	// 回调使用更具体的规则，不受 /api/* 的额度限制
+	for i := 0; i < 4; i++ {
+		if status := send("POST", "/api/feizhu/callback"); status != fiber.StatusOK {
+			t.Fatalf("callback %d: status %d", i+1, status)
+		}
+	}
+	if status := send("POST", "/api/feizhu/callback"); status != fiber.StatusTooManyRequests {
+		t.Fatalf("callback over limit: status %d", status)
+	}
+
+	// 建单同时受 ip 和 user_id 两个维度限制，被 user_id 拒绝的请求不占用 ip 额度
+	if status := send("POST", "/api/create-order?user_id=u1"); status != fiber.StatusOK {
+		t.Fatalf("create-order: status %d", status)
+	}
+	if status := send("POST", "/api/create-order?user_id=u1"); status != fiber.StatusTooManyRequests {
+		t.Fatalf("create-order over user limit: status %d", status)
+	}
+	if status := send("GET", "/api/goods"); status != fiber.StatusOK {
+		t.Fatalf("goods: status %d", status)
+	}
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/goods", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusTooManyRequests || resp.Header.Get(fiber.HeaderRetryAfter) == "" {
+		t.Fatalf("goods over ip limit: status %d, Retry-After %q", resp.StatusCode, resp.Header.Get(fiber.HeaderRetryAfter))
+	}
+}
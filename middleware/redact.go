@@ -0,0 +1,275 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"api-pay/config"
+)
+
+const (
+	redactedValue      = "***"
+	defaultMaxBodySize = 4096
+)
+
+// 始终生效的默认脱敏列表
+var (
+	defaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Signature"}
+	defaultMaskFields    = []string{"sign", "signature", "password", "secret", "token", "access_token", "refresh_token"}
+)
+
+// logBody 请求体、响应体的记录方式
+type logBody struct {
+	request  bool
+	response bool
+	maxSize  int // 小于 0 表示不截断
+}
+
+type logBodyRule struct {
+	path string
+	body logBody
+}
+
+// fieldSet 字段匹配：names 匹配任意层级的同名字段，paths 从根开始按 . 分隔匹配，数组元素不占层级
+type fieldSet struct {
+	names map[string]bool
+	paths map[string]bool
+}
+
+func newFieldSet(fields []string) fieldSet {
+	set := fieldSet{names: map[string]bool{}, paths: map[string]bool{}}
+	for _, field := range fields {
+		if strings.Contains(field, ".") {
+			set.paths[field] = true
+		} else {
+			set.names[field] = true
+		}
+	}
+	return set
+}
+
+func (s fieldSet) match(path, name string) bool {
+	return s.names[name] || s.paths[path]
+}
+
+// redactor 由当前配置快照解析出的脱敏规则
+type redactor struct {
+	source  *conf.Config
+	headers map[string]bool
+	mask    fieldSet
+	hash    fieldSet
+	body    logBody
+	rules   []logBodyRule
+}
+
+var cachedRedactor atomic.Pointer[redactor]
+
+// currentRedactor 返回当前配置对应的脱敏规则，配置热加载后重新解析
+func currentRedactor() *redactor {
+	cfg := conf.Current()
+	if r := cachedRedactor.Load(); r != nil && r.source == cfg {
+		return r
+	}
+	r := newRedactor(cfg)
+	cachedRedactor.Store(r)
+	return r
+}
+
+// newRedactor 解析配置中的脱敏规则
+func newRedactor(cfg *conf.Config) *redactor {
+	// 配置的列表在默认列表之上追加，不会替换默认列表
+	logging := cfg.Logging
+	headers := append(slices.Clone(defaultRedactHeaders), logging.RedactHeaders...)
+	maskFields := append(slices.Clone(defaultMaskFields), logging.MaskFields...)
+
+	r := &redactor{
+		source:  cfg,
+		headers: map[string]bool{},
+		mask:    newFieldSet(maskFields),
+		hash:    newFieldSet(logging.HashFields),
+		body:    logBody{request: true, response: true, maxSize: bodySize(logging.MaxBodySize, defaultMaxBodySize)},
+	}
+	for _, header := range headers {
+		r.headers[strings.ToLower(header)] = true
+	}
+	for _, rule := range logging.BodyRules {
+		body := logBody{request: true, response: true, maxSize: bodySize(rule.MaxBodySize, r.body.maxSize)}
+		switch rule.Body {
+		case "request":
+			body.response = false
+		case "response":
+			body.request = false
+		case "none":
+			body.request, body.response = false, false
+		}
+		r.rules = append(r.rules, logBodyRule{path: rule.Path, body: body})
+	}
+	return r
+}
+
+// bodySize 0 表示沿用 fallback，-1 表示不截断
+func bodySize(size, fallback int) int {
+	if size == 0 {
+		return fallback
+	}
+	return size
+}
+
+// bodyPolicy 按顺序匹配第一条路径规则，未匹配时使用全局设置
+func (r *redactor) bodyPolicy(path string) logBody {
+	for _, rule := range r.rules {
+		if matchPath(path, []string{rule.path}) {
+			return rule.body
+		}
+	}
+	return r.body
+}
+
+// redactHeaders 复制请求头，隐藏列表中的请求头的值
+func (r *redactor) redactHeaders(visit func(func(key, value []byte))) map[string]string {
+	headers := make(map[string]string)
+	visit(func(key, value []byte) {
+		name := string(key)
+		if r.headers[strings.ToLower(name)] {
+			headers[name] = redactedValue
+			return
+		}
+		headers[name] = string(value)
+	})
+	return headers
+}
+
+// redactBody 脱敏并压缩请求体或响应体，超过 maxSize 时截断。
+// 无法按 JSON 或表单解析的内容无法脱敏，只记录长度
+func (r *redactor) redactBody(body []byte, contentType string, maxSize int) string {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return ""
+	}
+
+	var out string
+	switch {
+	case strings.HasPrefix(contentType, "multipart/"):
+		out = fmt.Sprintf("[multipart body, %d bytes]", len(body))
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		out = r.redactQuery(string(body))
+	default:
+		redacted, ok := r.redactJSON(body)
+		if !ok {
+			redacted = fmt.Sprintf("[unparseable body, %d bytes]", len(body))
+		}
+		out = redacted
+	}
+	return truncateBody(out, maxSize)
+}
+
+// redactJSON 清理和压缩JSON并脱敏字段，不是完整的 JSON（含末尾多余内容）时返回 false
+func (r *redactor) redactJSON(body []byte) (string, bool) {
+	// 使用 json.Number 保留大整数精度
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var temp interface{}
+	if err := decoder.Decode(&temp); err != nil {
+		return "", false
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return "", false
+	}
+
+	// 重新编码为紧凑的JSON，不转义 HTML 字符
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(r.redactValue("", temp)); err != nil {
+		return "", false
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), true
+}
+
+func (r *redactor) redactValue(path string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+			switch {
+			case r.mask.match(fieldPath, key):
+				v[key] = redactedValue
+			case r.hash.match(fieldPath, key):
+				v[key] = hashValue(item)
+			default:
+				v[key] = r.redactValue(fieldPath, item)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = r.redactValue(path, item)
+		}
+	}
+	return value
+}
+
+// redactQuery 脱敏 URL 查询串或表单，保持参数原有顺序和编码
+func (r *redactor) redactQuery(query string) string {
+	if query == "" {
+		return query
+	}
+	pairs := strings.Split(query, "&")
+	for i, pair := range pairs {
+		rawKey, rawValue, _ := strings.Cut(pair, "=")
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			key = rawKey
+		}
+		switch {
+		case r.mask.match(key, key):
+			pairs[i] = rawKey + "=" + redactedValue
+		case r.hash.match(key, key):
+			value, err := url.QueryUnescape(rawValue)
+			if err != nil {
+				value = rawValue
+			}
+			pairs[i] = rawKey + "=" + hashValue(value)
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// hashValue SHA-256 摘要的前 16 位，相同的值得到相同的结果
+func hashValue(value interface{}) string {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		data = []byte(v)
+	case json.Number:
+		data = []byte(v.String())
+	default:
+		data, _ = json.Marshal(v)
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// truncateBody 按字节截断，不截断多字节字符
+func truncateBody(body string, maxSize int) string {
+	if maxSize < 0 || len(body) <= maxSize {
+		return body
+	}
+	cut := maxSize
+	for cut > 0 && !utf8.RuneStart(body[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s...(truncated, %d bytes)", body[:cut], len(body))
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"testing"
+
+	"api-pay/config"
+)
+
+func testRedactor() *redactor {
+	cfg := &conf.Config{}
+	cfg.Logging.MaskFields = []string{"data.card"}
+	cfg.Logging.HashFields = []string{"user_id"}
+	cfg.Logging.RedactHeaders = []string{"X-App-Key"}
+	cfg.Logging.BodyRules = []conf.LogBodyRule{
+		{Path: "/api/auth/*", Body: "none"},
+		{Path: "/api/orders", Body: "request", MaxBodySize: -1},
+	}
+	return newRedactor(cfg)
+}
+
+func TestRedactBody(t *testing.T) {
+	r := testRedactor()
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		want        string
+	}{
+		{"empty", "  ", "application/json", ""},
+		{"default mask kept", `{"sign":"abc","password":"p"}`, "application/json", `{"password":"***","sign":"***"}`},
+		{"nested name", `{"list":[{"token":"t","n":1}]}`, "application/json", `{"list":[{"n":1,"token":"***"}]}`},
+		{"path only from root", `{"data":{"card":"1"},"card":"2"}`, "application/json", `{"card":"2","data":{"card":"***"}}`},
+		{"hash number and string alike", `{"user_id":42}`, "application/json", `{"user_id":"` + hashValue("42") + `"}`},
+		{"big number kept", `{"id":123456789012345678}`, "application/json", `{"id":123456789012345678}`},
+		{"html not escaped", `{"a":"<b>"}`, "application/json", `{"a":"<b>"}`},
+		{"malformed", `{"sign":"abc"`, "application/json", "[unparseable body, 13 bytes]"},
+		{"trailing garbage", `{"a":1} sign=abc`, "application/json", "[unparseable body, 16 bytes]"},
+		{"plain text", "sign=abc", "text/plain", "[unparseable body, 8 bytes]"},
+		{"form", "a=1&sign=x%20y&user_id=u", "application/x-www-form-urlencoded", "a=1&sign=***&user_id=" + hashValue("u")},
+		{"multipart", "--x--", "multipart/form-data; boundary=x", "[multipart body, 5 bytes]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.redactBody([]byte(tt.body), tt.contentType, -1); got != tt.want {
+				t.Errorf("redactBody(%q) = %q, want %q", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactHeaders(t *testing.T) {
+	r := testRedactor()
+	headers := r.redactHeaders(func(f func(key, value []byte)) {
+		f([]byte("authorization"), []byte("Bearer x"))
+		f([]byte("X-App-Key"), []byte("k"))
+		f([]byte("Content-Type"), []byte("application/json"))
+	})
+	if headers["authorization"] != redactedValue || headers["X-App-Key"] != redactedValue {
+		t.Errorf("sensitive headers not redacted: %v", headers)
+	}
+	if headers["Content-Type"] != "application/json" {
+		t.Errorf("Content-Type = %q", headers["Content-Type"])
+	}
+}
+
+func TestTruncateBody(t *testing.T) {
+	tests := []struct {
+		body    string
+		maxSize int
+		want    string
+	}{
+		{"abcdef", -1, "abcdef"},
+		{"abcdef", 6, "abcdef"},
+		{"abcdef", 3, "abc...(truncated, 6 bytes)"},
+		{"中文", 4, "中...(truncated, 6 bytes)"},
+	}
+	for _, tt := range tests {
+		if got := truncateBody(tt.body, tt.maxSize); got != tt.want {
+			t.Errorf("truncateBody(%q, %d) = %q, want %q", tt.body, tt.maxSize, got, tt.want)
+		}
+	}
+}
+
+func TestBodyPolicy(t *testing.T) {
+	r := testRedactor()
+	tests := []struct {
+		path string
+		want logBody
+	}{
+		{"/api/auth/login", logBody{false, false, defaultMaxBodySize}},
+		{"/api/orders", logBody{true, false, -1}},
+		{"/api/create-order", logBody{true, true, defaultMaxBodySize}},
+	}
+	for _, tt := range tests {
+		if got := r.bodyPolicy(tt.path); got != tt.want {
+			t.Errorf("bodyPolicy(%q) = %+v, want %+v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"strings"
+
+	"api-pay/tracing"
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// HeaderTraceID 请求追踪ID，值为 32 位十六进制的 trace id，也接受带横线的 UUID
+const HeaderTraceID = "X-Trace-ID"
+
+// startRequestSpan 为请求创建服务端 span 并放入 UserContext。
+// 上游优先通过 traceparent 传递链路；没有时使用 X-Trace-ID 作为 trace id。
+func startRequestSpan(c *fiber.Ctx) (context.Context, trace.Span) {
+	carrier := propagation.MapCarrier{}
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		carrier[strings.ToLower(string(key))] = string(value)
+	})
+	ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), carrier)
+
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		if traceID, err := trace.TraceIDFromHex(strings.ReplaceAll(c.Get(HeaderTraceID), "-", "")); err == nil {
+			var spanID trace.SpanID
+			rand.Read(spanID[:])
+			ctx = trace.ContextWithRemoteSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+				TraceID:    traceID,
+				SpanID:     spanID,
+				TraceFlags: trace.FlagsSampled,
+				Remote:     true,
+			}))
+		}
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, c.Method()+" "+c.Path(),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(c.Method()),
+			semconv.URLPath(c.Path()),
+			semconv.ClientAddress(GetClientIP(c)),
+		),
+	)
+	c.SetUserContext(ctx)
+
+	// 向客户端返回 traceparent，便于关联后续请求
+	response := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, response)
+	for key, value := range response {
+		c.Set(key, value)
+	}
+	return ctx, span
+}
+
+// endRequestSpan 按路由模板命名 span 并记录响应状态
+func endRequestSpan(c *fiber.Ctx, span trace.Span, status int, err error) {
+	span.SetName(c.Method() + " " + c.Route().Path)
+	span.SetAttributes(
+		semconv.HTTPRoute(c.Route().Path),
+		semconv.HTTPResponseStatusCode(status),
+	)
+	if err != nil {
+		span.RecordError(err)
+	}
+	if status >= fiber.StatusInternalServerError {
+		span.SetStatus(codes.Error, "")
+	}
+	span.End()
+}
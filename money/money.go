@@ -0,0 +1,210 @@
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency 系统内统一使用的币种，库内金额均以该币种的分存储
+const DefaultCurrency = "CNY"
+
+var (
+	ErrInvalidAmount    = errors.New("invalid yuan amount")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrOverflow         = errors.New("amount overflow")
+	ErrNullAmount       = errors.New("amount is NULL")
+)
+
+// yuanPattern 元金额格式：非负，最多两位小数，不允许科学计数法及多余的前导零
+var yuanPattern = regexp.MustCompile(`^(0|[1-9][0-9]{0,14})(\.[0-9]{1,2})?$`)
+
+// Money 以最小货币单位（分）保存的金额
+type Money struct {
+	minor    int64
+	currency string
+}
+
+// New 根据分和币种创建金额
+func New(minor int64, currency string) Money {
+	return Money{minor: minor, currency: strings.ToUpper(currency)}
+}
+
+// FromMinor 创建默认币种的金额
+func FromMinor(minor int64) Money {
+	return Money{minor: minor, currency: DefaultCurrency}
+}
+
+// ParseYuan 严格解析元字符串，如 "120.88"、"128"
+func ParseYuan(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if !yuanPattern.MatchString(s) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	for len(fracPart) < 2 {
+		fracPart += "0"
+	}
+	yuan, err := strconv.ParseInt(intPart, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	fen, _ := strconv.ParseInt(fracPart, 10, 64)
+	return FromMinor(yuan*100 + fen), nil
+}
+
+// Minor 返回以分为单位的金额
+func (m Money) Minor() int64 {
+	return m.minor
+}
+
+// Currency 返回币种，零值视为默认币种
+func (m Money) Currency() string {
+	if m.currency == "" {
+		return DefaultCurrency
+	}
+	return m.currency
+}
+
+// IsZero 金额是否为 0
+func (m Money) IsZero() bool {
+	return m.minor == 0
+}
+
+// IsPositive 金额是否大于 0
+func (m Money) IsPositive() bool {
+	return m.minor > 0
+}
+
+// Equal 币种和金额都相同
+func (m Money) Equal(o Money) bool {
+	return m.Currency() == o.Currency() && m.minor == o.minor
+}
+
+// Cmp 比较两个同币种金额，m < o 返回 -1，相等返回 0，否则返回 1
+func (m Money) Cmp(o Money) (int, error) {
+	if m.Currency() != o.Currency() {
+		return 0, ErrCurrencyMismatch
+	}
+	switch {
+	case m.minor < o.minor:
+		return -1, nil
+	case m.minor > o.minor:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Add 两个同币种金额相加
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency() != o.Currency() {
+		return Money{}, ErrCurrencyMismatch
+	}
+	return New(m.minor+o.minor, m.Currency()), nil
+}
+
+// Sub 两个同币种金额相减
+func (m Money) Sub(o Money) (Money, error) {
+	if m.Currency() != o.Currency() {
+		return Money{}, ErrCurrencyMismatch
+	}
+	return New(m.minor-o.minor, m.Currency()), nil
+}
+
+// Mul 金额乘以数量，结果超出 int64 范围时返回 ErrOverflow
+func (m Money) Mul(n int64) (Money, error) {
+	product := m.minor * n
+	if m.minor != 0 && (product/m.minor != n || (m.minor == -1 && n == math.MinInt64)) {
+		return Money{}, fmt.Errorf("%w: %s * %d", ErrOverflow, m, n)
+	}
+	return New(product, m.Currency()), nil
+}
+
+// String 格式化为元字符串，固定两位小数，如 "120.88"
+func (m Money) String() string {
+	minor := m.minor
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, minor/100, minor%100)
+}
+
+// MarshalJSON 输出为 JSON 数字字面量，如 120.88，保持与原接口兼容且不经过浮点转换
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON 接受 JSON 数字 120.88 或字符串 "120.88"，按元严格解析
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		*m = Money{}
+		return nil
+	}
+	if strings.HasPrefix(s, `"`) {
+		unquoted, err := strconv.Unquote(s)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidAmount, s)
+		}
+		s = unquoted
+	}
+
+	parsed, err := ParseYuan(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// UnmarshalText 按元严格解析，用于表单、查询参数等文本格式
+func (m *Money) UnmarshalText(text []byte) error {
+	parsed, err := ParseYuan(string(text))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value 以分写入数据库，只允许默认币种
+func (m Money) Value() (driver.Value, error) {
+	if m.Currency() != DefaultCurrency {
+		return nil, fmt.Errorf("%w: only %s can be stored, got %s", ErrCurrencyMismatch, DefaultCurrency, m.Currency())
+	}
+	return m.minor, nil
+}
+
+// Scan 从数据库读取以分存储的金额。金额列均为 NOT NULL，聚合结果需使用 COALESCE，
+// 读到 NULL 说明查询有误，返回 ErrNullAmount 而不是当作 0
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return ErrNullAmount
+	case int64:
+		*m = FromMinor(v)
+	case []byte:
+		return m.scanString(string(v))
+	case string:
+		return m.scanString(v)
+	default:
+		return fmt.Errorf("money: unsupported scan type %T", src)
+	}
+	return nil
+}
+
+func (m *Money) scanString(s string) error {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("money: invalid minor units %q", s)
+	}
+	*m = FromMinor(n)
+	return nil
+}
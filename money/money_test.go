@@ -0,0 +1,207 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestParseYuan(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr error
+	}{
+		{"0", 0, nil},
+		{"128", 12800, nil},
+		{"120.88", 12088, nil},
+		{"120.8", 12080, nil},
+		{"0.01", 1, nil},
+		{" 6.5 ", 650, nil},
+		{"999999999999999.99", 99999999999999999, nil},
+		{"", 0, ErrInvalidAmount},
+		{"-1", 0, ErrInvalidAmount},
+		{"1.234", 0, ErrInvalidAmount},
+		{"01", 0, ErrInvalidAmount},
+		{"1e3", 0, ErrInvalidAmount},
+		{".5", 0, ErrInvalidAmount},
+		{"1.", 0, ErrInvalidAmount},
+		{"1000000000000000", 0, ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		got, err := ParseYuan(tt.in)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("ParseYuan(%q) error = %v, want %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (got.Minor() != tt.want || got.Currency() != DefaultCurrency) {
+			t.Errorf("ParseYuan(%q) = %d %s, want %d", tt.in, got.Minor(), got.Currency(), tt.want)
+		}
+	}
+}
+
+func TestMul(t *testing.T) {
+	tests := []struct {
+		minor   int64
+		n       int64
+		want    int64
+		wantErr error
+	}{
+		{12088, 3, 36264, nil},
+		{100, 0, 0, nil},
+		{0, math.MaxInt64, 0, nil},
+		{math.MaxInt64, 1, math.MaxInt64, nil},
+		{math.MaxInt64 / 2, 2, math.MaxInt64 - 1, nil},
+		{math.MaxInt64/2 + 1, 2, 0, ErrOverflow},
+		{9900, math.MaxInt64 / 100, 0, ErrOverflow},
+		{-1, math.MinInt64, 0, ErrOverflow},
+		{math.MinInt64, -1, 0, ErrOverflow},
+	}
+	for _, tt := range tests {
+		got, err := FromMinor(tt.minor).Mul(tt.n)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Mul(%d, %d) error = %v, want %v", tt.minor, tt.n, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got.Minor() != tt.want {
+			t.Errorf("Mul(%d, %d) = %d, want %d", tt.minor, tt.n, got.Minor(), tt.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		minor int64
+		want  string
+	}{
+		{0, "0.00"},
+		{1, "0.01"},
+		{12088, "120.88"},
+		{12800, "128.00"},
+		{-505, "-5.05"},
+	}
+	for _, tt := range tests {
+		if got := FromMinor(tt.minor).String(); got != tt.want {
+			t.Errorf("FromMinor(%d).String() = %q, want %q", tt.minor, got, tt.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	data, err := json.Marshal(struct {
+		Amount Money `json:"amount"`
+	}{FromMinor(12088)})
+	if err != nil || string(data) != `{"amount":120.88}` {
+		t.Errorf("Marshal = %s, %v", data, err)
+	}
+
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{`120.88`, 12088, false},
+		{`"120.88"`, 12088, false},
+		{`null`, 0, false},
+		{`120.888`, 0, true},
+		{`1e2`, 0, true},
+		{`"abc"`, 0, true},
+		{`-1`, 0, true},
+	}
+	for _, tt := range tests {
+		var m Money
+		err := json.Unmarshal([]byte(tt.in), &m)
+		if (err != nil) != tt.wantErr || m.Minor() != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, %v; want %d, err %v", tt.in, m.Minor(), err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestCurrency(t *testing.T) {
+	cny := FromMinor(100)
+	usd := New(100, "usd")
+	if cny.Equal(usd) {
+		t.Error("amounts in different currencies must not be equal")
+	}
+	if _, err := cny.Add(usd); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Add error = %v, want %v", err, ErrCurrencyMismatch)
+	}
+	if _, err := usd.Value(); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Value error = %v, want %v", err, ErrCurrencyMismatch)
+	}
+	if (Money{}).Currency() != DefaultCurrency {
+		t.Error("zero value should use the default currency")
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		src     interface{}
+		want    int64
+		wantErr bool
+	}{
+		{int64(12088), 12088, false},
+		{[]byte("12088"), 12088, false},
+		{"5", 5, false},
+		{nil, 0, true},
+		{"1.5", 0, true},
+		{3.14, 0, true},
+	}
+	for _, tt := range tests {
+		var m Money
+		err := m.Scan(tt.src)
+		if (err != nil) != tt.wantErr || m.Minor() != tt.want {
+			t.Errorf("Scan(%v) = %d, %v; want %d, err %v", tt.src, m.Minor(), err, tt.want, tt.wantErr)
+		}
+	}
+
+	var m Money
+	if err := m.Scan(nil); !errors.Is(err, ErrNullAmount) {
+		t.Errorf("Scan(nil) = %v, want ErrNullAmount", err)
+	}
+}
+
+func TestUnmarshalText(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"120.88", 12088, false},
+		{"5", 500, false},
+		{"", 0, true},
+		{"1.234", 0, true},
+		{"-1", 0, true},
+		{"abc", 0, true},
+	}
+	for _, tt := range tests {
+		var m Money
+		err := m.UnmarshalText([]byte(tt.in))
+		if (err != nil) != tt.wantErr || m.Minor() != tt.want {
+			t.Errorf("UnmarshalText(%q) = %d, %v; want %d, err %v", tt.in, m.Minor(), err, tt.want, tt.wantErr)
+		}
+	}
+
+	// 表单和查询参数通过 encoding.TextUnmarshaler 解析
+	var query struct {
+		Price Money `query:"price"`
+	}
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		if err := c.QueryParser(&query); err != nil {
+			return err
+		}
+		return c.SendString(query.Price.String())
+	})
+	resp, err := app.Test(httptest.NewRequest("GET", "/?price=12.50", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK || query.Price.Minor() != 1250 {
+		t.Errorf("QueryParser price = %d, status %d; want 1250", query.Price.Minor(), resp.StatusCode)
+	}
+}
@@ -0,0 +1,120 @@
+package orderstate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// State 订单状态，0/1/2 与历史数据保持一致
+type State int
+
+const (
+	Created           State = 0 // 已创建，未支付
+	Cancelled         State = 1 // 已取消
+	Paid              State = 2 // 已支付
+	PendingPayment    State = 3 // 已提交支付，等待平台结果
+	Delivered         State = 4 // 已发货
+	Refunded          State = 5 // 已退款
+	Expired           State = 6 // 已过期
+	PartiallyRefunded State = 7 // 部分退款
+	DeliveryFailed    State = 8 // 发货失败
+)
+
+// 操作方
+const (
+	ActorUser     = "user"
+	ActorPlatform = "platform"
+	ActorSystem   = "system"
+	ActorAdmin    = "admin"
+)
+
+var (
+	ErrIllegalTransition = errors.New("illegal order state transition")
+	ErrStateChanged      = errors.New("order state changed concurrently")
+)
+
+var names = map[State]string{
+	Created:           "created",
+	Cancelled:         "cancelled",
+	Paid:              "paid",
+	PendingPayment:    "pending_payment",
+	Delivered:         "delivered",
+	Refunded:          "refunded",
+	Expired:           "expired",
+	PartiallyRefunded: "partially_refunded",
+	DeliveryFailed:    "delivery_failed",
+}
+
+// transitions 合法的状态迁移
+var transitions = map[State][]State{
+	Created:        {PendingPayment, Paid, Cancelled, Expired},
+	PendingPayment: {Paid, Cancelled, Expired},
+	Paid:           {Delivered, DeliveryFailed, Refunded, PartiallyRefunded},
+	Delivered:      {Refunded, PartiallyRefunded},
+	// 多次部分退款时保持部分退款状态，累计退完后变为已退款
+	PartiallyRefunded: {PartiallyRefunded, Refunded},
+	// 发货失败后可由管理员重推或直接退款
+	DeliveryFailed: {Delivered, Refunded, PartiallyRefunded},
+}
+
+// Meta 状态迁移的审计信息
+type Meta struct {
+	Actor   string
+	Reason  string
+	TraceID string
+	Ctx     context.Context // 请求上下文，数据库和外部调用的 span 挂在该链路下，可为空
+}
+
+// Context 返回操作的上下文，未设置时为 context.Background()
+func (m Meta) Context() context.Context {
+	if m.Ctx == nil {
+		return context.Background()
+	}
+	return m.Ctx
+}
+
+func (s State) String() string {
+	if name, ok := names[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", int(s))
+}
+
+// Parse 将状态名解析为 State
+func Parse(name string) (State, bool) {
+	for s, n := range names {
+		if n == name {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// CanTransition 判断 from -> to 是否合法
+func CanTransition(from, to State) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Check 校验迁移，不合法时返回 ErrIllegalTransition
+func Check(from, to State) error {
+	if !CanTransition(from, to) {
+		return fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, from, to)
+	}
+	return nil
+}
+
+// Refundable 可以申请退款的状态
+func Refundable() []State {
+	return []State{Paid, Delivered, DeliveryFailed, PartiallyRefunded}
+}
+
+// Unpaid 尚未支付、仍可继续支付的状态
+func Unpaid() []State {
+	return []State{Created, PendingPayment}
+}
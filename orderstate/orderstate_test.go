@@ -0,0 +1,99 @@
+package orderstate
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+var allStates = []State{Created, Cancelled, Paid, PendingPayment, Delivered, Refunded, Expired, PartiallyRefunded, DeliveryFailed}
+
+func TestCheck(t *testing.T) {
+	allowed := map[[2]State]bool{
+		{Created, PendingPayment}:              true,
+		{Created, Paid}:                        true,
+		{Created, Cancelled}:                   true,
+		{Created, Expired}:                     true,
+		{PendingPayment, Paid}:                 true,
+		{PendingPayment, Cancelled}:            true,
+		{PendingPayment, Expired}:              true,
+		{Paid, Delivered}:                      true,
+		{Paid, DeliveryFailed}:                 true,
+		{Paid, Refunded}:                       true,
+		{Paid, PartiallyRefunded}:              true,
+		{Delivered, Refunded}:                  true,
+		{Delivered, PartiallyRefunded}:         true,
+		{PartiallyRefunded, PartiallyRefunded}: true,
+		{PartiallyRefunded, Refunded}:          true,
+		{DeliveryFailed, Delivered}:            true,
+		{DeliveryFailed, Refunded}:             true,
+		{DeliveryFailed, PartiallyRefunded}:    true,
+	}
+
+	// 遍历全部状态组合，未列出的迁移都不合法
+	for _, from := range allStates {
+		for _, to := range allStates {
+			err := Check(from, to)
+			if allowed[[2]State{from, to}] {
+				if err != nil {
+					t.Errorf("Check(%s, %s) = %v, want nil", from, to, err)
+				}
+			} else if !errors.Is(err, ErrIllegalTransition) {
+				t.Errorf("Check(%s, %s) = %v, want %v", from, to, err, ErrIllegalTransition)
+			}
+		}
+	}
+}
+
+func TestTerminalStates(t *testing.T) {
+	for _, s := range []State{Cancelled, Expired, Refunded} {
+		for _, to := range allStates {
+			if CanTransition(s, to) {
+				t.Errorf("terminal state %s must not transition to %s", s, to)
+			}
+		}
+	}
+}
+
+func TestStateGroups(t *testing.T) {
+	for _, s := range Unpaid() {
+		if slices.Contains(Refundable(), s) {
+			t.Errorf("unpaid state %s must not be refundable", s)
+		}
+		if !CanTransition(s, Paid) {
+			t.Errorf("unpaid state %s must be payable", s)
+		}
+	}
+	for _, s := range Refundable() {
+		if !CanTransition(s, Refunded) {
+			t.Errorf("refundable state %s must allow a full refund", s)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, s := range allStates {
+		got, ok := Parse(s.String())
+		if !ok || got != s {
+			t.Errorf("Parse(%q) = %v, %v; want %v", s.String(), got, ok, s)
+		}
+	}
+	if _, ok := Parse("unknown"); ok {
+		t.Error(`Parse("unknown") should fail`)
+	}
+	if got := State(99).String(); got != "unknown(99)" {
+		t.Errorf("State(99).String() = %q", got)
+	}
+}
+
+func TestMetaContext(t *testing.T) {
+	if (Meta{}).Context() == nil {
+		t.Error("Meta.Context() must not be nil")
+	}
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "v")
+	if (Meta{Ctx: ctx}).Context() != ctx {
+		t.Error("Meta.Context() should return Ctx")
+	}
+}
@@ -0,0 +1,128 @@
+package reconcile
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"api-pay/db"
+)
+
+// DateLayout 对账日期格式
+const DateLayout = "2006-01-02"
+
+// Result 一次对账的汇总
+type Result struct {
+	BillDate   string           `json:"bill_date"`
+	File       string           `json:"file"`
+	Lines      int              `json:"lines"`
+	Duplicates int              `json:"duplicates"`
+	Counts     map[string]int64 `json:"counts"`
+}
+
+// Run 对账指定日期的支付记录，path 为空时按配置查找结算文件。
+// 结算文件中的记录按游戏订单号和平台订单号与本地支付记录匹配，
+// 本地当天的支付记录未与结算文件中任何记录对应的记为平台缺失。
+func Run(date time.Time, path string) (*Result, error) {
+	var err error
+	if path == "" {
+		if path, err = SettlementFile(date); err != nil {
+			return nil, err
+		}
+	}
+
+	lines, err := LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.Local)
+	result := &Result{
+		BillDate: start.Format(DateLayout),
+		File:     path,
+		Lines:    len(lines),
+		Counts:   make(map[string]int64),
+	}
+
+	orderNos := make([]string, 0, len(lines))
+	for _, l := range lines {
+		orderNos = append(orderNos, l.GameOrderNo)
+	}
+	pays, err := db.GetOrderPaysByOrderNos(orderNos)
+	if err != nil {
+		return nil, err
+	}
+	dayPays, err := db.GetOrderPaysBetween(start, start.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+
+	source := filepath.Base(path)
+	seen := make(map[string]bool, len(lines))
+	// 已与结算文件中的记录对应的本地支付记录
+	paired := make(map[string]bool, len(lines))
+	items := make([]db.GameReconciliation, 0, len(lines))
+
+	for _, l := range lines {
+		key := l.GameOrderNo + "|" + l.GyyxOrderNo
+		if seen[key] {
+			result.Duplicates++
+			continue
+		}
+		seen[key] = true
+
+		item := db.GameReconciliation{
+			BillDate:     result.BillDate,
+			GameOrderNo:  l.GameOrderNo,
+			GyyxOrderNo:  l.GyyxOrderNo,
+			RemoteAmount: l.Amount,
+			SourceFile:   source,
+		}
+
+		pay := pays[l.GameOrderNo]
+		if pay != nil {
+			paired[pay.GameOrderNo+"|"+pay.GyyxOrderNo] = true
+		}
+		switch {
+		case pay == nil:
+			item.Status = db.ReconcileMissingLocal
+		case pay.GyyxOrderNo != l.GyyxOrderNo:
+			item.Status = db.ReconcileOrderNoMismatch
+			item.LocalAmount = pay.RmbYuan
+			item.ServerFlag = pay.ServerFlag
+			item.Message = fmt.Sprintf("本地平台订单号为 %s", pay.GyyxOrderNo)
+		case !pay.RmbYuan.Equal(l.Amount):
+			item.Status = db.ReconcileAmountMismatch
+			item.LocalAmount = pay.RmbYuan
+			item.ServerFlag = pay.ServerFlag
+		default:
+			item.Status = db.ReconcileMatched
+			item.LocalAmount = pay.RmbYuan
+			item.ServerFlag = pay.ServerFlag
+		}
+		items = append(items, item)
+	}
+
+	for _, pay := range dayPays {
+		if paired[pay.GameOrderNo+"|"+pay.GyyxOrderNo] {
+			continue
+		}
+		items = append(items, db.GameReconciliation{
+			BillDate:    result.BillDate,
+			Status:      db.ReconcileMissingRemote,
+			GameOrderNo: pay.GameOrderNo,
+			GyyxOrderNo: pay.GyyxOrderNo,
+			LocalAmount: pay.RmbYuan,
+			ServerFlag:  pay.ServerFlag,
+			SourceFile:  source,
+		})
+	}
+
+	if err := db.SaveReconciliation(result.BillDate, items); err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		result.Counts[item.Status]++
+	}
+	return result, nil
+}
@@ -0,0 +1,86 @@
+package reconcile
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"api-pay/db"
+	"api-pay/db/dbtest"
+	"api-pay/money"
+)
+
+func TestRun(t *testing.T) {
+	dbtest.Open(t)
+	date := time.Date(2026, 10, 16, 0, 0, 0, 0, time.Local)
+
+	for _, p := range []struct {
+		order, platform string
+		amount          int64
+	}{
+		{"811-1", "P1", 100},
+		{"811-2", "P2", 100},
+		{"811-3", "P3", 100},
+		{"811-5", "P5", 100},
+	} {
+		pay := db.GameOrderPay{
+			GameOrderNo: p.order,
+			GyyxOrderNo: p.platform,
+			RmbYuan:     money.FromMinor(p.amount),
+			CreatedAt:   date.Add(time.Hour),
+		}
+		if err := db.DB.Create(&pay).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "settle.csv")
+	csv := "gyyx_order_no,game_order_no,amount\n" +
+		"P1,811-1,1.00\n" + // 一致
+		"P1,811-1,1.00\n" + // 重复行
+		"P2,811-2,2.00\n" + // 金额不一致
+		"PX,811-3,1.00\n" + // 平台订单号不一致
+		"P4,811-4,1.00\n" // 本地缺失，811-5 平台缺失
+	if err := os.WriteFile(path, []byte(csv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Run(date, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int64{
+		db.ReconcileMatched:         1,
+		db.ReconcileAmountMismatch:  1,
+		db.ReconcileOrderNoMismatch: 1,
+		db.ReconcileMissingLocal:    1,
+		db.ReconcileMissingRemote:   1,
+	}
+	if !maps.Equal(result.Counts, want) {
+		t.Errorf("counts = %v, want %v", result.Counts, want)
+	}
+	if result.Lines != 5 || result.Duplicates != 1 {
+		t.Errorf("lines = %d, duplicates = %d, want 5 and 1", result.Lines, result.Duplicates)
+	}
+
+	var items []db.GameReconciliation
+	if err := db.DB.Where("bill_date = ?", "2026-10-16").Find(&items).Error; err != nil {
+		t.Fatal(err)
+	}
+	statuses := map[string]string{}
+	for _, item := range items {
+		statuses[item.GameOrderNo] = item.Status
+	}
+	wantStatuses := map[string]string{
+		"811-1": db.ReconcileMatched,
+		"811-2": db.ReconcileAmountMismatch,
+		"811-3": db.ReconcileOrderNoMismatch,
+		"811-4": db.ReconcileMissingLocal,
+		"811-5": db.ReconcileMissingRemote,
+	}
+	if !maps.Equal(statuses, wantStatuses) {
+		t.Errorf("statuses = %v, want %v", statuses, wantStatuses)
+	}
+}
@@ -0,0 +1,123 @@
+package reconcile
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	conf "api-pay/config"
+	"api-pay/money"
+)
+
+var (
+	ErrDirMissing      = errors.New("reconcile: settlement dir not configured")
+	ErrFileNotFound    = errors.New("reconcile: settlement file not found")
+	ErrUnsupportedFile = errors.New("reconcile: unsupported settlement file type")
+)
+
+const defaultFilePattern = "settle_{date}"
+
+// Line 结算文件中的一笔支付，amount 单位为元
+type Line struct {
+	GyyxOrderNo string      `json:"gyyx_order_no"`
+	GameOrderNo string      `json:"game_order_no"`
+	Amount      money.Money `json:"amount"`
+}
+
+// SettlementFile 按配置查找对账日期对应的结算文件，依次尝试 .csv 和 .json
+func SettlementFile(date time.Time) (string, error) {
+	dir := conf.AppConfig.Reconcile.Dir
+	if dir == "" {
+		return "", ErrDirMissing
+	}
+	pattern := conf.AppConfig.Reconcile.FilePattern
+	if pattern == "" {
+		pattern = defaultFilePattern
+	}
+
+	name := strings.ReplaceAll(pattern, "{date}", date.Format("20060102"))
+	for _, ext := range []string{".csv", ".json"} {
+		path := filepath.Join(dir, name+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrFileNotFound, filepath.Join(dir, name))
+}
+
+// LoadFile 按扩展名解析结算文件
+func LoadFile(path string) ([]Line, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return parseCSV(f)
+	case ".json":
+		return parseJSON(f)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFile, path)
+	}
+}
+
+// parseCSV 解析带表头的 CSV，列顺序不限，需包含 gyyx_order_no、game_order_no、amount
+func parseCSV(r io.Reader) ([]Line, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		// 兼容带 BOM 的文件
+		name = strings.TrimPrefix(strings.TrimSpace(name), "\ufeff")
+		columns[strings.ToLower(name)] = i
+	}
+	for _, name := range []string{"gyyx_order_no", "game_order_no", "amount"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("csv header missing column %q", name)
+		}
+	}
+
+	var lines []Line
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read csv row %d: %w", row, err)
+		}
+
+		amount, err := money.ParseYuan(strings.TrimSpace(record[columns["amount"]]))
+		if err != nil {
+			return nil, fmt.Errorf("csv row %d: %w", row, err)
+		}
+		lines = append(lines, Line{
+			GyyxOrderNo: strings.TrimSpace(record[columns["gyyx_order_no"]]),
+			GameOrderNo: strings.TrimSpace(record[columns["game_order_no"]]),
+			Amount:      amount,
+		})
+	}
+	return lines, nil
+}
+
+// parseJSON 解析 JSON 数组格式的结算文件
+func parseJSON(r io.Reader) ([]Line, error) {
+	var lines []Line
+	if err := json.NewDecoder(r).Decode(&lines); err != nil {
+		return nil, fmt.Errorf("decode json: %w", err)
+	}
+	return lines, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	initialization "api-pay/init"
+	"api-pay/reconcile"
+)
+
+// runReconcile 执行对账子命令：api-pay reconcile [-date 2006-01-02] [-file path]
+// 默认对账前一天，未指定文件时按配置目录查找结算文件
+func runReconcile(args []string) int {
+	fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	date := fs.String("date", time.Now().AddDate(0, 0, -1).Format(reconcile.DateLayout), "对账日期")
+	file := fs.String("file", "", "结算文件路径，默认按配置查找")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	billDate, err := time.ParseInLocation(reconcile.DateLayout, *date, time.Local)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid date %q: %v\n", *date, err)
+		return 2
+	}
+
+	initialization.Initialization()
+
+	result, err := reconcile.Run(billDate, *file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "reconcile failed: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("bill date: %s\nfile: %s\nlines: %d (duplicates %d)\n",
+		result.BillDate, result.File, result.Lines, result.Duplicates)
+	for status, n := range result.Counts {
+		fmt.Printf("%s: %d\n", status, n)
+	}
+	return 0
+}
@@ -1,7 +1,10 @@
 package routes
 
 import (
+	"api-pay/auth"
 	"api-pay/handlers"
+	"api-pay/metrics"
+	"api-pay/middleware"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/monitor"
 )
@@ -10,21 +13,69 @@ func InitRoutes(app *fiber.App) {
 	fz_pay := app.Group("/api")
 	// 获取商品
 	fz_pay.Get("/goods", handlers.HandleGoods)
-	// 飞猪回调
-	fz_pay.Post("/callback", handlers.HandleCallback)
+	// 支付回调，兼容旧的飞猪回调地址
+	fz_pay.Post("/callback", handlers.HandleChannelCallback)
+	fz_pay.Post("/:channel/callback", handlers.HandleChannelCallback)
 	// 建单接口
 	fz_pay.Post("/create-order", handlers.HandleCreateOrder)
 	// 删单接口
 	fz_pay.Post("/cancel-order", handlers.HandleCancelOrder)
 	// 验证接口
 	fz_pay.Post("/verification", handlers.HandleVerification)
+	// 退款申请
+	fz_pay.Post("/refund", handlers.HandleRefund)
+	// 退款结果通知，兼容旧的飞猪通知地址
+	fz_pay.Post("/refund-notify", handlers.HandleRefundNotify)
+	fz_pay.Post("/:channel/refund-notify", handlers.HandleRefundNotify)
+	// 订单详情
+	fz_pay.Get("/order/:order", handlers.HandleOrderDetail)
+	// 订单列表
+	fz_pay.Get("/orders", handlers.HandleOrderList)
 	// 提交订单
 	fz_pay.Post("/submit-order", handlers.HandleSubmitOrder)
 
+	// 管理员认证
+	authGroup := fz_pay.Group("/auth")
+	authGroup.Post("/login", handlers.HandleLogin)
+	authGroup.Post("/refresh", handlers.HandleRefreshToken)
+	authGroup.Post("/logout", middleware.AdminAuthMiddleware(), handlers.HandleLogout)
+	authGroup.Post("/credentials", middleware.AdminAuthMiddleware(), handlers.HandleChangeCredentials)
+
+	// 管理接口，仅白名单IP可访问且需要管理员登录
+	manage := fz_pay.Group("/manage", middleware.AdminAuthMiddleware())
+	viewer := middleware.RequireRole(auth.RoleViewer)
+	operator := middleware.RequireRole(auth.RoleOperator)
+	admin := middleware.RequireRole(auth.RoleAdmin)
+	// 重推发货通知
+	manage.Post("/delivery/retry", operator, handlers.HandleDeliveryRetry)
+	// 强制查单
+	manage.Post("/order/query", operator, handlers.HandleManageOrderQuery)
+	// 商品管理
+	manage.Get("/goods", viewer, handlers.HandleManageGoodsList)
+	manage.Post("/goods", operator, handlers.HandleManageGoodsCreate)
+	manage.Put("/goods/:id", operator, handlers.HandleManageGoodsUpdate)
+	manage.Delete("/goods/:id", operator, handlers.HandleManageGoodsDelete)
+	manage.Post("/goods/:id/enable", operator, handlers.HandleManageGoodsEnable)
+	manage.Post("/goods/:id/disable", operator, handlers.HandleManageGoodsDisable)
+	manage.Get("/goods/:id/prices", viewer, handlers.HandleManageGoodsPrices)
+	// 对账报告
+	manage.Get("/reconciliation", viewer, handlers.HandleManageReconciliation)
+	// 客户端签发
+	manage.Get("/clients", admin, handlers.HandleManageClientList)
+	manage.Post("/clients", admin, handlers.HandleManageClientCreate)
+	manage.Post("/clients/:app_key/enable", admin, handlers.HandleManageClientEnable)
+	manage.Post("/clients/:app_key/disable", admin, handlers.HandleManageClientDisable)
+	// 管理员账号
+	manage.Get("/admins", admin, handlers.HandleManageAdminList)
+	manage.Post("/admins", admin, handlers.HandleManageAdminCreate)
+	manage.Put("/admins/:id", admin, handlers.HandleManageAdminUpdate)
+
 	// 系统接口-接口文档
 	fz_pay.Get("/doc", handlers.HandleApiDoc)
 	// 系统接口-指标接口
 	fz_pay.Get("/metrics", monitor.New(monitor.Config{Title: "Service Metrics Page"}))
+	// 系统接口-Prometheus 指标
+	app.Get("/metrics", metrics.Handler())
 	// 系统接口-健康检查
 	fz_pay.Get("/health", func(c *fiber.Ctx) error { return c.SendString("ok") })
 }
@@ -0,0 +1,44 @@
+package sign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// RequestString 客户端请求的待签名串：
+// METHOD\nURI\nTIMESTAMP\nNONCE\nhex(sha256(body))，URI 包含查询参数
+func RequestString(method, uri, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	return strings.Join([]string{
+		strings.ToUpper(method),
+		uri,
+		timestamp,
+		nonce,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+}
+
+// SignRequest 使用 HMAC-SHA256 对客户端请求签名，返回十六进制小写
+func SignRequest(secret, method, uri, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(RequestString(method, uri, timestamp, nonce, body)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyRequest 校验客户端请求签名
+func VerifyRequest(secret, signature, method, uri, timestamp, nonce string, body []byte) error {
+	if signature == "" {
+		return ErrSignMissing
+	}
+	if secret == "" {
+		return ErrSecretMissing
+	}
+
+	expected := SignRequest(secret, method, uri, timestamp, nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return ErrSignMismatch
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package sign
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRequestString(t *testing.T) {
+	got := RequestString("post", "/api/refund?x=1", "1700000000", "n1", []byte("{}"))
+	want := "POST\n/api/refund?x=1\n1700000000\nn1\n44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"
+	if got != want {
+		t.Errorf("RequestString = %q, want %q", got, want)
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	const valid = "6dfac8bec8ecdecf4fd5fbf48300babfa0da2a340e14a8258e2759f44d1abf36"
+	if got := SignRequest("secret", "POST", "/api/refund?x=1", "1700000000", "n1", []byte("{}")); got != valid {
+		t.Fatalf("SignRequest = %q, want %q", got, valid)
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		signature string
+		body      string
+		wantErr   error
+	}{
+		{"valid", "secret", valid, "{}", nil},
+		{"body changed", "secret", valid, `{"a":1}`, ErrSignMismatch},
+		{"wrong secret", "other", valid, "{}", ErrSignMismatch},
+		{"missing signature", "secret", "", "{}", ErrSignMissing},
+		{"missing secret", "", valid, "{}", ErrSecretMissing},
+	}
+	for _, tt := range tests {
+		err := VerifyRequest(tt.secret, tt.signature, "POST", "/api/refund?x=1", "1700000000", "n1", []byte(tt.body))
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: VerifyRequest = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
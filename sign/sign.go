@@ -0,0 +1,157 @@
+package sign
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 支持的签名类型
+const (
+	TypeMD5        = "MD5"
+	TypeHMACSHA256 = "HMAC-SHA256"
+)
+
+var (
+	ErrSignMissing      = errors.New("sign is missing")
+	ErrSignTypeInvalid  = errors.New("unsupported sign type")
+	ErrSignMismatch     = errors.New("sign mismatch")
+	ErrSecretMissing    = errors.New("sign secret is not configured")
+	ErrTimestampInvalid = errors.New("invalid timestamp")
+	ErrTimestampExpired = errors.New("timestamp out of allowed window")
+)
+
+// 不参与签名的参数
+var excludedKeys = map[string]bool{
+	"sign":      true,
+	"signType":  true,
+	"sign_type": true,
+}
+
+// NormalizeType 统一签名类型写法，如 hmac_sha256、HMACSHA256 均视为 HMAC-SHA256
+func NormalizeType(signType string) (string, error) {
+	t := strings.ToUpper(strings.TrimSpace(signType))
+	t = strings.NewReplacer("-", "", "_", "").Replace(t)
+	switch t {
+	case "", "MD5":
+		return TypeMD5, nil
+	case "HMACSHA256":
+		return TypeHMACSHA256, nil
+	}
+	return "", ErrSignTypeInvalid
+}
+
+// CanonicalString 按参数名升序拼接 key=value&key=value，空值及签名字段不参与
+func CanonicalString(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for k, v := range params {
+		if excludedKeys[k] || v == "" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(params[k])
+	}
+	return b.String()
+}
+
+// Sign 计算参数签名，结果为小写十六进制
+//
+//	MD5:         md5(canonical + "&key=" + secret)
+//	HMAC-SHA256: hmac_sha256(secret, canonical)
+func Sign(params map[string]string, signType, secret string) (string, error) {
+	if secret == "" {
+		return "", ErrSecretMissing
+	}
+	t, err := NormalizeType(signType)
+	if err != nil {
+		return "", err
+	}
+
+	canonical := CanonicalString(params)
+	switch t {
+	case TypeHMACSHA256:
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(canonical))
+		return hex.EncodeToString(mac.Sum(nil)), nil
+	default:
+		sum := md5.Sum([]byte(canonical + "&key=" + secret))
+		return hex.EncodeToString(sum[:]), nil
+	}
+}
+
+// Verify 校验参数签名，大小写不敏感，使用常量时间比较
+func Verify(params map[string]string, signType, signature, secret string) error {
+	if signature == "" {
+		return ErrSignMissing
+	}
+	expected, err := Sign(params, signType, secret)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return ErrSignMismatch
+	}
+	return nil
+}
+
+// ParseTimestamp 解析时间戳，支持秒、毫秒以及 2006-01-02 15:04:05 格式
+func ParseTimestamp(ts string) (time.Time, error) {
+	ts = strings.TrimSpace(ts)
+	if ts == "" {
+		return time.Time{}, ErrTimestampInvalid
+	}
+
+	// 14 位数字为 20060102150405 格式，毫秒时间戳在 2286 年前均为 13 位
+	if len(ts) == 14 {
+		if t, err := time.ParseInLocation("20060102150405", ts, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	if n, err := strconv.ParseInt(ts, 10, 64); err == nil {
+		if len(ts) >= 13 {
+			return time.UnixMilli(n), nil
+		}
+		return time.Unix(n, 0), nil
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", ts, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, ErrTimestampInvalid
+}
+
+// CheckTimestamp 校验时间戳是否在 now 前后 window 范围内，window <= 0 时不校验
+func CheckTimestamp(ts string, window time.Duration, now time.Time) error {
+	if window <= 0 {
+		return nil
+	}
+	t, err := ParseTimestamp(ts)
+	if err != nil {
+		return err
+	}
+	diff := now.Sub(t)
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > window {
+		return ErrTimestampExpired
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package sign
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNormalizeType(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr error
+	}{
+		{"", TypeMD5, nil},
+		{"md5", TypeMD5, nil},
+		{"HMAC-SHA256", TypeHMACSHA256, nil},
+		{"hmac_sha256", TypeHMACSHA256, nil},
+		{" HMACSHA256 ", TypeHMACSHA256, nil},
+		{"SHA1", "", ErrSignTypeInvalid},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeType(tt.in)
+		if got != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("NormalizeType(%q) = %q, %v; want %q, %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestCanonicalString(t *testing.T) {
+	tests := []struct {
+		name   string
+		params map[string]string
+		want   string
+	}{
+		{"sorted", map[string]string{"b": "2", "a": "1"}, "a=1&b=2"},
+		{"sign fields excluded", map[string]string{"a": "1", "sign": "x", "signType": "MD5", "sign_type": "MD5"}, "a=1"},
+		{"empty values excluded", map[string]string{"a": "1", "b": ""}, "a=1"},
+		{"empty", map[string]string{}, ""},
+	}
+	for _, tt := range tests {
+		if got := CanonicalString(tt.params); got != tt.want {
+			t.Errorf("%s: CanonicalString = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	params := map[string]string{"b": "2", "a": "1", "sign": "ignored"}
+	tests := []struct {
+		signType string
+		secret   string
+		want     string
+		wantErr  error
+	}{
+		{TypeMD5, "secret", "9f565ccd686cfa5dc3b06b3a89e4e3ad", nil},
+		{TypeHMACSHA256, "secret", "604fe97c66c6393ff22e3cae366eee1131e351ebc736bf12f5d62e1755b7a233", nil},
+		{TypeMD5, "", "", ErrSecretMissing},
+		{"RSA", "secret", "", ErrSignTypeInvalid},
+	}
+	for _, tt := range tests {
+		got, err := Sign(params, tt.signType, tt.secret)
+		if got != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("Sign(%s) = %q, %v; want %q, %v", tt.signType, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	params := map[string]string{"a": "1", "b": "2"}
+	tests := []struct {
+		name      string
+		signType  string
+		signature string
+		wantErr   error
+	}{
+		{"md5", TypeMD5, "9f565ccd686cfa5dc3b06b3a89e4e3ad", nil},
+		{"upper case", TypeMD5, "9F565CCD686CFA5DC3B06B3A89E4E3AD", nil},
+		{"hmac", "hmac_sha256", "604fe97c66c6393ff22e3cae366eee1131e351ebc736bf12f5d62e1755b7a233", nil},
+		{"wrong type", TypeHMACSHA256, "9f565ccd686cfa5dc3b06b3a89e4e3ad", ErrSignMismatch},
+		{"missing", TypeMD5, "", ErrSignMissing},
+		{"tampered", TypeMD5, "0f565ccd686cfa5dc3b06b3a89e4e3ad", ErrSignMismatch},
+	}
+	for _, tt := range tests {
+		if err := Verify(params, tt.signType, tt.signature, "secret"); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Verify = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	local := time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local)
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr error
+	}{
+		{"1704164645", time.Unix(1704164645, 0), nil},
+		{"1704164645123", time.UnixMilli(1704164645123), nil},
+		{"2024-01-02 03:04:05", local, nil},
+		{"20240102030405", local, nil},
+		{"", time.Time{}, ErrTimestampInvalid},
+		{"yesterday", time.Time{}, ErrTimestampInvalid},
+	}
+	for _, tt := range tests {
+		got, err := ParseTimestamp(tt.in)
+		if !got.Equal(tt.want) || !errors.Is(err, tt.wantErr) {
+			t.Errorf("ParseTimestamp(%q) = %v, %v; want %v, %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckTimestamp(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		name    string
+		ts      string
+		window  time.Duration
+		wantErr error
+	}{
+		{"inside window", "1699999800", 5 * time.Minute, nil},
+		{"future inside window", "1700000200", 5 * time.Minute, nil},
+		{"on the edge", "1699999700", 5 * time.Minute, nil},
+		{"too old", "1699999699", 5 * time.Minute, ErrTimestampExpired},
+		{"too far ahead", "1700000301", 5 * time.Minute, ErrTimestampExpired},
+		{"milliseconds", "1700000000123", time.Second, nil},
+		{"invalid", "abc", 5 * time.Minute, ErrTimestampInvalid},
+		{"window disabled", "abc", 0, nil},
+	}
+	for _, tt := range tests {
+		if err := CheckTimestamp(tt.ts, tt.window, now); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: CheckTimestamp(%q) = %v, want %v", tt.name, tt.ts, err, tt.wantErr)
+		}
+	}
+}
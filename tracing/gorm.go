@@ -0,0 +1,71 @@
+package tracing
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const dbSpanKey = "tracing:span"
+
+// RegisterDB 为 GORM 语句创建 span。仅在上下文中已有 span（即请求链路内）时记录，
+// 后台任务等没有链路的查询不单独产生 span
+func RegisterDB(gdb *gorm.DB) error {
+	cb := gdb.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("tracing:before_create", startSpan("create")),
+		cb.Create().After("gorm:create").Register("tracing:after_create", endSpan),
+		cb.Query().Before("gorm:query").Register("tracing:before_query", startSpan("query")),
+		cb.Query().After("gorm:query").Register("tracing:after_query", endSpan),
+		cb.Update().Before("gorm:update").Register("tracing:before_update", startSpan("update")),
+		cb.Update().After("gorm:update").Register("tracing:after_update", endSpan),
+		cb.Delete().Before("gorm:delete").Register("tracing:before_delete", startSpan("delete")),
+		cb.Delete().After("gorm:delete").Register("tracing:after_delete", endSpan),
+		cb.Row().Before("gorm:row").Register("tracing:before_row", startSpan("row")),
+		cb.Row().After("gorm:row").Register("tracing:after_row", endSpan),
+		cb.Raw().Before("gorm:raw").Register("tracing:before_raw", startSpan("raw")),
+		cb.Raw().After("gorm:raw").Register("tracing:after_raw", endSpan),
+	)
+}
+
+func startSpan(operation string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		ctx := tx.Statement.Context
+		if ctx == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+			return
+		}
+		_, span := Tracer().Start(ctx, "db."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", "mysql"),
+				attribute.String("db.operation.name", operation),
+				attribute.String("db.collection.name", tx.Statement.Table),
+			),
+		)
+		tx.InstanceSet(dbSpanKey, span)
+	}
+}
+
+func endSpan(tx *gorm.DB) {
+	value, ok := tx.InstanceGet(dbSpanKey)
+	if !ok {
+		return
+	}
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+	// 只记录带占位符的 SQL，不记录参数
+	span.SetAttributes(
+		attribute.String("db.query.text", tx.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", tx.Statement.RowsAffected),
+	)
+	if err := tx.Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
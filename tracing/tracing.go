@@ -0,0 +1,119 @@
+// Package tracing 基于 OpenTelemetry 的链路追踪：W3C trace context 传播、
+// 请求、数据库和外部 HTTP 调用的 span，通过 OTLP 或本地文件导出
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentation = "api-pay"
+
+// 导出方式
+const (
+	ExporterNone = "none"
+	ExporterOTLP = "otlp"
+	ExporterFile = "file"
+)
+
+// Options 链路追踪配置
+type Options struct {
+	ServiceName string
+	Exporter    string  // none、otlp、file
+	Endpoint    string  // OTLP/HTTP 接收地址
+	Insecure    bool    // OTLP 使用 HTTP 明文
+	File        string  // file 导出的文件路径
+	SampleRatio float64 // 采样比例，0 表示全部采样
+}
+
+// Init 初始化全局 TracerProvider 和 W3C 传播器。
+// 未配置导出时仍生成 trace_id，只是不导出 span。
+func Init(ctx context.Context, cfg Options) (shutdown func(context.Context) error, err error) {
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	ratio := cfg.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	}
+
+	closers := []func(context.Context) error{}
+	switch cfg.Exporter {
+	case "", ExporterNone:
+	case ExporterOTLP:
+		clientOpts := []otlptracehttp.Option{}
+		if cfg.Endpoint != "" {
+			clientOpts = append(clientOpts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			clientOpts = append(clientOpts, otlptracehttp.WithInsecure())
+		}
+		exporter, err := otlptracehttp.New(ctx, clientOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("create otlp exporter: %w", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	case ExporterFile:
+		path := cfg.File
+		if path == "" {
+			path = "logs/traces.json"
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("open trace file: %w", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("create file exporter: %w", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+		closers = append(closers, func(context.Context) error { return f.Close() })
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		for _, closeFn := range closers {
+			if closeErr := closeFn(ctx); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+// Tracer 本服务的 Tracer
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// TraceID 返回上下文中 span 的 trace id，没有时为空串
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
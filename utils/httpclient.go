@@ -2,10 +2,13 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+
+	"api-pay/tracing"
 )
 
 // HTTPClient 是一个通用的HTTP客户端
@@ -13,6 +16,7 @@ type HTTPClient struct {
 	BaseURL    string            // 基础URL
 	Headers    map[string]string // 默认请求头
 	HTTPClient *http.Client      // HTTP客户端实例
+	ctx        context.Context   // 请求上下文，用于传递链路追踪信息
 }
 
 // NewHTTPClient 创建一个新的HTTPClient实例
@@ -20,8 +24,21 @@ func NewHTTPClient(baseURL string) *HTTPClient {
 	return &HTTPClient{
 		BaseURL:    baseURL,
 		Headers:    make(map[string]string),
-		HTTPClient: &http.Client{},
+		HTTPClient: &http.Client{Transport: tracing.Transport(nil)},
+	}
+}
+
+// WithContext 设置请求上下文，外部调用的 span 挂在该上下文的链路下
+func (c *HTTPClient) WithContext(ctx context.Context) *HTTPClient {
+	c.ctx = ctx
+	return c
+}
+
+func (c *HTTPClient) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
 	}
+	return c.ctx
 }
 
 // SetHeader 设置请求头
@@ -41,7 +58,7 @@ func (c *HTTPClient) Post(endpoint string, body interface{}, response interface{
 	}
 
 	// 创建HTTP请求
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
+	req, err := http.NewRequestWithContext(c.context(), "POST", url, bytes.NewBuffer(requestBody))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -79,7 +96,7 @@ func (c *HTTPClient) Get(endpoint string, response interface{}) error {
 	url := c.BaseURL + endpoint
 
 	// 创建HTTP请求
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(c.context(), "GET", url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}